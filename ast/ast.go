@@ -28,6 +28,7 @@ type Expression interface {
 // Program はASTのルートノード
 type Program struct {
 	Statements []Statement
+	Comments   []*Comment // ソース中の全コメント(出現順)。lexer.NewWithComments を使った場合のみ設定される
 }
 
 // Program は Node Interface を満たす
@@ -49,6 +50,18 @@ func (p *Program) String() string {
 	return out.String()
 }
 
+// Comment はコメントを表す構造体
+// 評価やコンパイルには使われず、フォーマッタなどがソースを再構成するために使う
+type Comment struct {
+	Token    token.Token // token.COMMENT トークン
+	Text     string      // 区切り文字を含むコメント全体
+	Trailing bool        // 同じ行のコードの後ろに書かれたコメントかどうか
+}
+
+// Comment は Node Interface を満たす
+func (c *Comment) TokenLiteral() string { return c.Token.Literal }
+func (c *Comment) String() string       { return c.Text }
+
 // LetStatement は let文を表す構造体
 type LetStatement struct {
 	Token token.Token // token.LET トークン
@@ -64,6 +77,9 @@ func (l *LetStatement) String() string {
 
 	out.WriteString(l.TokenLiteral() + " ")
 	out.WriteString(l.Name.String())
+	if l.Name.Type != nil {
+		out.WriteString(": " + l.Name.Type.String())
+	}
 	out.WriteString(" = ")
 
 	if l.Value != nil {
@@ -78,6 +94,7 @@ func (l *LetStatement) String() string {
 type Identifier struct {
 	Token token.Token // token.IDENT トークン
 	Value string      // 変数名
+	Type  Type        // 型注釈。let 文の変数名と関数の引数にだけ書ける。省略した場合は nil
 }
 
 // Identifier は Expression Interface を満たす
@@ -216,6 +233,7 @@ func (ie *IfExpression) String() string {
 type BlockStatement struct {
 	Token      token.Token // '{' トークン
 	Statements []Statement
+	Rbrace     token.Token // '}' トークン
 }
 
 // BlockStatement は Statement Interface を満たす
@@ -235,6 +253,7 @@ func (bs *BlockStatement) String() string {
 type FunctionLiteral struct {
 	Token      token.Token // 'fn' トークン
 	Parameters []*Identifier
+	ReturnType Type // 戻り値の型注釈。省略した場合は nil
 	Body       *BlockStatement
 	Name       string
 }
@@ -247,7 +266,11 @@ func (fl *FunctionLiteral) String() string {
 
 	params := []string{}
 	for _, p := range fl.Parameters {
-		params = append(params, p.String())
+		if p.Type != nil {
+			params = append(params, p.String()+": "+p.Type.String())
+		} else {
+			params = append(params, p.String())
+		}
 	}
 
 	out.WriteString(fl.TokenLiteral())
@@ -257,6 +280,9 @@ func (fl *FunctionLiteral) String() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ","))
 	out.WriteString(")")
+	if fl.ReturnType != nil {
+		out.WriteString(" -> " + fl.ReturnType.String())
+	}
 	out.WriteString(fl.Body.String())
 
 	return out.String()
@@ -288,6 +314,19 @@ func (ce *CallExpression) String() string {
 	return out.String()
 }
 
+// Interpolation は文字列補間 "...${x}..." の式部分を表す構造体
+// 式の値を組み込み関数 str と同じ規則で文字列に変換する。識別子 str を経由しないので、
+// ユーザーが str という名前を束縛しても影響を受けない
+type Interpolation struct {
+	Token token.Token // '${' トークン。位置は補間の式の先頭
+	Value Expression
+}
+
+// Interpolation は Expression Interface を満たす
+func (i *Interpolation) expressionNode()      {}
+func (i *Interpolation) TokenLiteral() string { return i.Token.Literal }
+func (i *Interpolation) String() string       { return "str(" + i.Value.String() + ")" }
+
 // StringLiteral は文字列リテラルを表す構造体
 type StringLiteral struct {
 	Token token.Token
@@ -345,10 +384,41 @@ func (ie *IndexExpression) String() string {
 	return out.String()
 }
 
+// SliceExpression はスライス演算子を表す構造体
+// arr[1:3], str[:2], str[1:] など
+type SliceExpression struct {
+	Token token.Token // '[' トークン
+	Left  Expression
+	Start Expression // 省略された場合は nil
+	End   Expression // 省略された場合は nil
+}
+
+// SliceExpression は Expression Interface を満たす
+func (se *SliceExpression) expressionNode()      {}
+func (se *SliceExpression) TokenLiteral() string { return se.Token.Literal }
+func (se *SliceExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(se.Left.String())
+	out.WriteString("[")
+	if se.Start != nil {
+		out.WriteString(se.Start.String())
+	}
+	out.WriteString(":")
+	if se.End != nil {
+		out.WriteString(se.End.String())
+	}
+	out.WriteString("])")
+
+	return out.String()
+}
+
 // HashLiteral はハッシュリテラルを表す構造体
 type HashLiteral struct {
 	Token token.Token // '{' トークン
 	Pairs map[Expression]Expression
+	Keys  []Expression // ソース中に現れた順のキー
 }
 
 // HashLiteral は Expression Interface を満たす
@@ -358,8 +428,8 @@ func (hl *HashLiteral) String() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+":"+value.String())
+	for _, key := range hl.Keys {
+		pairs = append(pairs, key.String()+":"+hl.Pairs[key].String())
 	}
 
 	out.WriteString("{")
@@ -2,6 +2,7 @@ package ast
 
 import (
 	"monkey/token"
+	"strings"
 	"testing"
 )
 
@@ -28,3 +29,42 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+// let x = {"a": -1}; を手で組み立てて Fprint の出力を確認するテスト
+func TestFprint(t *testing.T) {
+	key := &StringLiteral{Token: token.Token{Type: token.STRING, Literal: "a", Line: 1, Column: 10}, Value: "a"}
+	value := &PrefixExpression{
+		Token:    token.Token{Type: token.MINUS, Literal: "-", Line: 1, Column: 15},
+		Operator: "-",
+		Right:    &IntegerLiteral{Token: token.Token{Type: token.INT, Literal: "1", Line: 1, Column: 16}, Value: 1},
+	}
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: token.Token{Type: token.LET, Literal: "let", Line: 1, Column: 1},
+				Name:  &Identifier{Token: token.Token{Type: token.IDENT, Literal: "x", Line: 1, Column: 5}, Value: "x"},
+				Value: &HashLiteral{
+					Token: token.Token{Type: token.LBRACE, Literal: "{", Line: 1, Column: 9},
+					Pairs: map[Expression]Expression{key: value},
+					Keys:  []Expression{key},
+				},
+			},
+		},
+	}
+
+	expected := `Program
+  Statements[0]: LetStatement 1:1
+    Name: Identifier 1:5 Value="x"
+    Value: HashLiteral 1:9
+      Key[0]: StringLiteral 1:10 Value="a"
+      Value[0]: PrefixExpression 1:15 Operator="-"
+        Right: IntegerLiteral 1:16 Value=1
+`
+	var out strings.Builder
+	if err := Fprint(&out, program); err != nil {
+		t.Fatalf("Fprint failed: %s", err)
+	}
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant:\n%s\ngot:\n%s", expected, out.String())
+	}
+}
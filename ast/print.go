@@ -0,0 +1,88 @@
+package ast
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// Fprint は構文木を1行に1ノードずつ、子をインデントして書き出す。
+// 各行はフィールド名、ノードの型名、位置、文字列や数値のフィールドからなる
+//
+//	LetStatement 1:1
+//	  Name: Identifier 1:5 Value="x"
+//	  Value: IntegerLiteral 1:9 Value=1
+func Fprint(w io.Writer, node Node) error {
+	p := &printer{}
+	p.node("", reflect.ValueOf(node), 0)
+	_, err := io.WriteString(w, p.out.String())
+	return err
+}
+
+type printer struct {
+	out strings.Builder
+}
+
+var nodeType = reflect.TypeOf((*Node)(nil)).Elem()
+
+func (p *printer) node(label string, v reflect.Value, depth int) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	if !v.IsValid() || v.IsNil() {
+		return
+	}
+
+	s := v.Elem()
+	p.out.WriteString(strings.Repeat("  ", depth))
+	p.out.WriteString(label)
+	p.out.WriteString(s.Type().Name())
+	if tok := s.FieldByName("Token"); tok.IsValid() {
+		fmt.Fprintf(&p.out, " %d:%d", tok.FieldByName("Line").Int(), tok.FieldByName("Column").Int())
+	}
+
+	// 文字列や数値のフィールドを同じ行に書き、子ノードはあとで次の行から書く
+	children := []reflect.StructField{}
+	for i := 0; i < s.NumField(); i++ {
+		field, value := s.Type().Field(i), s.Field(i)
+		switch {
+		case field.Name == "Token" || !field.IsExported():
+		case value.Kind() == reflect.String:
+			if value.String() != "" {
+				fmt.Fprintf(&p.out, " %s=%q", field.Name, value.String())
+			}
+		case value.Kind() == reflect.Int64 || value.Kind() == reflect.Int:
+			fmt.Fprintf(&p.out, " %s=%d", field.Name, value.Int())
+		case value.Kind() == reflect.Bool:
+			if value.Bool() {
+				fmt.Fprintf(&p.out, " %s", field.Name)
+			}
+		default:
+			children = append(children, field)
+		}
+	}
+	p.out.WriteString("\n")
+
+	for _, field := range children {
+		value := s.FieldByIndex(field.Index)
+		switch {
+		case field.Name == "Keys" && s.FieldByName("Pairs").IsValid():
+			// HashLiteral のキーは Pairs と一緒に書く
+		case value.Kind() == reflect.Slice:
+			for i := 0; i < value.Len(); i++ {
+				p.node(fmt.Sprintf("%s[%d]: ", field.Name, i), value.Index(i), depth+1)
+			}
+		case value.Kind() == reflect.Map:
+			// HashLiteral の Pairs はソース中に現れた順にキーと値を書く
+			if keys := s.FieldByName("Keys"); keys.IsValid() {
+				for i := 0; i < keys.Len(); i++ {
+					p.node(fmt.Sprintf("Key[%d]: ", i), keys.Index(i), depth+1)
+					p.node(fmt.Sprintf("Value[%d]: ", i), value.MapIndex(keys.Index(i)), depth+1)
+				}
+			}
+		case value.Type().Implements(nodeType):
+			p.node(field.Name+": ", value, depth+1)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ast
+
+import (
+	"bytes"
+	"monkey/token"
+	"strings"
+)
+
+// Type は型注釈を表すノード
+// let x: int = 5; や fn(a: string, b: [int]) -> int の型の部分
+// 評価やコンパイルには使われず、型検査器(types パッケージ)だけが使う
+type Type interface {
+	Node
+	typeNode()
+}
+
+// NamedType は名前で表す型 (int, string, bool, null, any)
+type NamedType struct {
+	Token token.Token // token.IDENT トークン
+	Name  string
+}
+
+// NamedType は Type Interface を満たす
+func (nt *NamedType) typeNode()            {}
+func (nt *NamedType) TokenLiteral() string { return nt.Token.Literal }
+func (nt *NamedType) String() string       { return nt.Name }
+
+// ArrayType は配列の型 [int]
+type ArrayType struct {
+	Token   token.Token // '[' トークン
+	Element Type
+}
+
+// ArrayType は Type Interface を満たす
+func (at *ArrayType) typeNode()            {}
+func (at *ArrayType) TokenLiteral() string { return at.Token.Literal }
+func (at *ArrayType) String() string       { return "[" + at.Element.String() + "]" }
+
+// HashType はハッシュの型 {string: int}
+type HashType struct {
+	Token token.Token // '{' トークン
+	Key   Type
+	Value Type
+}
+
+// HashType は Type Interface を満たす
+func (ht *HashType) typeNode()            {}
+func (ht *HashType) TokenLiteral() string { return ht.Token.Literal }
+func (ht *HashType) String() string {
+	return "{" + ht.Key.String() + ": " + ht.Value.String() + "}"
+}
+
+// FunctionType は関数の型 fn(int, int) -> int
+// 戻り値の型を省略した場合、Return は nil
+type FunctionType struct {
+	Token      token.Token // 'fn' トークン
+	Parameters []Type
+	Return     Type
+}
+
+// FunctionType は Type Interface を満たす
+func (ft *FunctionType) typeNode()            {}
+func (ft *FunctionType) TokenLiteral() string { return ft.Token.Literal }
+func (ft *FunctionType) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+	for _, p := range ft.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString("fn(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	if ft.Return != nil {
+		out.WriteString(" -> " + ft.Return.String())
+	}
+
+	return out.String()
+}
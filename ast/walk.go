@@ -0,0 +1,126 @@
+package ast
+
+import "monkey/token"
+
+// TokenOf はノードが保持するトークンを返す
+// ノードの位置を調べるために使う
+func TokenOf(node Node) token.Token {
+	switch node := node.(type) {
+	case *LetStatement:
+		return node.Token
+	case *ReturnStatement:
+		return node.Token
+	case *ExpressionStatement:
+		return node.Token
+	case *BlockStatement:
+		return node.Token
+	case *Identifier:
+		return node.Token
+	case *IntegerLiteral:
+		return node.Token
+	case *Boolean:
+		return node.Token
+	case *StringLiteral:
+		return node.Token
+	case *PrefixExpression:
+		return node.Token
+	case *InfixExpression:
+		return node.Token
+	case *IfExpression:
+		return node.Token
+	case *FunctionLiteral:
+		return node.Token
+	case *CallExpression:
+		return node.Token
+	case *Interpolation:
+		return node.Token
+	case *ArrayLiteral:
+		return node.Token
+	case *IndexExpression:
+		return node.Token
+	case *SliceExpression:
+		return node.Token
+	case *HashLiteral:
+		return node.Token
+	case *NamedType:
+		return node.Token
+	case *ArrayType:
+		return node.Token
+	case *HashType:
+		return node.Token
+	case *FunctionType:
+		return node.Token
+	}
+	return token.Token{}
+}
+
+// Inspect はノードとその子孫を深さ優先でたどり、それぞれに fn を適用する
+// fn が false を返した場合、そのノードの子孫はたどらない
+func Inspect(node Node, fn func(Node) bool) {
+	if node == nil || !fn(node) {
+		return
+	}
+
+	switch node := node.(type) {
+	case *LetStatement:
+		Inspect(node.Name, fn)
+		if node.Value != nil {
+			Inspect(node.Value, fn)
+		}
+	case *ReturnStatement:
+		if node.ReturnValue != nil {
+			Inspect(node.ReturnValue, fn)
+		}
+	case *ExpressionStatement:
+		if node.Expression != nil {
+			Inspect(node.Expression, fn)
+		}
+	case *BlockStatement:
+		for _, s := range node.Statements {
+			Inspect(s, fn)
+		}
+	case *PrefixExpression:
+		Inspect(node.Right, fn)
+	case *InfixExpression:
+		Inspect(node.Left, fn)
+		Inspect(node.Right, fn)
+	case *IfExpression:
+		Inspect(node.Condition, fn)
+		Inspect(node.Consequence, fn)
+		if node.Alternative != nil {
+			Inspect(node.Alternative, fn)
+		}
+	case *FunctionLiteral:
+		for _, p := range node.Parameters {
+			Inspect(p, fn)
+		}
+		Inspect(node.Body, fn)
+	case *CallExpression:
+		Inspect(node.Function, fn)
+		for _, a := range node.Arguments {
+			Inspect(a, fn)
+		}
+	case *Interpolation:
+		Inspect(node.Value, fn)
+	case *ArrayLiteral:
+		for _, e := range node.Elements {
+			Inspect(e, fn)
+		}
+	case *IndexExpression:
+		Inspect(node.Left, fn)
+		Inspect(node.Index, fn)
+	case *SliceExpression:
+		Inspect(node.Left, fn)
+		if node.Start != nil {
+			Inspect(node.Start, fn)
+		}
+		if node.End != nil {
+			Inspect(node.End, fn)
+		}
+	case *HashLiteral:
+		for _, k := range node.Keys {
+			Inspect(k, fn)
+			Inspect(node.Pairs[k], fn)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"monkey/object"
 	"monkey/parser"
 	"monkey/vm"
+	"runtime"
 
 	"time"
 )
@@ -35,6 +36,7 @@ func main() {
 
 	var duration time.Duration
 	var result object.Object
+	var before, after runtime.MemStats
 
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -51,6 +53,7 @@ func main() {
 
 		machine := vm.New(comp.Bytecode())
 
+		runtime.ReadMemStats(&before)
 		start := time.Now()
 
 		err = machine.Run()
@@ -60,19 +63,24 @@ func main() {
 		}
 
 		duration = time.Since(start)
+		runtime.ReadMemStats(&after)
 		result = machine.LastPoppedStackElem()
 	} else {
 		env := object.NewEnvironment()
+		runtime.ReadMemStats(&before)
 		start := time.Now()
 
 		result = evaluator.Eval(program, env)
 		duration = time.Since(start)
+		runtime.ReadMemStats(&after)
 	}
 
 	fmt.Printf(
-		"engine=%s, result=%s, duration=%s\n",
+		"engine=%s, result=%s, duration=%s, allocs=%d, gc=%d\n",
 		*engine,
 		result.Inspect(),
 		duration.String(),
+		after.Mallocs-before.Mallocs,
+		after.NumGC-before.NumGC,
 	)
 }
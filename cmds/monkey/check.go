@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/types"
+	"os"
+	"strings"
+)
+
+// monkey check [file ...]
+// 型注釈と推論した型を検査する。ファイルを指定しない場合は標準入力を検査する。
+// 型エラーがあれば終了コード 1、ファイルを読めないか構文エラーがあれば 2 を返す
+func checkCommand(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: monkey check [file ...]")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read stdin: %s\n", err)
+			return 2
+		}
+		return checkSource("<standard input>", string(src))
+	}
+
+	status := 0
+	for _, fileName := range flags.Args() {
+		src, err := os.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 2
+			continue
+		}
+		status = max(status, checkSource(fileName, string(src)))
+	}
+	return status
+}
+
+func checkSource(name, src string) int {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		fmt.Fprintf(os.Stderr, "%s: parser errors:\n\t%s\n", name, strings.Join(p.Errors(), "\n\t"))
+		return 2
+	}
+
+	errors := types.Check(program)
+	for _, err := range errors {
+		fmt.Fprintf(os.Stdout, "%s:%s\n", name, err)
+	}
+	if len(errors) > 0 {
+		return 1
+	}
+	return 0
+}
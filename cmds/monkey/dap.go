@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"monkey/dap"
+	"os"
+)
+
+// monkey dap
+// 標準入出力で Debug Adapter Protocol のサーバーを起動する
+func dapCommand() int {
+	server := dap.NewServer(os.Stdin, os.Stdout)
+	if err := server.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey dap: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+	"monkey/debugger"
+	"os"
+)
+
+// monkey debug <file>
+// ファイルを VM でデバッグ実行する。コマンドは標準入力から読む
+func debugCommand(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: monkey debug <file>")
+		return 2
+	}
+
+	src, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	if err := debugger.New(os.Stdin, os.Stdout).Run(string(src)); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", args[0], err)
+		return 1
+	}
+	return 0
+}
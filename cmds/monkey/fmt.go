@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/format"
+	"os"
+	"strings"
+)
+
+// monkey fmt [-w] [-d] [file ...]
+// ファイルを指定しない場合は標準入力を整形して標準出力に書き出す
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "write result to (source) file instead of stdout")
+	diff := flags.Bool("d", false, "display diffs instead of rewriting files")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: monkey fmt [-w] [-d] [file ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read stdin: %s\n", err)
+			return 2
+		}
+		formatted, err := format.Source(string(src))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "<standard input>: %s\n", err)
+			return 2
+		}
+		if *diff {
+			io.WriteString(os.Stdout, unifiedDiff("<standard input>", string(src), formatted))
+		} else {
+			io.WriteString(os.Stdout, formatted)
+		}
+		return 0
+	}
+
+	status := 0
+	for _, fileName := range flags.Args() {
+		if err := formatFile(fileName, *write, *diff); err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s\n", fileName, err)
+			status = 2
+		}
+	}
+	return status
+}
+
+func formatFile(fileName string, write, diff bool) error {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(string(src))
+	if err != nil {
+		return err
+	}
+
+	if diff {
+		io.WriteString(os.Stdout, unifiedDiff(fileName, string(src), formatted))
+	}
+	if write {
+		if string(src) == formatted {
+			return nil
+		}
+		info, err := os.Stat(fileName)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(fileName, []byte(formatted), info.Mode().Perm())
+	}
+	if !diff {
+		io.WriteString(os.Stdout, formatted)
+	}
+	return nil
+}
+
+// unifiedDiff は old と new の行単位の差分を unified 形式で返す。差分がなければ空文字列を返す
+func unifiedDiff(name, old, new string) string {
+	if old == new {
+		return ""
+	}
+
+	a := splitLines(old)
+	b := splitLines(new)
+
+	// 最長共通部分列を動的計画法で求める
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type line struct {
+		kind byte // ' ', '-', '+'
+		text string
+		a, b int // 0始まりの行番号
+	}
+	lines := []line{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, line{' ', a[i], i, j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, line{'-', a[i], i, j})
+			i++
+		default:
+			lines = append(lines, line{'+', b[j], i, j})
+			j++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+
+	for start := 0; start < len(lines); {
+		if lines[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		// 変更の前後 context 行を含み、近い変更をまとめたハンクを作る
+		from := max(start-context, 0)
+		to := start
+		for k := start; k < len(lines) && k <= to+2*context; k++ {
+			if lines[k].kind != ' ' {
+				to = k
+			}
+		}
+		to = min(to+context, len(lines)-1)
+
+		hunk := lines[from : to+1]
+		oldCount, newCount := 0, 0
+		for _, l := range hunk {
+			if l.kind != '+' {
+				oldCount++
+			}
+			if l.kind != '-' {
+				newCount++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", hunk[0].a+1, oldCount, hunk[0].b+1, newCount)
+		for _, l := range hunk {
+			fmt.Fprintf(&out, "%c%s\n", l.kind, l.text)
+		}
+
+		start = to + 1
+	}
+
+	return out.String()
+}
+
+func splitLines(s string) []string {
+	lines := strings.Split(s, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"fmt"
+	"monkey/kernel"
+	"os"
+)
+
+// monkey kernel
+// 標準入出力で JSON のメッセージをやり取りする Jupyter カーネルを起動する
+func kernelCommand() int {
+	k, err := kernel.New(os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+		return 1
+	}
+	if err := k.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey kernel: %s\n", err)
+		return 1
+	}
+	return 0
+}
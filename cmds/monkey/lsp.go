@@ -0,0 +1,18 @@
+package main
+
+import (
+	"fmt"
+	"monkey/lsp"
+	"os"
+)
+
+// monkey lsp
+// 標準入出力で Language Server Protocol のサーバーを起動する
+func lspCommand() int {
+	server := lsp.NewServer(os.Stdin, os.Stdout)
+	if err := server.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "monkey lsp: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -9,6 +9,8 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"monkey/stdlib"
+	"monkey/types"
 	"os"
 )
 
@@ -21,6 +23,12 @@ func runFile(fileName string) {
 	defer file.Close()
 
 	env := object.NewEnvironment()
+	if err := stdlib.LoadEnvironment(env); err != nil {
+		fmt.Printf("Could not load prelude: %s\n", err)
+		os.Exit(1)
+	}
+	checker := types.New()
+
 	scanner := bufio.NewScanner(file)
 
 	for scanner.Scan() {
@@ -34,6 +42,11 @@ func runFile(fileName string) {
 			continue
 		}
 
+		if errors := checker.Check(program); len(errors) != 0 {
+			printTypeErrors(os.Stdout, errors)
+			continue
+		}
+
 		evaluated := evaluator.Eval(program, env)
 		if evaluated != nil {
 			io.WriteString(os.Stdout, evaluated.Inspect())
@@ -55,6 +68,13 @@ func printParseErrors(out io.Writer, errors []string) {
 	}
 }
 
+func printTypeErrors(out io.Writer, errors []*types.Error) {
+	io.WriteString(out, "Woops! Type check failed:\n")
+	for _, err := range errors {
+		io.WriteString(out, "\t"+err.Error()+"\n")
+	}
+}
+
 const MONKEY_FACE = `            __,__
    .--.  .-"     "-.  .--.
   / .. \/  .-. .-.  \/ .. \
@@ -71,8 +91,38 @@ const MONKEY_FACE = `            __,__
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("Usage: monkey <file>")
+		fmt.Println("       monkey run [--vm] [--profile file] [--trace] [--trace-func name] <file>")
+		fmt.Println("       monkey test [-v] [--vm] [--cover] [--coverprofile file] [--junit file] [path ...]")
+		fmt.Println("       monkey fmt [-w] [-d] [file ...]")
+		fmt.Println("       monkey vet [file ...]")
+		fmt.Println("       monkey check [file ...]")
+		fmt.Println("       monkey debug <file>")
+		fmt.Println("       monkey lsp")
+		fmt.Println("       monkey dap")
+		fmt.Println("       monkey kernel")
 		os.Exit(1)
 	}
-	fileName := os.Args[1]
-	runFile(fileName)
+
+	switch os.Args[1] {
+	case "test":
+		os.Exit(testCommand(os.Args[2:]))
+	case "fmt":
+		os.Exit(fmtCommand(os.Args[2:]))
+	case "check":
+		os.Exit(checkCommand(os.Args[2:]))
+	case "debug":
+		os.Exit(debugCommand(os.Args[2:]))
+	case "vet":
+		os.Exit(vetCommand(os.Args[2:]))
+	case "lsp":
+		os.Exit(lspCommand())
+	case "dap":
+		os.Exit(dapCommand())
+	case "kernel":
+		os.Exit(kernelCommand())
+	case "run":
+		os.Exit(runCommand(os.Args[2:]))
+	default:
+		runFile(os.Args[1])
+	}
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"monkey/ast"
+	"monkey/debugger"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/profiler"
+	"monkey/stdlib"
+	"monkey/trace"
+	"monkey/vm"
+	"os"
+)
+
+// monkey run [--vm] [--profile file] [--trace] [--trace-func name] <file>
+// フラグを指定しない場合はファイルを1行ずつ評価器で評価し、それぞれの結果を表示する。
+// --vm を指定するとファイル全体をコンパイルして VM で実行する。
+// --profile を指定すると VM で実行してプロファイルを取り、
+// レポートを標準エラー出力に、pprof 形式のプロファイルを file に書き出す。
+// --trace を指定すると、VM の命令か評価器が評価した節を JSON lines で標準エラー出力に書き出す。
+// 評価器でもファイル全体を一度に評価するので、同じファイルの VM の記録と比べられる
+func runCommand(args []string) int {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	useVM := flags.Bool("vm", false, "compile the whole file and run it on the VM")
+	profile := flags.String("profile", "", "run on the VM and write a pprof profile to `file`")
+	traceOn := flags.Bool("trace", false, "write every executed instruction or evaluated node to stderr as JSON lines")
+	traceFunc := flags.String("trace-func", "", "trace only inside the function `name` (main for the top level)")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: monkey run [--vm] [--profile file] [--trace] [--trace-func name] <file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	fileName := flags.Arg(0)
+	if *traceFunc != "" {
+		*traceOn = true
+	}
+
+	switch {
+	case *useVM || *profile != "":
+		return vmFile(fileName, *profile, *traceOn, *traceFunc)
+	case *traceOn:
+		return traceFile(fileName, *traceFunc)
+	default:
+		runFile(fileName)
+		return 0
+	}
+}
+
+func vmFile(fileName, profileName string, traceOn bool, traceFunc string) int {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	program, err := debugger.Compile(string(src))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fileName, err)
+		return 2
+	}
+
+	var h vm.Hooks
+	var prof *profiler.Profiler
+	if profileName != "" {
+		prof = profiler.New(program, fileName)
+		h = append(h, prof)
+	}
+	if traceOn {
+		h = append(h, trace.NewVM(os.Stderr, traceFunc))
+	}
+
+	status := 0
+	if err := program.Run(h); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fileName, err)
+		status = 1
+	}
+	if prof == nil {
+		return status
+	}
+	prof.Stop()
+
+	if err := prof.WriteReport(os.Stderr); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	out, err := os.Create(profileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	defer out.Close()
+	if err := prof.WritePprof(out); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", profileName, err)
+		return 2
+	}
+	return status
+}
+
+// traceFile はファイル全体を評価器で評価し、評価した節を書き出す
+func traceFile(fileName, traceFunc string) int {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+
+	p := parser.New(lexer.New(string(src)))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		printParseErrors(os.Stderr, p.Errors())
+		return 2
+	}
+
+	tracer := trace.NewEvaluator(os.Stderr, traceFunc)
+	result, err := evalProgram(program, tracer)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	if err := tracer.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	if err, ok := result.(*object.Error); ok {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", fileName, err.Inspect())
+		return 1
+	}
+	return 0
+}
+
+// evalProgram は prelude を読み込んだ環境で program を評価する。tracer が nil でなければ評価を観察させる
+func evalProgram(program *ast.Program, tracer object.Tracer) (object.Object, error) {
+	env := object.NewEnvironment()
+	if err := stdlib.LoadEnvironment(env); err != nil {
+		return nil, fmt.Errorf("could not load prelude: %s", err)
+	}
+
+	if tracer != nil {
+		env.SetTracer(tracer)
+	}
+	return evaluator.Eval(program, env), nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"monkey/cover"
+	"monkey/tester"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// monkey test [-v] [--vm] [--cover] [--coverprofile file] [--junit file] [path ...]
+// path のファイルと、path のディレクトリ以下の *_test.mk のテスト関数を実行する。path を省略するとカレントディレクトリ。
+// 失敗したテストがあれば終了コードは 1 になる。
+// --cover を指定すると、実行した文と if 式の分岐の割合をファイルごとに表示する。
+// --coverprofile を指定すると、カバレッジを LCOV の形式で file に書き出す。
+// --junit を指定すると、結果を JUnit の XML の形式で file に書き出す
+func testCommand(args []string) int {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	verbose := flags.Bool("v", false, "print the result of every test function")
+	useVM := flags.Bool("vm", false, "run the tests on the VM instead of the evaluator")
+	coverOn := flags.Bool("cover", false, "report statement and branch coverage")
+	coverProfile := flags.String("coverprofile", "", "write an LCOV coverage profile to `file` (implies --cover)")
+	junit := flags.String("junit", "", "write the results to `file` as JUnit XML")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: monkey test [-v] [--vm] [--cover] [--coverprofile file] [--junit file] [path ...]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if *coverProfile != "" {
+		*coverOn = true
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+	files, err := testFiles(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		return 2
+	}
+	if len(files) == 0 {
+		fmt.Fprintln(os.Stderr, "no test files")
+		return 2
+	}
+
+	opts := tester.Options{VM: *useVM, Cover: *coverOn}
+	results := []*tester.FileResult{}
+	profiles := []*cover.Profile{}
+	passed, failed := 0, 0
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+
+		result := tester.RunFile(file, string(src), opts)
+		printTestResult(result, *verbose)
+		results = append(results, result)
+		if result.Profile != nil {
+			profiles = append(profiles, result.Profile)
+		}
+		passed += result.Passed()
+		failed += result.Failed()
+	}
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+
+	if *coverProfile != "" {
+		if err := writeFile(*coverProfile, func(f *os.File) error { return cover.WriteLCOV(f, profiles) }); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+	}
+	if *junit != "" {
+		if err := writeFile(*junit, func(f *os.File) error { return tester.WriteJUnit(f, results) }); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			return 2
+		}
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// printTestResult は go test と同じ形式でファイルの結果を表示する。verbose なら成功したテストも表示する
+func printTestResult(r *tester.FileResult, verbose bool) {
+	for _, t := range r.Tests {
+		switch {
+		case t.Failure != nil:
+			fmt.Printf("--- FAIL: %s (%.2fs)\n", t.Name, t.Duration.Seconds())
+			fmt.Printf("    %s\n", indent(t.Failure.Format(r.File)))
+		case verbose:
+			fmt.Printf("--- PASS: %s (%.2fs)\n", t.Name, t.Duration.Seconds())
+		}
+	}
+
+	status := "ok  "
+	if r.Failed() > 0 {
+		status = "FAIL"
+	}
+	line := fmt.Sprintf("%s\t%s\t%.3fs", status, r.File, r.Duration.Seconds())
+	switch {
+	case r.Failure != nil:
+		line += "\n    " + indent(r.Failure.Format(r.File))
+	case len(r.Tests) == 0:
+		line += "\t[no test functions]"
+	}
+	if r.Profile != nil && r.Failure == nil {
+		statements, statementsTotal := r.Profile.Statements()
+		branches, branchesTotal := r.Profile.Branches()
+		line += fmt.Sprintf("\tcoverage: %.1f%% of statements, %.1f%% of branches",
+			cover.Percent(statements, statementsTotal), cover.Percent(branches, branchesTotal))
+	}
+	fmt.Println(line)
+}
+
+func indent(s string) string {
+	return strings.ReplaceAll(s, "\n", "\n    ")
+}
+
+// writeFile は file を作って write で書き出す
+func writeFile(file string, write func(*os.File) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("%s: %s", file, err)
+	}
+	return f.Close()
+}
+
+// testFiles は paths のファイルと、paths のディレクトリ以下の *_test.mk を名前の順に返す
+func testFiles(paths []string) ([]string, error) {
+	files := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && strings.HasSuffix(p, "_test.mk") {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"monkey/vet"
+	"os"
+)
+
+// monkey vet [file ...]
+// ファイルを指定しない場合は標準入力を検査する。
+// 警告があれば終了コード 1、ファイルを読めないか構文エラーがあれば 2 を返す
+func vetCommand(args []string) int {
+	flags := flag.NewFlagSet("vet", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: monkey vet [file ...]")
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Could not read stdin: %s\n", err)
+			return 2
+		}
+		return vetSource("<standard input>", string(src))
+	}
+
+	status := 0
+	for _, fileName := range flags.Args() {
+		src, err := os.ReadFile(fileName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			status = 2
+			continue
+		}
+		status = max(status, vetSource(fileName, string(src)))
+	}
+	return status
+}
+
+func vetSource(name, src string) int {
+	diagnostics, err := vet.Source(src)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", name, err)
+		return 2
+	}
+
+	for _, d := range diagnostics {
+		fmt.Fprintf(os.Stdout, "%s:%s\n", name, d)
+	}
+	if len(diagnostics) > 0 {
+		return 1
+	}
+	return 0
+}
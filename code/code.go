@@ -30,6 +30,18 @@ func (ins Instructions) String() string {
 	return out.String()
 }
 
+// Disassemble returns the instruction starting at offset ip in the same format as String,
+// without the offset, e.g. "OpConstant 1".
+func (ins Instructions) Disassemble(ip int) string {
+	def, err := Lookup(ins[ip])
+	if err != nil {
+		return fmt.Sprintf("ERROR: %s", err)
+	}
+
+	operands, _ := ReadOperands(def, ins[ip+1:])
+	return ins.fmtInstruction(def, operands)
+}
+
 func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
 	operandCount := len(def.OperandWidths)
 
@@ -82,6 +94,7 @@ const (
 	OpClosure
 	OpGetFree
 	OpCurrentClosure
+	OpSlice
 )
 
 type Definition struct {
@@ -120,6 +133,7 @@ var definitions = map[Opcode]*Definition{
 	OpClosure:        {"OpClosure", []int{2, 1}}, // The first operand is the constant index of the function, the second operand is the number of free variables
 	OpGetFree:        {"OpGetFree", []int{1}},
 	OpCurrentClosure: {"OpCurrentClosure", []int{}},
+	OpSlice:          {"OpSlice", []int{}}, // Pops the end, the start and the sliced object. An omitted bound is pushed as Null
 }
 
 // Lookup returns the definition of an opcode
@@ -58,6 +58,28 @@ func TestInstructionsString(t *testing.T) {
 	}
 }
 
+func TestDisassemble(t *testing.T) {
+	ins := Instructions{}
+	ins = append(ins, Make(OpAdd)...)
+	ins = append(ins, Make(OpGetLocal, 1)...)
+	ins = append(ins, Make(OpClosure, 65535, 255)...)
+
+	tests := []struct {
+		ip       int
+		expected string
+	}{
+		{0, "OpAdd"},
+		{1, "OpGetLocal 1"},
+		{3, "OpClosure 65535 255"},
+	}
+
+	for _, tt := range tests {
+		if got := ins.Disassemble(tt.ip); got != tt.expected {
+			t.Errorf("Disassemble(%d) wrong. want=%q, got=%q", tt.ip, tt.expected, got)
+		}
+	}
+}
+
 func TestReadOperands(t *testing.T) {
 	tests := []struct {
 		op        Opcode
@@ -89,3 +111,105 @@ func TestReadOperands(t *testing.T) {
 		}
 	}
 }
+
+func TestSourceMapLookup(t *testing.T) {
+	m := SourceMap{
+		{Offset: 0, Line: 1, Column: 1},
+		{Offset: 4, Line: 2, Column: 1},
+		{Offset: 9, Line: 5, Column: 3},
+	}
+
+	tests := []struct {
+		offset   int
+		expected int // line, 0 if not found
+	}{
+		{0, 1},
+		{3, 1},
+		{4, 2},
+		{8, 2},
+		{9, 5},
+		{100, 5},
+	}
+
+	for _, tt := range tests {
+		pos, ok := m.Lookup(tt.offset)
+		if !ok {
+			t.Errorf("Lookup(%d) not found", tt.offset)
+			continue
+		}
+		if pos.Line != tt.expected {
+			t.Errorf("Lookup(%d) wrong line. want=%d, got=%d", tt.offset, tt.expected, pos.Line)
+		}
+	}
+
+	if _, ok := (SourceMap{}).Lookup(0); ok {
+		t.Errorf("Lookup on empty source map should fail")
+	}
+}
+
+func TestFuse(t *testing.T) {
+	concat := func(instructions ...Instructions) Instructions {
+		out := Instructions{}
+		for _, ins := range instructions {
+			out = append(out, ins...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		input    Instructions
+		expected map[int]Opcode // offsets whose opcode is replaced
+	}{
+		{
+			concat(Make(OpGetLocal, 0), Make(OpConstant, 1), Make(OpAdd)),
+			map[int]Opcode{0: OpGetLocalConstantAdd},
+		},
+		{
+			concat(Make(OpGetLocal, 0), Make(OpConstant, 1), Make(OpSub), Make(OpPop)),
+			map[int]Opcode{0: OpGetLocalConstantSub},
+		},
+		{
+			concat(Make(OpGetLocal, 0), Make(OpConstant, 1), Make(OpEqual), Make(OpJumpNotTruthy, 12), Make(OpNull)),
+			map[int]Opcode{0: OpGetLocalConstant, 5: OpEqualJumpNotTruthy},
+		},
+		{
+			concat(Make(OpConstant, 1), Make(OpGetLocal, 0), Make(OpGreaterThan), Make(OpJumpNotTruthy, 12)),
+			map[int]Opcode{5: OpGreaterThanJumpNotTruthy},
+		},
+		{
+			concat(Make(OpNotEqual), Make(OpJumpNotTruthy, 4)),
+			map[int]Opcode{0: OpNotEqualJumpNotTruthy},
+		},
+		{
+			// The operand of OpConstant looks like OpAdd, but operands are never matched
+			concat(Make(OpGetLocal, int(OpConstant)), Make(OpConstant, int(OpAdd)), Make(OpMul)),
+			map[int]Opcode{0: OpGetLocalConstant},
+		},
+		{
+			concat(Make(OpGetLocal, 0), Make(OpGetLocal, 1), Make(OpAdd), Make(OpEqual), Make(OpPop)),
+			map[int]Opcode{},
+		},
+		{Instructions{}, map[int]Opcode{}},
+	}
+
+	for _, tt := range tests {
+		original := append(Instructions{}, tt.input...)
+		fused := Fuse(tt.input)
+
+		if len(fused) != len(tt.input) {
+			t.Fatalf("fused instructions have wrong length. want=%d, got=%d", len(tt.input), len(fused))
+		}
+		for i := range fused {
+			want := original[i]
+			if op, ok := tt.expected[i]; ok {
+				want = byte(op)
+			}
+			if fused[i] != want {
+				t.Errorf("wrong byte at pos %d of fused\n%s\nwant=%d, got=%d", i, original, want, fused[i])
+			}
+		}
+		if string(tt.input) != string(original) {
+			t.Errorf("Fuse modified its input")
+		}
+	}
+}
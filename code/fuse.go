@@ -0,0 +1,85 @@
+package code
+
+// Superinstructions replace common sequences of instructions, so the VM dispatches once for
+// the whole sequence and can skip pushing the intermediate values. The compiler never emits
+// them; Fuse writes them into a copy of the instructions that only the VM executes.
+//
+// A superinstruction keeps the bytes of the sequence it replaces: Fuse only overwrites the
+// opcode of the first instruction, and the VM reads the operands from where the original
+// instructions had them. So the fused instructions have the same offsets as the original ones,
+// jumps and source maps stay valid, and a jump into the middle of a sequence executes the
+// original instructions from there. They are not in definitions, because their operands are
+// not laid out like the operands of a normal instruction.
+const (
+	// OpGetLocal, OpConstant, OpAdd: pushes the sum of a local variable and a constant
+	OpGetLocalConstantAdd Opcode = 0x80 + iota
+	// OpGetLocal, OpConstant, OpSub: pushes a local variable minus a constant
+	OpGetLocalConstantSub
+	// OpGetLocal, OpConstant: pushes a local variable and a constant
+	OpGetLocalConstant
+	// OpEqual, OpJumpNotTruthy: compares the top two values and jumps if they are not equal
+	OpEqualJumpNotTruthy
+	// OpNotEqual, OpJumpNotTruthy: compares the top two values and jumps if they are equal
+	OpNotEqualJumpNotTruthy
+	// OpGreaterThan, OpJumpNotTruthy: compares the top two values and jumps unless the first is greater
+	OpGreaterThanJumpNotTruthy
+)
+
+// superinstructions lists the sequences Fuse replaces. Longer sequences come first, so that
+// OpGetLocal, OpConstant, OpAdd is fused as a whole rather than as OpGetLocalConstant.
+var superinstructions = []struct {
+	sequence []Opcode
+	fused    Opcode
+}{
+	{[]Opcode{OpGetLocal, OpConstant, OpAdd}, OpGetLocalConstantAdd},
+	{[]Opcode{OpGetLocal, OpConstant, OpSub}, OpGetLocalConstantSub},
+	{[]Opcode{OpGetLocal, OpConstant}, OpGetLocalConstant},
+	{[]Opcode{OpEqual, OpJumpNotTruthy}, OpEqualJumpNotTruthy},
+	{[]Opcode{OpNotEqual, OpJumpNotTruthy}, OpNotEqualJumpNotTruthy},
+	{[]Opcode{OpGreaterThan, OpJumpNotTruthy}, OpGreaterThanJumpNotTruthy},
+}
+
+// Fuse returns a copy of ins with the sequences in superinstructions replaced by
+// superinstructions. ins itself is not modified.
+func Fuse(ins Instructions) Instructions {
+	fused := make(Instructions, len(ins))
+	copy(fused, ins)
+
+	for i := 0; i < len(ins); {
+		next := i + instructionLen(ins, i)
+		for _, s := range superinstructions {
+			if end, ok := match(ins, i, s.sequence); ok {
+				fused[i] = byte(s.fused)
+				next = end
+				break
+			}
+		}
+		i = next
+	}
+	return fused
+}
+
+// match reports whether the instructions starting at offset i are sequence, and returns the
+// offset after the last of them.
+func match(ins Instructions, i int, sequence []Opcode) (int, bool) {
+	for _, op := range sequence {
+		if i >= len(ins) || Opcode(ins[i]) != op {
+			return 0, false
+		}
+		i += instructionLen(ins, i)
+	}
+	return i, true
+}
+
+// instructionLen returns the length of the instruction at offset i including its operands.
+func instructionLen(ins Instructions, i int) int {
+	def, err := Lookup(ins[i])
+	if err != nil {
+		return 1
+	}
+	n := 1
+	for _, w := range def.OperandWidths {
+		n += w
+	}
+	return n
+}
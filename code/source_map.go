@@ -0,0 +1,24 @@
+package code
+
+import "sort"
+
+// SourcePosition records that the instructions starting at Offset were compiled from the
+// statement at Line and Column.
+type SourcePosition struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+// SourceMap maps instruction offsets back to source positions. Entries are sorted by Offset
+// and each entry covers the instructions up to the next entry.
+type SourceMap []SourcePosition
+
+// Lookup returns the position of the statement the instruction at offset belongs to.
+func (m SourceMap) Lookup(offset int) (SourcePosition, bool) {
+	i := sort.Search(len(m), func(i int) bool { return m[i].Offset > offset })
+	if i == 0 {
+		return SourcePosition{}, false
+	}
+	return m[i-1], true
+}
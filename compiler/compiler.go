@@ -5,7 +5,6 @@ import (
 	"monkey/ast"
 	"monkey/code"
 	"monkey/object"
-	"sort"
 )
 
 // Compiler has a method Compile that takes an AST node and compiles it into bytecode
@@ -26,6 +25,8 @@ type CompilationScope struct {
 	instructions        code.Instructions
 	lastInstruction     EmittedInstruction
 	previousInstruction EmittedInstruction
+	sourceMap           code.SourceMap
+	branches            code.SourceMap
 }
 
 func (c *Compiler) enterScope() {
@@ -41,14 +42,15 @@ func (c *Compiler) enterScope() {
 	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
 }
 
-func (c *Compiler) leaveScope() code.Instructions {
+func (c *Compiler) leaveScope() (code.Instructions, code.SourceMap) {
 	instructions := c.currentInstructions()
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
 	c.scopes = c.scopes[:len(c.scopes)-1]
 	c.scopeIndex--
 
 	c.symbolTable = c.symbolTable.Outer
 
-	return instructions
+	return instructions, sourceMap
 }
 
 func New() *Compiler {
@@ -83,12 +85,16 @@ func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
 type Bytecode struct {
 	Instructions code.Instructions
 	Constants    []object.Object
+	SourceMap    code.SourceMap // Maps offsets in Instructions to source lines
+	Branches     code.SourceMap // Maps offsets of OpJumpNotTruthy to the if expressions
 }
 
 func (c *Compiler) Bytecode() *Bytecode {
 	return &Bytecode{
 		Instructions: c.currentInstructions(),
 		Constants:    c.constants,
+		SourceMap:    c.scopes[c.scopeIndex].sourceMap,
+		Branches:     c.scopes[c.scopeIndex].branches,
 	}
 }
 
@@ -102,6 +108,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 			}
 		}
 	case *ast.LetStatement:
+		c.mark(node)
 		symbol := c.symbolTable.Define(node.Name.Value)
 		err := c.Compile(node.Value)
 		if err != nil {
@@ -114,12 +121,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 			c.emit(code.OpSetLocal, symbol.Index)
 		}
 	case *ast.ReturnStatement:
+		c.mark(node)
 		err := c.Compile(node.ReturnValue)
 		if err != nil {
 			return err
 		}
 		c.emit(code.OpReturnValue)
 	case *ast.ExpressionStatement:
+		c.mark(node)
 		err := c.Compile(node.Expression)
 		if err != nil {
 			return err
@@ -146,6 +155,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpCall, len(node.Arguments))
+	case *ast.Interpolation:
+		// Refer to the builtin by its index so that a user binding named str cannot shadow it
+		c.emit(code.OpGetBuiltin, object.BuiltinIndex("str"))
+
+		err := c.Compile(node.Value)
+		if err != nil {
+			return err
+		}
+
+		c.emit(code.OpCall, 1)
 	case *ast.IfExpression:
 		err := c.Compile(node.Condition)
 		if err != nil {
@@ -154,6 +173,7 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		// Emit an OpJumpNotTruthy instruction with a dummy value
 		jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+		c.markBranch(node, jumpNotTruthyPos)
 
 		err = c.Compile(node.Consequence)
 		if err != nil {
@@ -252,6 +272,25 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 
 		c.emit(code.OpIndex)
+	case *ast.SliceExpression:
+		err := c.Compile(node.Left)
+		if err != nil {
+			return err
+		}
+
+		// Omitted bounds are represented as Null so that the VM can fill in the defaults
+		for _, bound := range []ast.Expression{node.Start, node.End} {
+			if bound == nil {
+				c.emit(code.OpNull)
+				continue
+			}
+			err = c.Compile(bound)
+			if err != nil {
+				return err
+			}
+		}
+
+		c.emit(code.OpSlice)
 	case *ast.IntegerLiteral:
 		integer := &object.Integer{Value: node.Value}
 		c.emit(code.OpConstant, c.addConstant(integer))
@@ -267,16 +306,8 @@ func (c *Compiler) Compile(node ast.Node) error {
 		}
 		c.emit(code.OpArray, len(node.Elements))
 	case *ast.HashLiteral:
-		keys := []ast.Expression{}
-		for k := range node.Pairs {
-			keys = append(keys, k)
-		}
-		// To avoid the order of the keys in the hash randomly changing, sort the keys here.
-		sort.Slice(keys, func(i, j int) bool {
-			return keys[i].String() < keys[j].String()
-		})
-
-		for _, k := range keys {
+		// Keys are compiled in source order, so the hash keeps the order they were written in.
+		for _, k := range node.Keys {
 			err := c.Compile(k)
 			if err != nil {
 				return err
@@ -312,7 +343,16 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		freeSymbols := c.symbolTable.FreeSymbols
 		numLocals := c.symbolTable.numDefinitions // the number of local variables and arguments
-		instructions := c.leaveScope()
+		localNames := make([]string, numLocals)
+		for _, s := range c.symbolTable.Definitions() {
+			localNames[s.Index] = s.Name
+		}
+		freeNames := make([]string, len(freeSymbols))
+		for i, s := range freeSymbols {
+			freeNames[i] = s.Name
+		}
+		branches := c.scopes[c.scopeIndex].branches
+		instructions, sourceMap := c.leaveScope()
 
 		for _, s := range freeSymbols {
 			c.loadSymbol(s)
@@ -320,8 +360,14 @@ func (c *Compiler) Compile(node ast.Node) error {
 
 		compiledFn := &object.CompiledFunction{
 			Instructions:  instructions,
+			Fused:         code.Fuse(instructions),
 			NumLocals:     numLocals,
 			NumParameters: len(node.Parameters),
+			Name:          node.Name,
+			SourceMap:     sourceMap,
+			Branches:      branches,
+			LocalNames:    localNames,
+			FreeNames:     freeNames,
 		}
 		fnIndex := c.addConstant(compiledFn)
 		c.emit(code.OpClosure, fnIndex, len(freeSymbols))
@@ -359,6 +405,26 @@ func (c *Compiler) emit(op code.Opcode, operands ...int) int {
 	return pos
 }
 
+// mark records that the instructions emitted next belong to the statement node
+func (c *Compiler) mark(node ast.Statement) {
+	tok := ast.TokenOf(node)
+	pos := code.SourcePosition{Offset: len(c.currentInstructions()), Line: tok.Line, Column: tok.Column}
+
+	scope := &c.scopes[c.scopeIndex]
+	if n := len(scope.sourceMap); n > 0 && scope.sourceMap[n-1].Offset == pos.Offset {
+		// The previous statement emitted no instructions
+		scope.sourceMap[n-1] = pos
+		return
+	}
+	scope.sourceMap = append(scope.sourceMap, pos)
+}
+
+// markBranch records that the OpJumpNotTruthy at offset pos decides which branch of node runs
+func (c *Compiler) markBranch(node *ast.IfExpression, pos int) {
+	scope := &c.scopes[c.scopeIndex]
+	scope.branches = append(scope.branches, code.SourcePosition{Offset: pos, Line: node.Token.Line, Column: node.Token.Column})
+}
+
 func (c *Compiler) currentInstructions() code.Instructions {
 	return c.scopes[c.scopeIndex].instructions
 }
@@ -397,6 +463,13 @@ func (c *Compiler) removeLastPop() {
 
 	c.scopes[c.scopeIndex].instructions = new
 	c.scopes[c.scopeIndex].lastInstruction = previous
+
+	// Drop the source positions pointing past the end of the instructions
+	sourceMap := c.scopes[c.scopeIndex].sourceMap
+	for len(sourceMap) > 0 && sourceMap[len(sourceMap)-1].Offset >= len(new) {
+		sourceMap = sourceMap[:len(sourceMap)-1]
+	}
+	c.scopes[c.scopeIndex].sourceMap = sourceMap
 }
 
 func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
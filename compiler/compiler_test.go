@@ -7,6 +7,7 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -464,6 +465,19 @@ func TestHashLiterals(t *testing.T) {
 				code.Make(code.OpPop),
 			},
 		},
+		{
+			// The keys are compiled in source order, not sorted.
+			input:             `{"b": 1, "a": 2}`,
+			expectedConstants: []interface{}{"b", 1, "a", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpHash, 4),
+				code.Make(code.OpPop),
+			},
+		},
 	}
 	runCompilerTests(t, tests)
 }
@@ -503,6 +517,37 @@ func TestIndexExpressions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSliceExpressions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "[1, 2, 3][1:2]",
+			expectedConstants: []interface{}{1, 2, 3, 1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpArray, 3),
+				code.Make(code.OpConstant, 3),
+				code.Make(code.OpConstant, 4),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             `"monkey"[:2]`,
+			expectedConstants: []interface{}{"monkey", 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpNull),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSlice),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+	runCompilerTests(t, tests)
+}
+
 func TestFunctions(t *testing.T) {
 	tests := []compilerTestCase{
 		{
@@ -950,8 +995,139 @@ func TestRecursiveFunctions(t *testing.T) {
 	runCompilerTests(t, tests)
 }
 
+func TestSourceMap(t *testing.T) {
+	input := `let x = 1;
+x + 2;
+if (x > 0) {
+  x
+} else {
+  let f = fn(a) {
+    let b = a;
+    b
+  };
+  f(x)
+}`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	expectedLines := []int{1, 2, 3, 4, 6, 10}
+	if len(bytecode.SourceMap) != len(expectedLines) {
+		t.Fatalf("wrong source map length. want=%d, got=%d (%+v)", len(expectedLines), len(bytecode.SourceMap), bytecode.SourceMap)
+	}
+	for i, line := range expectedLines {
+		pos := bytecode.SourceMap[i]
+		if pos.Line != line {
+			t.Errorf("sourceMap[%d] wrong line. want=%d, got=%d", i, line, pos.Line)
+		}
+		if i > 0 && pos.Offset <= bytecode.SourceMap[i-1].Offset {
+			t.Errorf("sourceMap[%d] offset %d is not after previous offset", i, pos.Offset)
+		}
+		if pos.Offset >= len(bytecode.Instructions) {
+			t.Errorf("sourceMap[%d] offset %d out of range", i, pos.Offset)
+		}
+	}
+
+	var fn *object.CompiledFunction
+	for _, c := range bytecode.Constants {
+		if f, ok := c.(*object.CompiledFunction); ok {
+			fn = f
+		}
+	}
+	if fn == nil {
+		t.Fatalf("no compiled function in constants")
+	}
+	if len(fn.SourceMap) != 2 || fn.SourceMap[0].Line != 7 || fn.SourceMap[1].Line != 8 {
+		t.Errorf("wrong function source map: %+v", fn.SourceMap)
+	}
+}
+
+func TestBranches(t *testing.T) {
+	input := `if (true) { 1 };
+let f = fn(x) {
+  if (x) { 2 } else { if (x) { 3 } }
+};`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+	testBranches(t, bytecode.Instructions, bytecode.Branches, [][2]int{{1, 1}})
+
+	fn := bytecode.Constants[len(bytecode.Constants)-1].(*object.CompiledFunction)
+	testBranches(t, fn.Instructions, fn.Branches, [][2]int{{3, 3}, {3, 23}})
+}
+
+func TestDebugInfo(t *testing.T) {
+	input := `
+let outer = fn(a, b) {
+	let c = a + b;
+	let inner = fn(d) { a + c + d };
+	inner
+};
+`
+
+	compiler := New()
+	err := compiler.Compile(parse(input))
+	if err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	functions := map[string]*object.CompiledFunction{}
+	for _, c := range compiler.Bytecode().Constants {
+		if f, ok := c.(*object.CompiledFunction); ok {
+			functions[f.Name] = f
+		}
+	}
+
+	tests := []struct {
+		name       string
+		localNames []string
+		freeNames  []string
+	}{
+		{"outer", []string{"a", "b", "c", "inner"}, []string{}},
+		{"inner", []string{"d"}, []string{"a", "c"}},
+	}
+
+	for _, tt := range tests {
+		fn, ok := functions[tt.name]
+		if !ok {
+			t.Errorf("function %s not found", tt.name)
+			continue
+		}
+		if strings.Join(fn.LocalNames, ",") != strings.Join(tt.localNames, ",") {
+			t.Errorf("%s: wrong local names. want=%v, got=%v", tt.name, tt.localNames, fn.LocalNames)
+		}
+		if strings.Join(fn.FreeNames, ",") != strings.Join(tt.freeNames, ",") {
+			t.Errorf("%s: wrong free names. want=%v, got=%v", tt.name, tt.freeNames, fn.FreeNames)
+		}
+	}
+}
+
 // Test Helpers
 
+func testBranches(t *testing.T, ins code.Instructions, branches code.SourceMap, expected [][2]int) {
+	t.Helper()
+	if len(branches) != len(expected) {
+		t.Fatalf("wrong number of branches. want=%d, got=%d (%+v)", len(expected), len(branches), branches)
+	}
+	for i, pos := range branches {
+		if pos.Line != expected[i][0] || pos.Column != expected[i][1] {
+			t.Errorf("branches[%d] wrong position. want=%d:%d, got=%d:%d", i, expected[i][0], expected[i][1], pos.Line, pos.Column)
+		}
+		if code.Opcode(ins[pos.Offset]) != code.OpJumpNotTruthy {
+			t.Errorf("branches[%d] does not point to OpJumpNotTruthy", i)
+		}
+	}
+}
+
 func runCompilerTests(t *testing.T, tests []compilerTestCase) {
 	t.Helper()
 	for _, tt := range tests {
@@ -21,6 +21,7 @@ type SymbolTable struct {
 
 	store          map[string]Symbol
 	numDefinitions int
+	definitions    []Symbol // Symbols defined by Define in the order of their indexes
 
 	FreeSymbols []Symbol
 }
@@ -47,9 +48,33 @@ func (s *SymbolTable) Define(name string) Symbol {
 
 	s.store[name] = symbol
 	s.numDefinitions++
+	s.definitions = append(s.definitions, symbol)
 	return symbol
 }
 
+// Definitions returns the symbols defined by Define in the order of their indexes.
+// A name defined twice appears twice, since each definition gets its own slot.
+func (s *SymbolTable) Definitions() []Symbol {
+	return s.definitions
+}
+
+// Clone returns a copy of the table that can be defined into without affecting the original.
+// The outer table is shared, so Clone is meant for the global table, e.g. to roll back
+// a REPL input that failed to compile.
+func (s *SymbolTable) Clone() *SymbolTable {
+	store := make(map[string]Symbol, len(s.store))
+	for name, symbol := range s.store {
+		store[name] = symbol
+	}
+	return &SymbolTable{
+		Outer:          s.Outer,
+		store:          store,
+		numDefinitions: s.numDefinitions,
+		definitions:    append([]Symbol{}, s.definitions...),
+		FreeSymbols:    append([]Symbol{}, s.FreeSymbols...),
+	}
+}
+
 func (s *SymbolTable) DefineBuiltin(index int, name string) Symbol {
 	symbol := Symbol{Name: name, Index: index, Scope: BuiltinScope}
 	s.store[name] = symbol
@@ -329,3 +329,31 @@ func TestShadowingFunctionName(t *testing.T) {
 			expected.Name, expected, result)
 	}
 }
+
+func TestClone(t *testing.T) {
+	global := NewSymbolTable()
+	global.DefineBuiltin(0, "len")
+	a := global.Define("a")
+
+	clone := global.Clone()
+	clone.Define("b")
+	clone.Define("a")
+
+	if _, ok := global.Resolve("b"); ok {
+		t.Errorf("definition in the clone leaked into the original")
+	}
+	if resolved, _ := global.Resolve("a"); resolved != a {
+		t.Errorf("redefinition in the clone changed the original. got=%+v", resolved)
+	}
+	if len(global.Definitions()) != 1 || len(clone.Definitions()) != 3 {
+		t.Errorf("wrong definitions. original=%v, clone=%v", global.Definitions(), clone.Definitions())
+	}
+	if resolved, ok := clone.Resolve("len"); !ok || resolved.Scope != BuiltinScope {
+		t.Errorf("builtin is not cloned. got=%+v", resolved)
+	}
+
+	// Defining into the original does not collide with the clone's indexes
+	if c := global.Define("c"); c.Index != 1 {
+		t.Errorf("wrong index after cloning. want=1, got=%d", c.Index)
+	}
+}
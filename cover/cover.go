@@ -0,0 +1,261 @@
+// Package cover は Monkey プログラムのカバレッジを計測する。
+//
+// Profile は1つのファイルについて、文ごとの実行回数と、if 式ごとにどちらの分岐を実行したかを記録する。
+// 計測する文と if 式はファイルの構文木から決め、実行したことは VM でも評価器でも記録できる。
+// VM ではコンパイラが生成するソースマップで命令の位置を文の位置に対応させ、
+// OpJumpNotTruthy の次に実行した命令で分岐を判定する。評価器では構文木の節そのもので対応させる。
+// どちらでも prelude の中の実行は記録しない。
+package cover
+
+import (
+	"monkey/ast"
+	"monkey/code"
+	"monkey/debugger"
+	"monkey/object"
+	"monkey/token"
+	"monkey/vm"
+	"sort"
+)
+
+// Position はソースコードの位置
+type Position struct {
+	Line   int
+	Column int
+}
+
+// Branch は if 式の分岐の実行回数
+type Branch struct {
+	Position
+	HasElse    bool  // else を書いたかどうか。書いていなくても条件が偽なら else の分岐を実行したとみなす
+	Executions int64 // 条件を評価した回数
+	Then       int64
+	Else       int64
+}
+
+// Profile は1つのファイルのカバレッジ
+type Profile struct {
+	File string
+
+	statements map[Position]int64
+	branches   map[Position]*Branch
+
+	nodes  map[ast.Node]Position             // 評価器で記録する文と if 式
+	blocks map[*ast.BlockStatement]*branchOf // if 式の then と else のブロック
+}
+
+type branchOf struct {
+	branch *Branch
+	then   bool
+}
+
+// New は file の構文木 program のカバレッジを記録する Profile を返す
+func New(file string, program *ast.Program) *Profile {
+	p := &Profile{
+		File:       file,
+		statements: make(map[Position]int64),
+		branches:   make(map[Position]*Branch),
+		nodes:      make(map[ast.Node]Position),
+		blocks:     make(map[*ast.BlockStatement]*branchOf),
+	}
+
+	register := func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+			pos := position(ast.TokenOf(node))
+			p.statements[pos] = 0
+			p.nodes[node] = pos
+		case *ast.IfExpression:
+			pos := position(node.Token)
+			b := &Branch{Position: pos, HasElse: node.Alternative != nil}
+			p.branches[pos] = b
+			p.nodes[node] = pos
+			p.blocks[node.Consequence] = &branchOf{b, true}
+			if node.Alternative != nil {
+				p.blocks[node.Alternative] = &branchOf{b, false}
+			}
+		}
+		return true
+	}
+	for _, s := range program.Statements {
+		ast.Inspect(s, register)
+	}
+	return p
+}
+
+func position(tok token.Token) Position {
+	return Position{tok.Line, tok.Column}
+}
+
+// Statements は文の数と、そのうち実行した文の数を返す
+func (p *Profile) Statements() (covered, total int) {
+	for _, count := range p.statements {
+		if count > 0 {
+			covered++
+		}
+	}
+	return covered, len(p.statements)
+}
+
+// Branches は分岐の数と、そのうち実行した分岐の数を返す。if 式1つにつき分岐は2つ
+func (p *Profile) Branches() (covered, total int) {
+	for _, b := range p.branches {
+		if b.Then > 0 {
+			covered++
+		}
+		if b.Else > 0 {
+			covered++
+		}
+	}
+	return covered, 2 * len(p.branches)
+}
+
+// Line は行ごとの実行回数
+type Line struct {
+	Line  int
+	Count int64 // 行で始まる文のうち、最も多く実行した文の実行回数
+}
+
+// Lines は文が始まる行の実行回数を行の順に返す
+func (p *Profile) Lines() []Line {
+	counts := map[int]int64{}
+	for pos, count := range p.statements {
+		counts[pos.Line] = max(counts[pos.Line], count)
+	}
+
+	lines := []Line{}
+	for line, count := range counts {
+		lines = append(lines, Line{line, count})
+	}
+	sort.Slice(lines, func(i, j int) bool { return lines[i].Line < lines[j].Line })
+	return lines
+}
+
+// BranchList は if 式の分岐の実行回数を位置の順に返す
+func (p *Profile) BranchList() []Branch {
+	branches := []Branch{}
+	for _, b := range p.branches {
+		branches = append(branches, *b)
+	}
+	sort.Slice(branches, func(i, j int) bool {
+		a, b := branches[i].Position, branches[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return branches
+}
+
+// Evaluator は評価器で実行した文と分岐を記録する object.Tracer を返す
+func (p *Profile) Evaluator() *Evaluator {
+	return &Evaluator{profile: p}
+}
+
+// Evaluator は評価器で実行した文と分岐を Profile に記録する
+type Evaluator struct {
+	profile *Profile
+	ifs     []*evaluatingIf // 評価している if 式。内側が最後
+}
+
+type evaluatingIf struct {
+	branch *Branch
+	taken  bool // then か else のブロックを評価したかどうか
+}
+
+func (e *Evaluator) Enter(node ast.Node) {
+	p := e.profile
+	if block, ok := node.(*ast.BlockStatement); ok {
+		if of, ok := p.blocks[block]; ok {
+			if of.then {
+				of.branch.Then++
+			} else {
+				of.branch.Else++
+			}
+			e.ifs[len(e.ifs)-1].taken = true
+		}
+		return
+	}
+
+	pos, ok := p.nodes[node]
+	if !ok {
+		return
+	}
+	if _, ok := node.(*ast.IfExpression); ok {
+		b := p.branches[pos]
+		b.Executions++
+		e.ifs = append(e.ifs, &evaluatingIf{branch: b})
+		return
+	}
+	p.statements[pos]++
+}
+
+func (e *Evaluator) Exit(node ast.Node, result object.Object) {
+	if _, ok := node.(*ast.IfExpression); !ok {
+		return
+	}
+	if _, ok := e.profile.nodes[node]; !ok {
+		return
+	}
+
+	top := e.ifs[len(e.ifs)-1]
+	e.ifs = e.ifs[:len(e.ifs)-1]
+	// else を書いていない if 式は、条件が偽だと評価するブロックがない
+	if !top.taken && !isError(result) {
+		top.branch.Else++
+	}
+}
+
+func (e *Evaluator) Call(fn *object.Function)   {}
+func (e *Evaluator) Return(fn *object.Function) {}
+
+func isError(obj object.Object) bool {
+	_, ok := obj.(*object.Error)
+	return ok
+}
+
+// VM は VM で実行した文と分岐を記録する vm.Hook を返す。program は Profile のファイルをコンパイルしたもの
+func (p *Profile) VM(program *debugger.Program) *VM {
+	return &VM{profile: p, program: program}
+}
+
+// VM は VM で実行した文と分岐を Profile に記録する
+type VM struct {
+	profile *Profile
+	program *debugger.Program
+	branch  *Branch // 直前に実行した OpJumpNotTruthy の if 式
+	next    int     // 条件が真の場合に次に実行する命令の位置
+}
+
+func (h *VM) Before(machine *vm.VM) error {
+	frames := machine.Frames()
+	frame := frames[len(frames)-1]
+	fn, ip := frame.Closure().Fn, frame.IP()
+	if h.program.IsLibrary(fn) {
+		return nil
+	}
+
+	if b := h.branch; b != nil {
+		// OpJumpNotTruthy は関数を呼び出さないので、次の命令は同じフレームで実行する
+		b.Executions++
+		if ip == h.next {
+			b.Then++
+		} else {
+			b.Else++
+		}
+		h.branch = nil
+	}
+
+	if pos, ok := fn.SourceMap.Lookup(ip); ok && pos.Offset == ip {
+		if _, ok := h.profile.statements[Position{pos.Line, pos.Column}]; ok {
+			h.profile.statements[Position{pos.Line, pos.Column}]++
+		}
+	}
+
+	if code.Opcode(fn.Instructions[ip]) == code.OpJumpNotTruthy {
+		if pos, ok := fn.Branches.Lookup(ip); ok && pos.Offset == ip {
+			h.branch = h.profile.branches[Position{pos.Line, pos.Column}]
+			h.next = ip + 3
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package cover
+
+import (
+	"io"
+	"monkey/ast"
+	"monkey/debugger"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/stdlib"
+	"strings"
+	"testing"
+)
+
+const source = `let abs = fn(x) {
+  if (x < 0) { return -x; }
+  x
+};
+let sign = fn(x) {
+  if (x > 0) {
+    1
+  } else {
+    if (x < 0) { -1 } else { 0 }
+  }
+};
+let unused = fn() { 1 };
+puts(abs(3), sign(2), sign(-2));
+map([1, 2], fn(x) { abs(x) });`
+
+func parse(t *testing.T, src string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func runEvaluator(t *testing.T, src string) *Profile {
+	t.Helper()
+	program := parse(t, src)
+	profile := New("test.mk", program)
+
+	env := object.NewEnvironment()
+	if err := stdlib.LoadEnvironment(env); err != nil {
+		t.Fatalf("could not load prelude: %s", err)
+	}
+	env.SetTracer(profile.Evaluator())
+	env.SetOutput(io.Discard)
+	if result, ok := evaluator.Eval(program, env).(*object.Error); ok {
+		t.Fatalf("runtime error: %s", result.Message)
+	}
+	return profile
+}
+
+func runVM(t *testing.T, src string) *Profile {
+	t.Helper()
+	profile := New("test.mk", parse(t, src))
+
+	program, err := debugger.Compile(src)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	program.Output = io.Discard
+	if err := program.Run(profile.VM(program)); err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+	return profile
+}
+
+func TestCoverage(t *testing.T) {
+	engines := []struct {
+		name string
+		run  func(*testing.T, string) *Profile
+	}{
+		{"evaluator", runEvaluator},
+		{"vm", runVM},
+	}
+
+	for _, engine := range engines {
+		profile := engine.run(t, source)
+
+		lines := map[int]int64{}
+		for _, l := range profile.Lines() {
+			lines[l.Line] = l.Count
+		}
+		expectedLines := map[int]int64{
+			1: 1, 2: 3, 3: 3, 5: 1, 6: 2, 7: 1, 9: 1, 12: 1, 13: 1, 14: 2,
+		}
+		for line, count := range expectedLines {
+			if lines[line] != count {
+				t.Errorf("%s: count of line %d wrong. want=%d, got=%d", engine.name, line, count, lines[line])
+			}
+		}
+
+		covered, total := profile.Statements()
+		if covered != 12 || total != 15 {
+			t.Errorf("%s: statements wrong. want=12/15, got=%d/%d", engine.name, covered, total)
+		}
+
+		expectedBranches := []Branch{
+			{Position{2, 3}, false, 3, 0, 3},
+			{Position{6, 3}, true, 2, 1, 1},
+			{Position{9, 5}, true, 1, 1, 0},
+		}
+		branches := profile.BranchList()
+		if len(branches) != len(expectedBranches) {
+			t.Fatalf("%s: wrong number of branches. want=%d, got=%d", engine.name, len(expectedBranches), len(branches))
+		}
+		for i, want := range expectedBranches {
+			if branches[i] != want {
+				t.Errorf("%s: branch %d wrong.\nwant=%+v\ngot=%+v", engine.name, i, want, branches[i])
+			}
+		}
+
+		covered, total = profile.Branches()
+		if covered != 4 || total != 6 {
+			t.Errorf("%s: branches wrong. want=4/6, got=%d/%d", engine.name, covered, total)
+		}
+	}
+}
+
+func TestWriteLCOV(t *testing.T) {
+	profile := runVM(t, "let x = 1;\nif (x > 0) { x } else { -x };\nif (x > 5) { 1 }; if (x) { 2 }")
+
+	var out strings.Builder
+	if err := WriteLCOV(&out, []*Profile{profile}); err != nil {
+		t.Fatalf("WriteLCOV failed: %s", err)
+	}
+
+	expected := `SF:test.mk
+BRDA:2,0,0,1
+BRDA:2,0,1,0
+BRDA:3,0,0,0
+BRDA:3,0,1,1
+BRDA:3,1,0,1
+BRDA:3,1,1,0
+BRF:6
+BRH:3
+DA:1,1
+DA:2,1
+DA:3,1
+LF:3
+LH:3
+end_of_record
+`
+	if out.String() != expected {
+		t.Errorf("wrong LCOV.\nwant=%q\ngot=%q", expected, out.String())
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		covered, total int
+		expected       float64
+	}{
+		{0, 0, 100},
+		{1, 4, 25},
+		{3, 3, 100},
+	}
+
+	for _, tt := range tests {
+		if got := Percent(tt.covered, tt.total); got != tt.expected {
+			t.Errorf("Percent(%d, %d) wrong. want=%f, got=%f", tt.covered, tt.total, tt.expected, got)
+		}
+	}
+}
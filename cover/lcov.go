@@ -0,0 +1,56 @@
+package cover
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Percent は covered / total を百分率で返す。total が 0 なら 100
+func Percent(covered, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(covered) * 100 / float64(total)
+}
+
+// WriteLCOV は profiles を LCOV のトレースファイルの形式で書き出す。
+// 文が始まる行を DA に、if 式の then と else を BRDA の分岐 0 と 1 に書き出す。
+// 同じ行に if 式が複数あれば、左から順にブロック番号を振る
+func WriteLCOV(w io.Writer, profiles []*Profile) error {
+	var b strings.Builder
+	for _, p := range profiles {
+		fmt.Fprintf(&b, "SF:%s\n", p.File)
+
+		block, lastLine := 0, 0
+		for _, br := range p.BranchList() {
+			if br.Line != lastLine {
+				block, lastLine = 0, br.Line
+			}
+			for i, count := range []int64{br.Then, br.Else} {
+				taken := "-" // 条件を一度も評価していない
+				if br.Executions > 0 {
+					taken = fmt.Sprint(count)
+				}
+				fmt.Fprintf(&b, "BRDA:%d,%d,%d,%s\n", br.Line, block, i, taken)
+			}
+			block++
+		}
+		covered, total := p.Branches()
+		fmt.Fprintf(&b, "BRF:%d\nBRH:%d\n", total, covered)
+
+		hit := 0
+		lines := p.Lines()
+		for _, l := range lines {
+			fmt.Fprintf(&b, "DA:%d,%d\n", l.Line, l.Count)
+			if l.Count > 0 {
+				hit++
+			}
+		}
+		fmt.Fprintf(&b, "LF:%d\nLH:%d\n", len(lines), hit)
+		fmt.Fprintf(&b, "end_of_record\n")
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,466 @@
+// Package dap は Monkey の Debug Adapter Protocol サーバーを実装する。
+// エディタは標準入出力などのストリーム上で DAP のメッセージをやり取りして、
+// VM で実行するプログラムにブレークポイントを設定し、ステップ実行や変数の表示を行う。
+//
+// プログラムは別の goroutine で実行し、debugger.Controller が停止した位置で VM を一時停止する。
+// 停止している間は、VM を実行している goroutine が再開の指示を待っているので、
+// リクエストを処理する goroutine から VM の状態を調べられる。
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/debugger"
+	"monkey/object"
+	"monkey/vm"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// threadID は唯一のスレッドの ID。Monkey のプログラムは1つのスレッドで実行する
+const threadID = 1
+
+type Server struct {
+	in *bufio.Reader
+
+	outMu sync.Mutex // out への書き込みと seq を保護する
+	out   io.Writer
+	seq   int
+
+	path       string // launch で指定されたプログラムのパス
+	program    *debugger.Program
+	controller *debugger.Controller
+	running    bool // プログラムを実行している goroutine を起動した
+	resume     chan debugger.Action
+	quit       chan struct{} // プログラムを中断するときに閉じる
+	done       chan struct{} // プログラムの実行が終わると閉じる
+
+	// 停止中の状態。VM を実行している goroutine が停止したときに設定し、再開するときに消す
+	stateMu sync.Mutex
+	machine *vm.VM        // 停止していなければ nil
+	handles []interface{} // variablesReference - 1 から、スコープまたは配列・ハッシュへ
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:     bufio.NewReader(in),
+		out:    out,
+		resume: make(chan debugger.Action),
+		quit:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Run は disconnect リクエストを受け取るか入力が終わるまでメッセージを処理する。
+// 実行中のプログラムが puts で書き出した内容は output イベントとして送る
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			s.terminate()
+			return nil
+		}
+		if err != nil {
+			s.terminate()
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			s.terminate()
+			return fmt.Errorf("invalid message: %s", err)
+		}
+
+		if req.Command == "disconnect" {
+			s.terminate()
+			return s.respond(&req, nil)
+		}
+
+		if err := s.handle(&req); err != nil {
+			s.terminate()
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) error {
+	switch req.Command {
+	case "initialize":
+		return s.respond(req, Capabilities{
+			SupportsConfigurationDoneRequest: true,
+			SupportsEvaluateForHovers:        true,
+		})
+	case "launch":
+		return s.launch(req)
+	case "setBreakpoints":
+		return s.setBreakpoints(req)
+	case "configurationDone":
+		return s.configurationDone(req)
+	case "threads":
+		return s.respond(req, ThreadsResponseBody{Threads: []Thread{{ID: threadID, Name: "main"}}})
+	case "stackTrace":
+		return s.stackTrace(req)
+	case "scopes":
+		return s.scopes(req)
+	case "variables":
+		return s.variables(req)
+	case "evaluate":
+		return s.evaluate(req)
+	case "continue":
+		return s.continueExecution(req, debugger.Continue)
+	case "next":
+		return s.continueExecution(req, debugger.StepOver)
+	case "stepIn":
+		return s.continueExecution(req, debugger.StepIn)
+	case "stepOut":
+		return s.continueExecution(req, debugger.StepOut)
+	default:
+		return s.respondError(req, "unsupported request: %s", req.Command)
+	}
+}
+
+func (s *Server) send(v interface{}) error {
+	s.outMu.Lock()
+	defer s.outMu.Unlock()
+
+	s.seq++
+	switch v := v.(type) {
+	case *response:
+		v.Seq = s.seq
+	case *event:
+		v.Seq = s.seq
+	}
+	return writeMessage(s.out, v)
+}
+
+func (s *Server) respond(req *request, body interface{}) error {
+	return s.send(&response{Type: "response", RequestSeq: req.Seq, Success: true, Command: req.Command, Body: body})
+}
+
+func (s *Server) respondError(req *request, format string, a ...interface{}) error {
+	return s.send(&response{
+		Type:       "response",
+		RequestSeq: req.Seq,
+		Success:    false,
+		Command:    req.Command,
+		Message:    fmt.Sprintf(format, a...),
+	})
+}
+
+func (s *Server) event(name string, body interface{}) error {
+	return s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// outputWriter は書き込まれた内容を output イベントとして送る
+type outputWriter struct {
+	s *Server
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	if err := w.s.event("output", OutputEventBody{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// launch はプログラムをコンパイルする。実行は configurationDone で始める。
+// ブレークポイントを設定できるのはコンパイルした後なので、initialized イベントはここで送る
+func (s *Server) launch(req *request) error {
+	var args LaunchArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.respondError(req, "invalid arguments: %s", err)
+	}
+	if s.program != nil {
+		return s.respondError(req, "program is already launched")
+	}
+
+	src, err := os.ReadFile(args.Program)
+	if err != nil {
+		return s.respondError(req, "%s", err)
+	}
+	program, err := debugger.Compile(string(src))
+	if err != nil {
+		return s.respondError(req, "%s: %s", args.Program, err)
+	}
+
+	program.Output = &outputWriter{s: s}
+	s.path = args.Program
+	s.program = program
+	s.controller = debugger.NewController(program, s.paused)
+	s.controller.StopOnEntry = args.StopOnEntry
+
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+	return s.event("initialized", nil)
+}
+
+// setBreakpoints はプログラムのブレークポイントをすべて置き換える
+func (s *Server) setBreakpoints(req *request) error {
+	var args SetBreakpointsArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.respondError(req, "invalid arguments: %s", err)
+	}
+	if s.controller == nil {
+		return s.respondError(req, "program is not launched")
+	}
+
+	s.controller.ClearBreakpoints()
+	breakpoints := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		if s.controller.SetBreakpoint(bp.Line) {
+			breakpoints = append(breakpoints, Breakpoint{Verified: true, Line: bp.Line})
+		} else {
+			breakpoints = append(breakpoints, Breakpoint{Verified: false, Line: bp.Line, Message: "no statement at this line"})
+		}
+	}
+	return s.respond(req, SetBreakpointsResponseBody{Breakpoints: breakpoints})
+}
+
+// configurationDone はプログラムの実行を始める
+func (s *Server) configurationDone(req *request) error {
+	if s.program == nil {
+		return s.respondError(req, "program is not launched")
+	}
+	if s.running {
+		return s.respond(req, nil)
+	}
+
+	if err := s.respond(req, nil); err != nil {
+		return err
+	}
+
+	s.running = true
+	go func() {
+		defer close(s.done)
+
+		err := s.program.Run(s.controller)
+		if err == debugger.ErrTerminated {
+			return // disconnect で中断したので、クライアントはイベントを待っていない
+		}
+
+		exitCode := 0
+		if err != nil {
+			s.event("output", OutputEventBody{Category: "stderr", Output: err.Error() + "\n"})
+			exitCode = 1
+		}
+		s.event("exited", ExitedEventBody{ExitCode: exitCode})
+		s.event("terminated", nil)
+	}()
+	return nil
+}
+
+// paused は VM を実行している goroutine から呼ばれ、再開の指示を受け取るまで待つ
+func (s *Server) paused(machine *vm.VM, reason debugger.Reason, line int) (debugger.Action, error) {
+	s.stateMu.Lock()
+	s.machine = machine
+	s.handles = nil
+	s.stateMu.Unlock()
+
+	err := s.event("stopped", StoppedEventBody{Reason: string(reason), ThreadID: threadID, AllThreadsStopped: true})
+	if err != nil {
+		return debugger.Continue, err
+	}
+	select {
+	case action := <-s.resume:
+		return action, nil
+	case <-s.quit:
+		return debugger.Continue, nil // Controller が ErrTerminated を返す
+	}
+}
+
+// stopped は停止している VM を返す。実行中の場合は nil
+func (s *Server) stopped() *vm.VM {
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	return s.machine
+}
+
+func (s *Server) continueExecution(req *request, action debugger.Action) error {
+	s.stateMu.Lock()
+	machine := s.machine
+	s.machine = nil
+	s.handles = nil
+	s.stateMu.Unlock()
+
+	if machine == nil {
+		return s.respondError(req, "program is not stopped")
+	}
+
+	var err error
+	if action == debugger.Continue {
+		err = s.respond(req, ContinueResponseBody{AllThreadsContinued: true})
+	} else {
+		err = s.respond(req, nil)
+	}
+	s.resume <- action
+	return err
+}
+
+// terminate は実行中のプログラムを中断し、実行していた goroutine が終わるのを待つ
+func (s *Server) terminate() {
+	if !s.running {
+		return
+	}
+	s.controller.Terminate()
+	close(s.quit)
+	<-s.done
+	s.running = false
+}
+
+// stackTrace は内側のフレームから順に返す。フレームの ID は vm.VM.Frames のインデックス + 1
+func (s *Server) stackTrace(req *request) error {
+	machine := s.stopped()
+	if machine == nil {
+		return s.respondError(req, "program is not stopped")
+	}
+
+	frames := machine.Frames()
+	stackFrames := []StackFrame{}
+	for i := len(frames) - 1; i >= 0; i-- {
+		frame := StackFrame{ID: i + 1, Name: debugger.FrameName(frames, i)}
+		if s.program.IsLibrary(frames[i].Closure().Fn) {
+			frame.Name += " (prelude)"
+			frame.PresentationHint = "subtle"
+		} else {
+			frame.Source = &Source{Name: filepath.Base(s.path), Path: s.path}
+			frame.Line, _ = debugger.FrameLine(frames[i])
+			frame.Column = 1
+		}
+		stackFrames = append(stackFrames, frame)
+	}
+	return s.respond(req, StackTraceResponseBody{StackFrames: stackFrames, TotalFrames: len(stackFrames)})
+}
+
+// scope はスコープの variablesReference が指すもの
+type scope struct {
+	frame *vm.Frame
+	kind  string // "Locals", "Closure", "Globals"
+}
+
+// reference は v を指す variablesReference を返す
+func (s *Server) reference(v interface{}) int {
+	s.handles = append(s.handles, v)
+	return len(s.handles)
+}
+
+func frameByID(machine *vm.VM, id int) (*vm.Frame, bool) {
+	frames := machine.Frames()
+	if id < 1 || id > len(frames) {
+		return nil, false
+	}
+	return frames[id-1], true
+}
+
+func (s *Server) scopes(req *request) error {
+	var args ScopesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.respondError(req, "invalid arguments: %s", err)
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.machine == nil {
+		return s.respondError(req, "program is not stopped")
+	}
+	frame, ok := frameByID(s.machine, args.FrameID)
+	if !ok {
+		return s.respondError(req, "invalid frame id %d", args.FrameID)
+	}
+
+	scopes := []Scope{{Name: "Locals", VariablesReference: s.reference(scope{frame, "Locals"})}}
+	if len(frame.Closure().Free) > 0 {
+		scopes = append(scopes, Scope{Name: "Closure", VariablesReference: s.reference(scope{frame, "Closure"})})
+	}
+	scopes = append(scopes, Scope{Name: "Globals", VariablesReference: s.reference(scope{frame, "Globals"})})
+	return s.respond(req, ScopesResponseBody{Scopes: scopes})
+}
+
+func (s *Server) variables(req *request) error {
+	var args VariablesArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.respondError(req, "invalid arguments: %s", err)
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.machine == nil {
+		return s.respondError(req, "program is not stopped")
+	}
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.handles) {
+		return s.respondError(req, "invalid variablesReference %d", args.VariablesReference)
+	}
+
+	var entries []debugger.Variable
+	switch h := s.handles[args.VariablesReference-1].(type) {
+	case scope:
+		switch h.kind {
+		case "Locals":
+			entries = debugger.Locals(s.machine, h.frame)
+		case "Closure":
+			entries = debugger.Free(h.frame)
+		case "Globals":
+			entries = s.program.Globals(s.machine)
+		}
+	case *object.Array:
+		for i, el := range h.Elements {
+			entries = append(entries, debugger.Variable{Name: strconv.Itoa(i), Value: el})
+		}
+	case *object.Hash:
+		for _, pair := range h.Ordered() {
+			entries = append(entries, debugger.Variable{Name: debugger.Inspect(pair.Key), Value: pair.Value})
+		}
+	}
+
+	variables := []Variable{}
+	for _, e := range entries {
+		value, typ, ref := s.describe(e.Value)
+		variables = append(variables, Variable{Name: e.Name, Value: value, Type: typ, VariablesReference: ref})
+	}
+	return s.respond(req, VariablesResponseBody{Variables: variables})
+}
+
+// describe は値の表示と型を返す。要素のある配列とハッシュには展開するための variablesReference を割り当てる
+func (s *Server) describe(obj object.Object) (string, string, int) {
+	if obj == nil {
+		return debugger.Inspect(obj), "", 0
+	}
+
+	ref := 0
+	switch obj := obj.(type) {
+	case *object.Array:
+		if len(obj.Elements) > 0 {
+			ref = s.reference(obj)
+		}
+	case *object.Hash:
+		if len(obj.Pairs) > 0 {
+			ref = s.reference(obj)
+		}
+	}
+	return debugger.Inspect(obj), string(obj.Type()), ref
+}
+
+// evaluate は変数の名前だけを評価できる。エディタのホバーやウォッチ式で使う
+func (s *Server) evaluate(req *request) error {
+	var args EvaluateArguments
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		return s.respondError(req, "invalid arguments: %s", err)
+	}
+
+	s.stateMu.Lock()
+	defer s.stateMu.Unlock()
+	if s.machine == nil {
+		return s.respondError(req, "program is not stopped")
+	}
+
+	value, ok := s.program.Lookup(s.machine, args.Expression)
+	if !ok {
+		return s.respondError(req, "undefined variable %s", args.Expression)
+	}
+	result, typ, ref := s.describe(value)
+	return s.respond(req, EvaluateResponseBody{Result: result, Type: typ, VariablesReference: ref})
+}
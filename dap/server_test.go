@@ -0,0 +1,400 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const program = `let n = 10;
+let add = fn(a, b) {
+  let c = a + b;
+  c + n
+};
+let outer = fn(x) {
+  let inner = fn(y) {
+    x + y
+  };
+  add(inner(1), 2)
+};
+let r = outer(5);
+puts(r);
+let xs = [r, "s", {"k": [1]}];
+len(xs)`
+
+// message はサーバーから受け取ったレスポンスかイベント
+type message struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Command    string          `json:"command"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// client はエディタの代わりにリクエストを送り、レスポンスとイベントを読む
+type client struct {
+	t      *testing.T
+	w      *io.PipeWriter
+	r      *bufio.Reader
+	seq    int
+	events []message // まだ確認していないイベント
+	done   chan error
+}
+
+func newClient(t *testing.T) *client {
+	t.Helper()
+	serverIn, clientOut := io.Pipe()
+	clientIn, serverOut := io.Pipe()
+
+	c := &client{t: t, w: clientOut, r: bufio.NewReader(clientIn), done: make(chan error, 1)}
+	go func() {
+		err := NewServer(serverIn, serverOut).Run()
+		serverOut.Close()
+		c.done <- err
+	}()
+	return c
+}
+
+// launch はプログラムをファイルに書き、initialize と launch を送る
+func (c *client) launch(src string, stopOnEntry bool) {
+	c.t.Helper()
+	path := filepath.Join(c.t.TempDir(), "test.mk")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		c.t.Fatalf("WriteFile: %s", err)
+	}
+
+	c.request("initialize", map[string]interface{}{"adapterID": "monkey"})
+	c.request("launch", LaunchArguments{Program: path, StopOnEntry: stopOnEntry})
+	c.event("initialized")
+}
+
+func (c *client) read() message {
+	c.t.Helper()
+	body, err := readMessage(c.r)
+	if err != nil {
+		c.t.Fatalf("readMessage: %s", err)
+	}
+	var m message
+	if err := json.Unmarshal(body, &m); err != nil {
+		c.t.Fatalf("invalid message %s: %s", body, err)
+	}
+	return m
+}
+
+// send はリクエストを送り、そのレスポンスを返す。途中で受け取ったイベントは保存しておく
+func (c *client) send(command string, args interface{}) message {
+	c.t.Helper()
+	c.seq++
+	req := map[string]interface{}{"seq": c.seq, "type": "request", "command": command}
+	if args != nil {
+		req["arguments"] = args
+	}
+	if err := writeMessage(c.w, req); err != nil {
+		c.t.Fatalf("writeMessage: %s", err)
+	}
+
+	for {
+		m := c.read()
+		if m.Type == "event" {
+			c.events = append(c.events, m)
+			continue
+		}
+		if m.RequestSeq != c.seq || m.Command != command {
+			c.t.Fatalf("unexpected response %+v to %s", m, command)
+		}
+		return m
+	}
+}
+
+// request は成功するはずのリクエストを送り、レスポンスの本文を out に読み込む
+func (c *client) request(command string, args interface{}, out ...interface{}) {
+	c.t.Helper()
+	m := c.send(command, args)
+	if !m.Success {
+		c.t.Fatalf("%s failed: %s", command, m.Message)
+	}
+	for _, o := range out {
+		if err := json.Unmarshal(m.Body, o); err != nil {
+			c.t.Fatalf("%s: invalid body %s: %s", command, m.Body, err)
+		}
+	}
+}
+
+// event は名前が name のイベントを受け取るまで待ち、その本文を out に読み込む
+func (c *client) event(name string, out ...interface{}) {
+	c.t.Helper()
+	for {
+		var m message
+		if len(c.events) > 0 {
+			m, c.events = c.events[0], c.events[1:]
+		} else {
+			m = c.read()
+		}
+		if m.Type != "event" {
+			c.t.Fatalf("unexpected response %+v while waiting for %s", m, name)
+		}
+		if m.Event != name {
+			if m.Event == "output" {
+				continue
+			}
+			c.t.Fatalf("unexpected event %s while waiting for %s", m.Event, name)
+		}
+		for _, o := range out {
+			if err := json.Unmarshal(m.Body, o); err != nil {
+				c.t.Fatalf("%s: invalid body %s: %s", name, m.Body, err)
+			}
+		}
+		return
+	}
+}
+
+// stopped は stopped イベントを待ち、理由と一番内側のフレームの名前と行を返す
+func (c *client) stopped() (string, string, int) {
+	c.t.Helper()
+	var stopped StoppedEventBody
+	c.event("stopped", &stopped)
+
+	var trace StackTraceResponseBody
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID}, &trace)
+	top := trace.StackFrames[0]
+	return stopped.Reason, top.Name, top.Line
+}
+
+func (c *client) variables(ref int) map[string]Variable {
+	c.t.Helper()
+	var body VariablesResponseBody
+	c.request("variables", VariablesArguments{VariablesReference: ref}, &body)
+
+	variables := map[string]Variable{}
+	for _, v := range body.Variables {
+		variables[v.Name] = v
+	}
+	return variables
+}
+
+func (c *client) disconnect() {
+	c.t.Helper()
+	c.request("disconnect", nil)
+	select {
+	case err := <-c.done:
+		if err != nil {
+			c.t.Errorf("Run returned error: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		c.t.Fatalf("server did not stop after disconnect")
+	}
+}
+
+func TestBreakpointsAndVariables(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, false)
+
+	var breakpoints SetBreakpointsResponseBody
+	c.request("setBreakpoints", SetBreakpointsArguments{
+		Breakpoints: []SourceBreakpoint{{Line: 4}, {Line: 5}, {Line: 15}},
+	}, &breakpoints)
+	verified := []bool{}
+	for _, bp := range breakpoints.Breakpoints {
+		verified = append(verified, bp.Verified)
+	}
+	if len(verified) != 3 || !verified[0] || verified[1] || !verified[2] {
+		t.Fatalf("wrong breakpoints: %+v", breakpoints.Breakpoints)
+	}
+	c.request("configurationDone", nil)
+
+	reason, name, line := c.stopped()
+	if reason != "breakpoint" || name != "add" || line != 4 {
+		t.Fatalf("wrong stop. got reason=%s name=%s line=%d", reason, name, line)
+	}
+
+	var trace StackTraceResponseBody
+	c.request("stackTrace", map[string]interface{}{"threadId": threadID}, &trace)
+	names := []string{}
+	for _, f := range trace.StackFrames {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, " ") != "add outer main" || trace.StackFrames[1].Line != 10 {
+		t.Fatalf("wrong stack trace: %+v", trace.StackFrames)
+	}
+
+	var scopes ScopesResponseBody
+	c.request("scopes", ScopesArguments{FrameID: trace.StackFrames[0].ID}, &scopes)
+	if len(scopes.Scopes) != 2 || scopes.Scopes[0].Name != "Locals" || scopes.Scopes[1].Name != "Globals" {
+		t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+	}
+	locals := c.variables(scopes.Scopes[0].VariablesReference)
+	if locals["a"].Value != "6" || locals["b"].Value != "2" || locals["c"].Value != "8" || locals["c"].Type != "INTEGER" {
+		t.Errorf("wrong locals: %+v", locals)
+	}
+	globals := c.variables(scopes.Scopes[1].VariablesReference)
+	if globals["n"].Value != "10" || globals["r"].Value != "<unset>" || globals["add"].Value != "<fn add/2>" {
+		t.Errorf("wrong globals: %+v", globals)
+	}
+
+	var evaluated EvaluateResponseBody
+	c.request("evaluate", EvaluateArguments{Expression: "n"}, &evaluated)
+	if evaluated.Result != "10" {
+		t.Errorf("wrong evaluate result: %+v", evaluated)
+	}
+	if m := c.send("evaluate", EvaluateArguments{Expression: "nothing"}); m.Success || m.Message != "undefined variable nothing" {
+		t.Errorf("wrong evaluate error: %+v", m)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	var output OutputEventBody
+	c.event("output", &output)
+	if output.Category != "stdout" || output.Output != "18\n" {
+		t.Errorf("wrong output: %+v", output)
+	}
+
+	_, _, line = c.stopped()
+	if line != 15 {
+		t.Fatalf("wrong line. want=15, got=%d", line)
+	}
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	globals = c.variables(scopes.Scopes[len(scopes.Scopes)-1].VariablesReference)
+	xs := globals["xs"]
+	if xs.Value != `[18, s, {k: [1]}]` || xs.VariablesReference == 0 {
+		t.Fatalf("wrong xs: %+v", xs)
+	}
+	elements := c.variables(xs.VariablesReference)
+	if elements["1"].Value != `"s"` || elements["2"].VariablesReference == 0 {
+		t.Fatalf("wrong elements: %+v", elements)
+	}
+	pairs := c.variables(elements["2"].VariablesReference)
+	if pairs[`"k"`].Value != "[1]" {
+		t.Errorf("wrong pairs: %+v", pairs)
+	}
+
+	c.request("continue", map[string]interface{}{"threadId": threadID})
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 0 {
+		t.Errorf("wrong exit code: %d", exited.ExitCode)
+	}
+	c.event("terminated")
+	c.disconnect()
+}
+
+func TestStepping(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, true)
+	c.request("configurationDone", nil)
+
+	steps := []struct {
+		command string
+		reason  string
+		name    string
+		line    int
+	}{
+		{"", "entry", "main", 1},
+		{"next", "step", "main", 2},
+		{"next", "step", "main", 6},
+		{"next", "step", "main", 12},
+		{"stepIn", "step", "outer", 7},
+		{"next", "step", "outer", 10},
+		{"stepIn", "step", "inner", 8},
+		{"stepOut", "step", "outer", 10},
+		{"stepIn", "step", "add", 3},
+		{"stepOut", "step", "outer", 10},
+		{"next", "step", "main", 13},
+	}
+
+	for _, step := range steps {
+		if step.command != "" {
+			c.request(step.command, map[string]interface{}{"threadId": threadID})
+		}
+		reason, name, line := c.stopped()
+		if reason != step.reason || name != step.name || line != step.line {
+			t.Fatalf("after %q: want %s at %s:%d, got %s at %s:%d",
+				step.command, step.reason, step.name, step.line, reason, name, line)
+		}
+	}
+
+	var scopes ScopesResponseBody
+	c.request("scopes", ScopesArguments{FrameID: 1}, &scopes)
+	if len(scopes.Scopes) != 2 {
+		t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+	}
+
+	// 停止中に切断するとプログラムを中断する
+	c.disconnect()
+}
+
+func TestClosureScope(t *testing.T) {
+	c := newClient(t)
+	c.launch(program, false)
+	c.request("setBreakpoints", SetBreakpointsArguments{Breakpoints: []SourceBreakpoint{{Line: 8}}})
+	c.request("configurationDone", nil)
+
+	if _, name, _ := c.stopped(); name != "inner" {
+		t.Fatalf("stopped in %s", name)
+	}
+	var scopes ScopesResponseBody
+	c.request("scopes", ScopesArguments{FrameID: 3}, &scopes)
+	if len(scopes.Scopes) != 3 || scopes.Scopes[1].Name != "Closure" {
+		t.Fatalf("wrong scopes: %+v", scopes.Scopes)
+	}
+	free := c.variables(scopes.Scopes[1].VariablesReference)
+	if free["x"].Value != "5" {
+		t.Errorf("wrong free variables: %+v", free)
+	}
+	c.disconnect()
+}
+
+func TestErrors(t *testing.T) {
+	c := newClient(t)
+	c.request("initialize", nil)
+
+	tests := []struct {
+		command string
+		args    interface{}
+		message string
+	}{
+		{"configurationDone", nil, "program is not launched"},
+		{"setBreakpoints", SetBreakpointsArguments{}, "program is not launched"},
+		{"stackTrace", nil, "program is not stopped"},
+		{"continue", nil, "program is not stopped"},
+		{"launch", LaunchArguments{Program: filepath.Join(t.TempDir(), "missing.mk")}, ""},
+		{"restartFrame", nil, "unsupported request: restartFrame"},
+	}
+
+	for _, tt := range tests {
+		m := c.send(tt.command, tt.args)
+		if m.Success {
+			t.Errorf("%s succeeded unexpectedly", tt.command)
+			continue
+		}
+		if tt.message != "" && m.Message != tt.message {
+			t.Errorf("%s: wrong message. want=%q, got=%q", tt.command, tt.message, m.Message)
+		}
+	}
+	c.disconnect()
+}
+
+func TestRuntimeError(t *testing.T) {
+	c := newClient(t)
+	c.launch("let f = fn(x) {\n  x + \"a\"\n};\nf(1)", false)
+	c.request("configurationDone", nil)
+
+	var output OutputEventBody
+	c.event("output", &output)
+	if output.Category != "stderr" || output.Output != "runtime error at line 2: unsupported types for binary operation: INTEGER STRING\n" {
+		t.Errorf("wrong output: %+v", output)
+	}
+	var exited ExitedEventBody
+	c.event("exited", &exited)
+	if exited.ExitCode != 1 {
+		t.Errorf("wrong exit code: %d", exited.ExitCode)
+	}
+	c.event("terminated")
+	c.disconnect()
+}
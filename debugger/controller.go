@@ -0,0 +1,182 @@
+package debugger
+
+import (
+	"errors"
+	"monkey/vm"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrTerminated は Terminate で実行を中断したときに Program.Run が返すエラー
+var ErrTerminated = errors.New("terminated")
+
+// Reason は実行を止めた理由
+type Reason string
+
+const (
+	ReasonEntry      Reason = "entry"      // 最初の文
+	ReasonStep       Reason = "step"       // ステップ実行
+	ReasonBreakpoint Reason = "breakpoint" // ブレークポイント
+)
+
+// Action は停止した後に実行を再開する方法
+type Action int
+
+const (
+	Continue Action = iota // ブレークポイントまで実行する
+	StepIn                 // 次の行で停止する。呼び出した関数の中にも入る
+	StepOver               // 同じ関数か呼び出し元の次の行で停止する
+	StepOut                // 呼び出し元に戻ったところで停止する
+)
+
+// Controller は vm.Hook を実装し、ブレークポイントとステップ実行の条件を満たしたところで
+// 実行を一時停止する。停止すると Paused を呼び出し、Paused が返すまで VM は止まっている。
+// Paused の中では VM の状態を自由に調べられる。
+//
+// ブレークポイントの設定と Terminate は、VM を実行しているのとは別の goroutine から呼び出してもよい
+type Controller struct {
+	Paused      func(machine *vm.VM, reason Reason, line int) (Action, error)
+	StopOnEntry bool // 最初の文で停止する
+
+	program *Program
+
+	mu          sync.Mutex
+	breakpoints map[int]bool
+
+	terminated atomic.Bool
+
+	started bool
+	action  Action
+	depth   int // 実行を再開したときのフレームの深さ
+
+	// 直前に到達した文のフレームと行。同じ行の2つ目以降の文では停止しない
+	lastFrame *vm.Frame
+	lastLine  int
+}
+
+// NewController は program を実行する VM に接続する Controller を返す
+func NewController(program *Program, paused func(machine *vm.VM, reason Reason, line int) (Action, error)) *Controller {
+	return &Controller{
+		Paused:      paused,
+		program:     program,
+		breakpoints: make(map[int]bool),
+	}
+}
+
+// SetBreakpoint は line にブレークポイントを設定する。line で始まる文がなければ false を返す
+func (c *Controller) SetBreakpoint(line int) bool {
+	if !c.program.HasStatement(line) {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breakpoints[line] = true
+	return true
+}
+
+// ClearBreakpoint は line のブレークポイントを削除する。設定されていなければ false を返す
+func (c *Controller) ClearBreakpoint(line int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.breakpoints[line] {
+		return false
+	}
+	delete(c.breakpoints, line)
+	return true
+}
+
+// ClearBreakpoints はすべてのブレークポイントを削除する
+func (c *Controller) ClearBreakpoints() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breakpoints = make(map[int]bool)
+}
+
+// Breakpoints はブレークポイントを設定した行を昇順で返す
+func (c *Controller) Breakpoints() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	lines := []int{}
+	for line := range c.breakpoints {
+		lines = append(lines, line)
+	}
+	sort.Ints(lines)
+	return lines
+}
+
+func (c *Controller) hasBreakpoint(line int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.breakpoints[line]
+}
+
+// Terminate は実行中のプログラムを次の命令で中断する
+func (c *Controller) Terminate() {
+	c.terminated.Store(true)
+}
+
+// Before は VM が命令を実行する前に呼ばれ、停止する条件を満たしていれば Paused を呼び出す。
+// 停止するのは文の先頭の命令だけだが、StepOut では呼び出し元に戻った直後の命令で停止する
+func (c *Controller) Before(machine *vm.VM) error {
+	if c.terminated.Load() {
+		return ErrTerminated
+	}
+
+	entry := false
+	if !c.started {
+		c.started = true
+		entry = c.StopOnEntry
+	}
+
+	frames := machine.Frames()
+	frame := frames[len(frames)-1]
+	fn := frame.Closure().Fn
+	if c.program.IsLibrary(fn) {
+		return nil
+	}
+
+	pos, ok := fn.SourceMap.Lookup(frame.IP())
+	if !ok {
+		return nil
+	}
+
+	depth := len(frames)
+	atStatement := pos.Offset == frame.IP()
+	if !atStatement {
+		if c.action != StepOut || depth >= c.depth {
+			return nil
+		}
+	} else if frame == c.lastFrame && pos.Line == c.lastLine {
+		return nil
+	}
+	c.lastFrame, c.lastLine = frame, pos.Line
+
+	var reason Reason
+	switch {
+	case entry:
+		reason = ReasonEntry
+	case atStatement && c.hasBreakpoint(pos.Line):
+		reason = ReasonBreakpoint
+	case c.action == StepIn,
+		c.action == StepOver && depth <= c.depth,
+		c.action == StepOut && depth < c.depth:
+		reason = ReasonStep
+	default:
+		return nil
+	}
+
+	action, err := c.Paused(machine, reason, pos.Line)
+	if err != nil {
+		return err
+	}
+	if c.terminated.Load() {
+		return ErrTerminated
+	}
+	c.action = action
+	c.depth = depth
+	return nil
+}
@@ -0,0 +1,282 @@
+// Package debugger は VM で実行する Monkey プログラムのデバッガーを提供する。
+//
+// Controller は vm.Hook として VM に接続し、文の先頭の命令に到達するたびに停止するかどうかを決める。
+// 行番号はコンパイラが生成するソースマップから求め、ローカル変数や自由変数の名前は
+// object.CompiledFunction のデバッグ情報から、グローバル変数の名前は SymbolTable から求める。
+// prelude の関数の中では停止しない。
+//
+// Debugger は Controller を使った対話的なデバッガーで、端末から読んだコマンドで操作する。
+// Debug Adapter Protocol のサーバー (dap パッケージ) も同じ Controller を使う。
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"monkey/vm"
+	"strconv"
+	"strings"
+)
+
+const PROMPT = "(mdb) "
+
+// Debugger は1つのプログラムを端末からデバッグ実行する
+type Debugger struct {
+	in  *bufio.Scanner
+	out io.Writer
+
+	program    *Program
+	controller *Controller
+	line       int // 停止している行
+}
+
+// New は in からコマンドを読み、out に結果を書く Debugger を返す
+func New(in io.Reader, out io.Writer) *Debugger {
+	return &Debugger{
+		in:  bufio.NewScanner(in),
+		out: out,
+	}
+}
+
+// Run は src をコンパイルし、デバッガーを接続した VM で実行する。
+// 最初の文の前で停止してコマンドを待つ。実行時エラーは発生した行とともに返す
+func (d *Debugger) Run(src string) error {
+	program, err := Compile(src)
+	if err != nil {
+		return err
+	}
+
+	d.program = program
+	d.controller = NewController(program, d.paused)
+	d.controller.StopOnEntry = true
+
+	err = program.Run(d.controller)
+	if err == ErrTerminated {
+		return nil // quit コマンドで中断した
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(d.out, "program exited")
+	return nil
+}
+
+func (d *Debugger) paused(machine *vm.VM, reason Reason, line int) (Action, error) {
+	frames := machine.Frames()
+	name := FrameName(frames, len(frames)-1)
+	if reason == ReasonBreakpoint {
+		fmt.Fprintf(d.out, "breakpoint at line %d in %s\n", line, name)
+	} else {
+		fmt.Fprintf(d.out, "stopped at line %d in %s\n", line, name)
+	}
+	d.line = line
+	d.printLine(line, "=>")
+
+	return d.prompt(machine)
+}
+
+// prompt は実行を再開するコマンドを読むまでコマンドを実行する。
+// quit コマンドを読むか入力が終わると、プログラムを中断する
+func (d *Debugger) prompt(machine *vm.VM) (Action, error) {
+	for {
+		fmt.Fprint(d.out, PROMPT)
+		if !d.in.Scan() {
+			fmt.Fprintln(d.out)
+			d.controller.Terminate()
+			return Continue, nil
+		}
+
+		fields := strings.Fields(d.in.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch cmd, args := fields[0], fields[1:]; cmd {
+		case "continue", "c":
+			return Continue, nil
+		case "step", "s":
+			return StepIn, nil
+		case "next", "n":
+			return StepOver, nil
+		case "out", "o":
+			return StepOut, nil
+		case "quit", "q":
+			d.controller.Terminate()
+			return Continue, nil
+		case "break", "b":
+			d.setBreakpoint(args)
+		case "clear":
+			d.clearBreakpoint(args)
+		case "breakpoints":
+			d.printBreakpoints()
+		case "list", "l":
+			d.list()
+		case "backtrace", "bt":
+			d.backtrace(machine)
+		case "locals":
+			d.printVariables(Locals(machine, currentFrame(machine)), "no local variables")
+		case "free":
+			d.printVariables(Free(currentFrame(machine)), "no free variables")
+		case "globals":
+			d.printVariables(d.program.Globals(machine), "no global variables")
+		case "stack":
+			d.stack(machine)
+		case "print", "p":
+			d.print(machine, args)
+		case "help", "h":
+			io.WriteString(d.out, HELP)
+		default:
+			fmt.Fprintf(d.out, "unknown command %q. type help for the list of commands\n", cmd)
+		}
+	}
+}
+
+const HELP = `commands:
+  break, b <line>   set a breakpoint
+  clear <line>      delete a breakpoint
+  breakpoints       list breakpoints
+  continue, c       run until the next breakpoint
+  step, s           run to the next line, entering function calls
+  next, n           run to the next line, stepping over function calls
+  out, o            run until the current function returns
+  list, l           show the source around the current line
+  backtrace, bt     show the call stack
+  locals            show the local variables of the current function
+  free              show the free variables of the current closure
+  globals           show the global variables
+  stack             show the operand stack of the current function
+  print, p <name>   show the value of a variable
+  quit, q           stop the program
+`
+
+func (d *Debugger) lineArg(args []string) (int, bool) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.out, "expected a line number")
+		return 0, false
+	}
+	line, err := strconv.Atoi(args[0])
+	if err != nil {
+		fmt.Fprintf(d.out, "invalid line number %q\n", args[0])
+		return 0, false
+	}
+	return line, true
+}
+
+func (d *Debugger) setBreakpoint(args []string) {
+	line, ok := d.lineArg(args)
+	if !ok {
+		return
+	}
+	if !d.controller.SetBreakpoint(line) {
+		fmt.Fprintf(d.out, "no statement at line %d\n", line)
+		return
+	}
+	fmt.Fprintf(d.out, "breakpoint set at line %d\n", line)
+}
+
+func (d *Debugger) clearBreakpoint(args []string) {
+	line, ok := d.lineArg(args)
+	if !ok {
+		return
+	}
+	if !d.controller.ClearBreakpoint(line) {
+		fmt.Fprintf(d.out, "no breakpoint at line %d\n", line)
+		return
+	}
+	fmt.Fprintf(d.out, "breakpoint cleared at line %d\n", line)
+}
+
+func (d *Debugger) printBreakpoints() {
+	lines := d.controller.Breakpoints()
+	if len(lines) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints")
+		return
+	}
+	for _, line := range lines {
+		d.printLine(line, "*")
+	}
+}
+
+// list は現在の行の前後のソースコードを表示する
+func (d *Debugger) list() {
+	breakpoints := map[int]bool{}
+	for _, line := range d.controller.Breakpoints() {
+		breakpoints[line] = true
+	}
+
+	start := max(d.line-3, 1)
+	end := min(d.line+3, len(d.program.Lines))
+	for line := start; line <= end; line++ {
+		marker := ""
+		switch {
+		case line == d.line:
+			marker = "=>"
+		case breakpoints[line]:
+			marker = "*"
+		}
+		d.printLine(line, marker)
+	}
+}
+
+func (d *Debugger) printLine(line int, marker string) {
+	text := ""
+	if line >= 1 && line <= len(d.program.Lines) {
+		text = d.program.Lines[line-1]
+	}
+	fmt.Fprintf(d.out, "%2s %3d | %s\n", marker, line, text)
+}
+
+// backtrace は呼び出し中のフレームを内側から順に表示する
+func (d *Debugger) backtrace(machine *vm.VM) {
+	frames := machine.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		location := "prelude"
+		if !d.program.IsLibrary(frames[i].Closure().Fn) {
+			if line, ok := FrameLine(frames[i]); ok {
+				location = fmt.Sprintf("line %d", line)
+			}
+		}
+		fmt.Fprintf(d.out, "#%d %s at %s\n", len(frames)-1-i, FrameName(frames, i), location)
+	}
+}
+
+func (d *Debugger) printVariables(variables []Variable, empty string) {
+	if len(variables) == 0 {
+		fmt.Fprintln(d.out, empty)
+		return
+	}
+	for _, v := range variables {
+		fmt.Fprintf(d.out, "%s = %s\n", v.Name, Inspect(v.Value))
+	}
+}
+
+// stack は現在のフレームが積んだ値を、スタックの一番上から順に表示する
+func (d *Debugger) stack(machine *vm.VM) {
+	operands := machine.Operands(currentFrame(machine))
+	if len(operands) == 0 {
+		fmt.Fprintln(d.out, "stack is empty")
+		return
+	}
+	for i := len(operands) - 1; i >= 0; i-- {
+		fmt.Fprintf(d.out, "[%d] %s\n", len(operands)-1-i, Inspect(operands[i]))
+	}
+}
+
+func (d *Debugger) print(machine *vm.VM, args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(d.out, "expected a variable name")
+		return
+	}
+
+	value, ok := d.program.Lookup(machine, args[0])
+	if !ok {
+		fmt.Fprintf(d.out, "undefined variable %s\n", args[0])
+		return
+	}
+	fmt.Fprintln(d.out, Inspect(value))
+}
+
+func currentFrame(machine *vm.VM) *vm.Frame {
+	frames := machine.Frames()
+	return frames[len(frames)-1]
+}
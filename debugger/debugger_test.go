@@ -0,0 +1,147 @@
+package debugger
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const program = `let n = 10;
+let add = fn(a, b) {
+  let c = a + b;
+  c + n
+};
+let outer = fn(x) {
+  let inner = fn(y) {
+    x + y
+  };
+  add(inner(1), 2)
+};
+let r = outer(5);
+let xs = map([1, 2], fn(v) { v * n });
+r + len(xs)`
+
+func TestSession(t *testing.T) {
+	tests := []struct {
+		name     string
+		commands string
+		expected string
+	}{
+		{
+			"breakpoint and inspection",
+			"b 4\nc\nbt\nlocals\np n\nglobals\nc\n",
+			`stopped at line 1 in main
+=>   1 | let n = 10;
+(mdb) breakpoint set at line 4
+(mdb) breakpoint at line 4 in add
+=>   4 |   c + n
+(mdb) #0 add at line 4
+#1 outer at line 10
+#2 main at line 12
+(mdb) a = 6
+b = 2
+c = 8
+(mdb) 10
+(mdb) n = 10
+add = <fn add/2>
+outer = <fn outer/1>
+r = <unset>
+xs = <unset>
+(mdb) program exited
+`,
+		},
+		{
+			"step into, over and out",
+			"s\ns\ns\ns\ns\nlocals\ns\nfree\nout\nstack\nn\nn\nq\n",
+			`stopped at line 1 in main
+=>   1 | let n = 10;
+(mdb) stopped at line 2 in main
+=>   2 | let add = fn(a, b) {
+(mdb) stopped at line 6 in main
+=>   6 | let outer = fn(x) {
+(mdb) stopped at line 12 in main
+=>  12 | let r = outer(5);
+(mdb) stopped at line 7 in outer
+=>   7 |   let inner = fn(y) {
+(mdb) stopped at line 10 in outer
+=>  10 |   add(inner(1), 2)
+(mdb) x = 5
+inner = <fn inner/1>
+(mdb) stopped at line 8 in inner
+=>   8 |     x + y
+(mdb) x = 5
+(mdb) stopped at line 10 in outer
+=>  10 |   add(inner(1), 2)
+(mdb) [0] 6
+[1] <fn add/2>
+(mdb) stopped at line 13 in main
+=>  13 | let xs = map([1, 2], fn(v) { v * n });
+(mdb) stopped at line 14 in main
+=>  14 | r + len(xs)
+(mdb) `,
+		},
+		{
+			"callbacks called from the prelude",
+			"b 13\nc\nc\nbt\np v\nclear 13\nc\n",
+			`stopped at line 1 in main
+=>   1 | let n = 10;
+(mdb) breakpoint set at line 13
+(mdb) breakpoint at line 13 in main
+=>  13 | let xs = map([1, 2], fn(v) { v * n });
+(mdb) breakpoint at line 13 in fn
+=>  13 | let xs = map([1, 2], fn(v) { v * n });
+(mdb) #0 fn at line 13
+#1 fn at prelude
+#2 __reduce at prelude
+#3 __reduce at prelude
+#4 reduce at prelude
+#5 map at prelude
+#6 main at line 13
+(mdb) 1
+(mdb) breakpoint cleared at line 13
+(mdb) program exited
+`,
+		},
+		{
+			"invalid commands",
+			"b 5\nb x\nclear 3\nbreakpoints\nfoo\np nothing\nl\n",
+			`stopped at line 1 in main
+=>   1 | let n = 10;
+(mdb) no statement at line 5
+(mdb) invalid line number "x"
+(mdb) no breakpoint at line 3
+(mdb) no breakpoints
+(mdb) unknown command "foo". type help for the list of commands
+(mdb) undefined variable nothing
+(mdb) =>   1 | let n = 10;
+     2 | let add = fn(a, b) {
+     3 |   let c = a + b;
+     4 |   c + n
+(mdb) 
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		d := New(strings.NewReader(tt.commands), &out)
+		if err := d.Run(program); err != nil {
+			t.Errorf("%s: Run returned error: %s", tt.name, err)
+			continue
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: wrong output.\nwant=%q\ngot= %q", tt.name, tt.expected, out.String())
+		}
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	src := "let f = fn(x) {\n  x + \"a\"\n};\nf(1)"
+
+	var out bytes.Buffer
+	err := New(strings.NewReader("c\n"), &out).Run(src)
+	expected := "runtime error at line 2: unsupported types for binary operation: INTEGER STRING"
+	if err == nil || err.Error() != expected {
+		t.Errorf("wrong error. want=%q, got=%v", expected, err)
+	}
+}
@@ -0,0 +1,211 @@
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/stdlib"
+	"monkey/vm"
+	"strconv"
+	"strings"
+)
+
+// Program はデバッグ実行するためにコンパイルしたプログラムと、変数の名前などのデバッグ情報
+type Program struct {
+	Lines    []string // ソースコードの各行
+	Bytecode *compiler.Bytecode
+	Output   io.Writer // puts の書き出し先。nil なら標準出力
+
+	globals        []object.Object
+	symbols        *compiler.SymbolTable
+	preludeGlobals int                               // prelude が定義したグローバル変数の数
+	library        map[*object.CompiledFunction]bool // prelude の関数
+	statements     map[int]bool                      // 文が始まる行
+}
+
+// Compile は prelude を読み込んでから src をコンパイルする
+func Compile(src string) (*Program, error) {
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	prog := &Program{
+		Lines:      strings.Split(src, "\n"),
+		globals:    make([]object.Object, vm.GlobalSize),
+		symbols:    compiler.NewSymbolTable(),
+		library:    make(map[*object.CompiledFunction]bool),
+		statements: make(map[int]bool),
+	}
+	for i, v := range object.Builtins {
+		prog.symbols.DefineBuiltin(i, v.Name)
+	}
+
+	constants, err := stdlib.LoadCompiled(prog.symbols, []object.Object{}, prog.globals)
+	if err != nil {
+		return nil, err
+	}
+	prog.preludeGlobals = len(prog.symbols.Definitions())
+	for _, c := range constants {
+		if fn, ok := c.(*object.CompiledFunction); ok {
+			prog.library[fn] = true
+		}
+	}
+
+	comp := compiler.NewWithState(prog.symbols, constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, fmt.Errorf("compilation failed: %s", err)
+	}
+	prog.Bytecode = comp.Bytecode()
+
+	for _, pos := range prog.Bytecode.SourceMap {
+		prog.statements[pos.Line] = true
+	}
+	for _, c := range prog.Bytecode.Constants {
+		if fn, ok := c.(*object.CompiledFunction); ok && !prog.library[fn] {
+			for _, pos := range fn.SourceMap {
+				prog.statements[pos.Line] = true
+			}
+		}
+	}
+	return prog, nil
+}
+
+// Run はプログラムを hook を接続した VM で実行する。
+// 実行時エラーは発生した行とともに返す。hook が返した ErrTerminated はそのまま返す
+func (p *Program) Run(hook vm.Hook) error {
+	machine := vm.NewWithGlobalStore(p.Bytecode, p.globals)
+	machine.SetHook(hook)
+	machine.SetOutput(p.Output)
+
+	err := machine.Run()
+	if err == nil || err == ErrTerminated {
+		return err
+	}
+
+	frames := machine.Frames()
+	if line, ok := FrameLine(frames[len(frames)-1]); ok {
+		return fmt.Errorf("runtime error at line %d: %w", line, err)
+	}
+	return fmt.Errorf("runtime error: %w", err)
+}
+
+// IsLibrary は fn が prelude の関数かどうかを返す。prelude の関数の中では停止しない
+func (p *Program) IsLibrary(fn *object.CompiledFunction) bool {
+	return p.library[fn]
+}
+
+// HasStatement は line で文が始まるかどうかを返す
+func (p *Program) HasStatement(line int) bool {
+	return p.statements[line]
+}
+
+// Variable はデバッガーで表示する変数
+type Variable struct {
+	Name  string
+	Value object.Object // まだ代入されていない場合は nil
+}
+
+// Locals は frame のローカル変数を、引数も含めて定義した順に返す
+func Locals(machine *vm.VM, frame *vm.Frame) []Variable {
+	fn := frame.Closure().Fn
+	variables := []Variable{}
+	for i, v := range machine.Locals(frame) {
+		variables = append(variables, Variable{Name: fn.LocalNames[i], Value: v})
+	}
+	return variables
+}
+
+// Free は frame で実行しているクロージャの自由変数を返す
+func Free(frame *vm.Frame) []Variable {
+	cl := frame.Closure()
+	variables := []Variable{}
+	for i, v := range cl.Free {
+		variables = append(variables, Variable{Name: cl.Fn.FreeNames[i], Value: v})
+	}
+	return variables
+}
+
+// Globals はプログラムで定義したグローバル変数を返す。prelude の定義は含まない
+func (p *Program) Globals(machine *vm.VM) []Variable {
+	variables := []Variable{}
+	for _, s := range p.symbols.Definitions()[p.preludeGlobals:] {
+		if resolved, ok := p.symbols.Resolve(s.Name); !ok || resolved != s {
+			continue // 同じ名前で再定義された
+		}
+		variables = append(variables, Variable{Name: s.Name, Value: machine.Global(s.Index)})
+	}
+	return variables
+}
+
+// Lookup は現在のフレームから見える名前を、ローカル変数、自由変数、関数名、
+// グローバル変数の順に探して値を返す
+func (p *Program) Lookup(machine *vm.VM, name string) (object.Object, bool) {
+	frames := machine.Frames()
+	frame := frames[len(frames)-1]
+
+	locals := Locals(machine, frame)
+	for i := len(locals) - 1; i >= 0; i-- {
+		if locals[i].Name == name {
+			return locals[i].Value, true
+		}
+	}
+	for _, v := range Free(frame) {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	if cl := frame.Closure(); cl.Fn.Name == name && len(frames) > 1 {
+		return cl, true
+	}
+
+	s, ok := p.symbols.Resolve(name)
+	switch {
+	case !ok:
+		return nil, false
+	case s.Scope == compiler.BuiltinScope:
+		return object.Builtins[s.Index].Builtin, true
+	default:
+		return machine.Global(s.Index), true
+	}
+}
+
+// FrameName は i 番目のフレームで実行している関数の名前を返す。最初のフレームはプログラム本体
+func FrameName(frames []*vm.Frame, i int) string {
+	if i == 0 {
+		return "main"
+	}
+	if name := frames[i].Closure().Fn.Name; name != "" {
+		return name
+	}
+	return "fn"
+}
+
+// FrameLine はフレームが実行している命令の行番号を返す
+func FrameLine(frame *vm.Frame) (int, bool) {
+	pos, ok := frame.Closure().Fn.SourceMap.Lookup(frame.IP())
+	return pos.Line, ok
+}
+
+// Inspect はデバッガーで表示する形式で値を文字列にする
+func Inspect(obj object.Object) string {
+	switch obj := obj.(type) {
+	case nil:
+		return "<unset>"
+	case *object.String:
+		return strconv.Quote(obj.Value)
+	case *object.Closure:
+		if obj.Fn.Name != "" {
+			return fmt.Sprintf("<fn %s/%d>", obj.Fn.Name, obj.Fn.NumParameters)
+		}
+		return fmt.Sprintf("<fn/%d>", obj.Fn.NumParameters)
+	case *object.Builtin:
+		return "<builtin>"
+	default:
+		return obj.Inspect()
+	}
+}
@@ -1,9 +1,11 @@
 package evaluator
 
 import (
+	"monkey/ast"
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
 )
 
@@ -285,6 +287,61 @@ func TestStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestStringOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[6]`, nil},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[:3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[4:2]`, ""},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"monkey" != "monkey"`, false},
+		{`"a" < "b"`, true},
+		{`"abc" > "abb"`, true},
+		{`len([1, 2, 3][1:])`, 2},
+		{`[1, 2, 3][:2][1]`, 2},
+		{`trim("  monkey ")`, "monkey"},
+		{`upper("monkey")`, "MONKEY"},
+		{`contains("monkey", "key")`, true},
+		{`contains([1, "a"], "b")`, false},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`startsWith("monkey", "mon")`, true},
+		{`indexOf("monkey", "key")`, 3},
+		{`format("{} + {} = {}", 1, 2, "three")`, "1 + 2 = three"},
+		{`len("日本")`, 2},
+		{`"日本語"[1]`, "本"},
+		{`"日本語"[1:]`, "本語"},
+		{`len(chars("日本"))`, 2},
+		{`indexOf("こんにちは", "にち")`, 2},
+		{`let 挨拶 = "こんにちは"; 挨拶`, "こんにちは"},
+		{`"a\tb\n"`, "a\tb\n"},
+		{`let name = "monkey"; "hello ${name}!"`, "hello monkey!"},
+		{`"${1 + 2} ${[1, 2]} ${true}"`, "3 [1, 2] true"},
+		// str という名前の束縛は補間に影響しない
+		{`let str = fn(x) { "no" }; "a${1}"`, "a1"},
+		{`let f = fn(str) { "${str}!" }; f("x")`, "x!"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			testStringObject(t, evaluated, expected)
+		default:
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
 func TestBuiltinFunctions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -307,6 +364,39 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, nil},
 		{`push([], 1)`, []int64{1}},
 		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`len(range(3))`, 3},
+		{`range(1, 2, 0)`, "step of `range` must not be 0"},
+		{`sort([3, 1, 2])[0]`, 1},
+		{`sort([1, "a"])`, "elements of `sort` must be all INTEGER or all STRING, got STRING"},
+		{`len(join([1, 2, 3], ", "))`, 7},
+		{`len(split("a,b,c", ","))`, 3},
+		{`len(keys({"a": 1, "b": 2}))`, 2},
+		{`set({"a": 1}, "a", 2)["a"]`, 2},
+		{`set([], "a", 2)`, "argument to `set` must be HASH, got ARRAY"},
+		{`len(keys(delete({"a": 1, "b": 2}, "a")))`, 1},
+		{`entries({"a": 1, "b": 2})[1][1]`, 2},
+		{`entries(1)`, "argument to `entries` must be HASH, got INTEGER"},
+		{`if (has({[1]: 1}, [1])) { 1 } else { 0 }`, 1},
+		{`has({"a": 1}, [len])`, "unusable as hash key: ARRAY"},
+		{`len(keys(merge({"a": 1, "b": 2}, {"b": 3, "c": 4})))`, 3},
+		{`merge({"a": 1}, 1)`, "arguments to `merge` must be HASH, got HASH and INTEGER"},
+		{`fromPairs([["a", 1], ["b", 2]])["b"]`, 2},
+		{`fromPairs([1])`, "elements of `fromPairs` must be [key, value], got 1"},
+		{`mapValues({"a": 1}, fn(v) { v * 10 })["a"]`, 10},
+		{`mapValues({"a": 1}, fn(v) { v + true })`, "type mismatch: INTEGER + BOOLEAN"},
+		{`len(keys(filterValues({"a": 1, "b": 2}, fn(v) { v > 1 })))`, 1},
+		{`filterValues([], fn(v) { true })`, "argument to `filterValues` must be HASH, got ARRAY"},
+		{`assert(1 < 2); 1`, 1},
+		{`assert(1 > 2)`, "assertion failed"},
+		{`assert(1 > 2, "one is not greater")`, "assertion failed: one is not greater"},
+		{`assert(1)`, "argument to `assert` must be BOOLEAN, got INTEGER"},
+		{`assertEqual(push([1], {"a": 2}), [1, {"a": 2}]); 1`, 1},
+		{`assertEqual("a", "b")`, `got "a", want "b"`},
+		{`assertEqual([1], [2], "arrays")`, "got [1], want [2]: arrays"},
+		{`assertError(fn() { 1 + true }); 1`, 1},
+		{`assertError(fn() { len(1) }, "not supported"); 1`, 1},
+		{`assertError(fn() { 1 })`, "expected an error, got 1"},
+		{`assertError(fn() { len(1) }, "wrong")`, `error "argument to ` + "`len`" + ` not supported, got INTEGER" does not contain "wrong"`},
 	}
 
 	for _, tt := range tests {
@@ -416,6 +506,28 @@ func TestHashLiterals(t *testing.T) {
 	}
 }
 
+func TestHashInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"b": 1, "a": 2, 3: 4, true: 5}`, `{b: 1, a: 2, 3: 4, true: 5}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{a: 3, b: 2}`},
+		{`set({"b": 1, "a": 2}, "c", 3)`, `{b: 1, a: 2, c: 3}`},
+		{`delete({"c": 1, "b": 2, "a": 3}, "b")`, `{c: 1, a: 3}`},
+	}
+
+	for _, tt := range tests {
+		// Go のマップの順序は毎回変わるので、何度か評価して確かめる
+		for i := 0; i < 10; i++ {
+			if got := testEval(tt.input).Inspect(); got != tt.expected {
+				t.Fatalf("wrong Inspect for %s. want=%s, got=%s", tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
 func TestHashIndexExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -428,6 +540,11 @@ func TestHashIndexExpressions(t *testing.T) {
 		{`{5: 5}[5]`, 5},
 		{`{true: 5}[true]`, 5},
 		{`{false: 5}[false]`, 5},
+		{`{[1, "a"]: 5}[[1, "a"]]`, 5},
+		{`{[1, "a"]: 5}[["a", 1]]`, nil},
+		{`{{"x": 1, "y": 2}: 5}[{"y": 2, "x": 1}]`, 5},
+		{`let k = [[1], {"a": true}]; {k: 5}[[[1], {"a": true}]]`, 5},
+		{`{"1": 5}[1]`, nil},
 	}
 
 	for _, tt := range tests {
@@ -443,6 +560,31 @@ func TestHashIndexExpressions(t *testing.T) {
 }
 
 // helper functions
+func TestOutput(t *testing.T) {
+	var first, second strings.Builder
+	env1 := object.NewEnvironment()
+	env1.SetOutput(&first)
+	env2 := object.NewEnvironment()
+	env2.SetOutput(&second)
+
+	Eval(parser.New(lexer.New(`let say = fn(x) { puts(x) }; say("a");`)).ParseProgram(), env1)
+	Eval(parser.New(lexer.New(`puts("b", 1);`)).ParseProgram(), env2)
+	// 出力先を設定する前に作った関数も、設定した出力先に書き出す
+	var third strings.Builder
+	env1.SetOutput(&third)
+	Eval(parser.New(lexer.New(`say("c");`)).ParseProgram(), env1)
+
+	if first.String() != "a\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "a\n", first.String())
+	}
+	if second.String() != "b\n1\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "b\n1\n", second.String())
+	}
+	if third.String() != "c\n" {
+		t.Errorf("wrong output. want=%q, got=%q", "c\n", third.String())
+	}
+}
+
 func testEval(input string) object.Object {
 	l := lexer.New(input)
 	p := parser.New(l)
@@ -482,6 +624,21 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 	return true
 }
 
+func testStringObject(t *testing.T, obj object.Object, expected string) bool {
+	result, ok := obj.(*object.String)
+	if !ok {
+		t.Errorf("object is not String. got=%T (%+v)", obj, obj)
+		return false
+	}
+
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%q, want=%q", result.Value, expected)
+		return false
+	}
+
+	return true
+}
+
 func testNullObject(t *testing.T, obj object.Object) bool {
 	if obj != NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
@@ -490,3 +647,43 @@ func testNullObject(t *testing.T, obj object.Object) bool {
 
 	return true
 }
+
+type recordingTracer struct {
+	events []string
+}
+
+func (r *recordingTracer) Enter(node ast.Node) {}
+
+func (r *recordingTracer) Exit(node ast.Node, result object.Object) {
+	if _, ok := node.(*ast.InfixExpression); ok {
+		r.events = append(r.events, node.String()+" = "+result.Inspect())
+	}
+}
+
+func (r *recordingTracer) Call(fn *object.Function) {
+	r.events = append(r.events, "call "+fn.Name)
+}
+
+func (r *recordingTracer) Return(fn *object.Function) {
+	r.events = append(r.events, "return "+fn.Name)
+}
+
+func TestTracer(t *testing.T) {
+	tracer := &recordingTracer{}
+	env := object.NewEnvironment()
+	env.SetTracer(tracer)
+
+	Eval(parser.New(lexer.New("let add = fn(a, b) { a + b }; add(1, 2) * 3;")).ParseProgram(), env)
+	// 別の環境での評価は通知されない
+	testEval("let sub = fn(a, b) { a - b }; sub(1, 2);")
+
+	expected := []string{
+		"call add",
+		"(a + b) = 3",
+		"return add",
+		"(add(1, 2) * 3) = 9",
+	}
+	if strings.Join(tracer.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong events.\nwant=%q\ngot=%q", expected, tracer.events)
+	}
+}
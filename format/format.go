@@ -0,0 +1,374 @@
+// Package format は Monkey のソースコードを正規の形式に整形する。
+// 出力は安定しており、整形済みのソースを再度整形しても変化しない。
+package format
+
+import (
+	"bytes"
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// Source はソースコードを解析して整形する。コメントは保持される。
+// 構文エラーがある場合は整形せずにエラーを返す。
+func Source(src string) (string, error) {
+	l := lexer.NewWithComments(src)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return "", fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+
+	return Program(program), nil
+}
+
+// Program は AST を整形したソースコードを返す
+// program.Comments に含まれるコメントも元の位置の近くに出力する
+func Program(program *ast.Program) string {
+	pr := &printer{comments: program.Comments}
+	pr.statements(program.Statements)
+	pr.flushComments(endOfFile)
+	if pr.out.Len() > 0 {
+		pr.write("\n")
+	}
+	return pr.out.String()
+}
+
+var endOfFile = position{line: int(^uint(0) >> 1)}
+
+// position はソース中の位置。コメントとノードの前後関係を比較するために使う
+type position struct {
+	line, column int
+}
+
+func (p position) before(other position) bool {
+	return p.line < other.line || (p.line == other.line && p.column < other.column)
+}
+
+type printer struct {
+	out    bytes.Buffer
+	indent int
+
+	comments   []*ast.Comment // まだ出力していないコメント
+	lastLine   int            // 最後に出力したソースの行番号
+	blockStart bool           // '{' の直後かどうか。ブロック先頭の空行は出力しない
+}
+
+func (p *printer) write(s string) {
+	p.out.WriteString(s)
+}
+
+// 改行してインデントする
+// ソースの line 行目を出力する前に呼び、元のソースにあった空行を1行まで保持する
+func (p *printer) newlineBefore(line int) {
+	if !p.blockStart && p.lastLine > 0 && line > p.lastLine+1 {
+		p.write("\n")
+	}
+	p.newline()
+}
+
+func (p *printer) newline() {
+	p.write("\n")
+	p.write(strings.Repeat("\t", p.indent))
+	p.blockStart = false
+}
+
+// 文の並びを1行に1文ずつ出力する。元のソースの空行は1行まで保持する。
+func (p *printer) statements(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		start := startOf(stmt)
+		p.flushComments(start)
+
+		if i > 0 || p.out.Len() > 0 {
+			p.newlineBefore(start.line)
+		}
+
+		var next ast.Statement
+		if i+1 < len(stmts) {
+			next = stmts[i+1]
+		}
+		p.statement(stmt, next)
+		if last := lastLine(stmt); last > p.lastLine {
+			p.lastLine = last
+		}
+	}
+}
+
+// pos より前にあるコメントを出力する
+func (p *printer) flushComments(pos position) {
+	for len(p.comments) > 0 {
+		c := p.comments[0]
+		cpos := position{c.Token.Line, c.Token.Column}
+		if !cpos.before(pos) {
+			return
+		}
+		p.comments = p.comments[1:]
+
+		if c.Trailing && p.out.Len() > 0 && c.Token.Line <= p.lastLine {
+			p.write(" " + c.Text)
+		} else {
+			if p.out.Len() > 0 {
+				p.newlineBefore(c.Token.Line)
+			}
+			p.write(c.Text)
+		}
+
+		end := c.Token.Line + strings.Count(c.Text, "\n")
+		if end > p.lastLine {
+			p.lastLine = end
+		}
+	}
+}
+
+// pos より前にまだ出力していないコメントがあるかどうか
+func (p *printer) hasCommentsBefore(pos position) bool {
+	if len(p.comments) == 0 {
+		return false
+	}
+	c := p.comments[0]
+	return position{c.Token.Line, c.Token.Column}.before(pos)
+}
+
+// 文を出力する。next は同じ並びの次の文で、なければ nil
+func (p *printer) statement(stmt ast.Statement, next ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		p.write("let ")
+		p.identifier(stmt.Name)
+		p.write(" = ")
+		p.expression(stmt.Value, parser.LOWEST)
+		p.write(";")
+	case *ast.ReturnStatement:
+		p.write("return")
+		if stmt.ReturnValue != nil {
+			p.write(" ")
+			p.expression(stmt.ReturnValue, parser.LOWEST)
+		}
+		p.write(";")
+	case *ast.ExpressionStatement:
+		p.expression(stmt.Expression, parser.LOWEST)
+		// ブロックで終わる式文の ';' は、次の文と続けて読まれてしまう場合だけ出力する
+		// 例: "fn(x) { x }; [1, 2];" の ';' を省くと添字式になる
+		if !endsWithBlock(stmt.Expression) || continuesExpression(next) {
+			p.write(";")
+		}
+	case *ast.BlockStatement:
+		p.block(stmt)
+	}
+}
+
+// 式を出力する。式の優先順位が precedence より低い場合は括弧で囲む
+func (p *printer) expression(exp ast.Expression, precedence int) {
+	if isTemplate(exp) {
+		p.write(`"` + templateToken(exp).Literal + `"`)
+		return
+	}
+
+	switch exp := exp.(type) {
+	case *ast.Identifier:
+		p.write(exp.Value)
+	case *ast.IntegerLiteral:
+		p.write(exp.Token.Literal)
+	case *ast.Boolean:
+		p.write(exp.Token.Literal)
+	case *ast.StringLiteral:
+		p.stringLiteral(exp)
+	case *ast.PrefixExpression:
+		if precedence > parser.PREFIX {
+			p.write("(")
+			defer p.write(")")
+		}
+		p.write(exp.Operator)
+		if prefix, ok := exp.Right.(*ast.PrefixExpression); ok && prefix.Operator == exp.Operator && exp.Operator == "-" {
+			p.write(" ") // "--x" ではなく "- -x"
+		}
+		p.expression(exp.Right, parser.PREFIX)
+	case *ast.InfixExpression:
+		prec := parser.Precedence(exp.Token.Type)
+		if prec == parser.LOWEST {
+			prec = parser.Precedence(tokenTypeOf(exp.Operator))
+		}
+		if prec < precedence {
+			p.write("(")
+			defer p.write(")")
+		}
+		p.expression(exp.Left, prec)
+		p.write(" " + exp.Operator + " ")
+		p.expression(exp.Right, prec+1) // 左結合なので右辺の同じ優先順位には括弧が必要
+	case *ast.IfExpression:
+		p.write("if (")
+		p.expression(exp.Condition, parser.LOWEST)
+		p.write(") ")
+		p.block(exp.Consequence)
+		if exp.Alternative != nil {
+			p.write(" else ")
+			p.block(exp.Alternative)
+		}
+	case *ast.FunctionLiteral:
+		p.write("fn(")
+		for i, param := range exp.Parameters {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.identifier(param)
+		}
+		p.write(") ")
+		if exp.ReturnType != nil {
+			p.write("-> " + exp.ReturnType.String() + " ")
+		}
+		p.block(exp.Body)
+	case *ast.CallExpression:
+		p.expression(exp.Function, parser.CALL)
+		p.write("(")
+		p.expressionList(exp.Arguments)
+		p.write(")")
+	case *ast.ArrayLiteral:
+		p.write("[")
+		p.expressionList(exp.Elements)
+		p.write("]")
+	case *ast.IndexExpression:
+		p.expression(exp.Left, parser.INDEX)
+		p.write("[")
+		p.expression(exp.Index, parser.LOWEST)
+		p.write("]")
+	case *ast.SliceExpression:
+		p.expression(exp.Left, parser.INDEX)
+		p.write("[")
+		if exp.Start != nil {
+			p.expression(exp.Start, parser.LOWEST)
+		}
+		p.write(":")
+		if exp.End != nil {
+			p.expression(exp.End, parser.LOWEST)
+		}
+		p.write("]")
+	case *ast.HashLiteral:
+		p.write("{")
+		for i, key := range exp.Keys {
+			if i > 0 {
+				p.write(", ")
+			}
+			p.expression(key, parser.LOWEST)
+			p.write(": ")
+			p.expression(exp.Pairs[key], parser.LOWEST)
+		}
+		p.write("}")
+	}
+}
+
+// 変数名や引数名を、型注釈があれば "名前: 型" の形で出力する
+func (p *printer) identifier(ident *ast.Identifier) {
+	p.write(ident.Value)
+	if ident.Type != nil {
+		p.write(": " + ident.Type.String())
+	}
+}
+
+func (p *printer) expressionList(exps []ast.Expression) {
+	for i, exp := range exps {
+		if i > 0 {
+			p.write(", ")
+		}
+		p.expression(exp, parser.LOWEST)
+	}
+}
+
+// ブロックを出力する
+// 元のソースで1行に書かれた、入れ子のブロックを含まない1文だけのブロックは1行のまま出力する
+func (p *printer) block(block *ast.BlockStatement) {
+	end := position{block.Rbrace.Line, block.Rbrace.Column}
+
+	if len(block.Statements) == 0 && !p.hasCommentsBefore(end) {
+		p.write("{}")
+		return
+	}
+
+	// { /* コメントだけの1行のブロック */ }
+	if len(block.Statements) == 0 && block.Token.Line == block.Rbrace.Line {
+		p.write("{")
+		for p.hasCommentsBefore(end) {
+			p.write(" " + p.comments[0].Text)
+			p.comments = p.comments[1:]
+		}
+		p.write(" }")
+		return
+	}
+
+	if p.isOneLiner(block) {
+		p.write("{ ")
+		switch stmt := block.Statements[0].(type) {
+		case *ast.ExpressionStatement:
+			p.expression(stmt.Expression, parser.LOWEST)
+		default:
+			p.statement(stmt, nil)
+		}
+		p.write(" }")
+		return
+	}
+
+	p.write("{")
+	p.indent++
+	p.blockStart = true
+	if block.Token.Line > p.lastLine {
+		p.lastLine = block.Token.Line
+	}
+	p.statements(block.Statements)
+	p.flushComments(end)
+	p.indent--
+	p.newline()
+	p.write("}")
+	if end.line > p.lastLine {
+		p.lastLine = end.line
+	}
+}
+
+func (p *printer) isOneLiner(block *ast.BlockStatement) bool {
+	if len(block.Statements) != 1 || block.Token.Line != block.Rbrace.Line {
+		return false
+	}
+	if p.hasCommentsBefore(position{block.Rbrace.Line, block.Rbrace.Column}) {
+		return false
+	}
+	return !containsBlock(block.Statements[0])
+}
+
+func (p *printer) stringLiteral(sl *ast.StringLiteral) {
+	if sl.Token.Type == token.RAW_STRING && !strings.Contains(sl.Value, "`") {
+		p.write("`" + sl.Value + "`")
+		return
+	}
+	p.write(quote(sl.Value))
+}
+
+// quote は文字列を、再び字句解析すると同じ値になる文字列リテラルに変換する
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteString(`"`)
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case r == '"':
+			out.WriteString(`\"`)
+		case r == '\\':
+			out.WriteString(`\\`)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '{':
+			out.WriteString(`\$`)
+		case r < ' ' || r == 0x7f:
+			fmt.Fprintf(&out, `\u{%X}`, r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteString(`"`)
+	return out.String()
+}
@@ -0,0 +1,168 @@
+package format
+
+import (
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestSource(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x=1", "let x = 1;\n"},
+		{"1+2*3", "1 + 2 * 3;\n"},
+		{"(1+2)*3", "(1 + 2) * 3;\n"},
+		{"a-(b-c)", "a - (b - c);\n"},
+		{"(a-b)-c", "a - b - c;\n"},
+		{"-(a+b)", "-(a + b);\n"},
+		{"!(a == b)", "!(a == b);\n"},
+		{"(a+b)(1)", "(a + b)(1);\n"},
+		{"(a+b)[0]", "(a + b)[0];\n"},
+		{"a<b==true", "a < b == true;\n"},
+		{"return   x", "return x;\n"},
+		{"[1,2,3][1:]", "[1, 2, 3][1:];\n"},
+		{`{"b":1,"a":2}`, "{\"b\": 1, \"a\": 2};\n"},
+		{"if(x){1}else{2}", "if (x) { 1 } else { 2 }\n"},
+		{"if (x) {\n1\n}", "if (x) {\n\t1;\n}\n"},
+		{"let f = fn(x) { x }", "let f = fn(x) { x };\n"},
+		{"let f = fn(x, y) {\nlet z = x + y;\nz\n}", "let f = fn(x, y) {\n\tlet z = x + y;\n\tz;\n};\n"},
+		{"let f = fn() { if (x) { 1 } }", "let f = fn() {\n\tif (x) { 1 }\n};\n"},
+		{"fn(){}", "fn() {}\n"},
+		{`"a\tb\"c\\"`, `"a\tb\"c\\";` + "\n"},
+		{"`raw\\n`", "`raw\\n`;\n"},
+		{`"x = ${x + 1}!"`, `"x = ${x + 1}!";` + "\n"},
+		{"let a = 1;\n\n\n\nlet b = 2;", "let a = 1;\n\nlet b = 2;\n"},
+		{"let x:int=5", "let x: int = 5;\n"},
+		{"let h :{ string:[int] } = {}", "let h: {string: [int]} = {};\n"},
+		{"let f = fn(a:string,b)->fn(int)->bool{ a }", "let f = fn(a: string, b) -> fn(int) -> bool { a };\n"},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		if actual != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSourceComments(t *testing.T) {
+	input := `// header
+
+let add = fn(a, b) { a + b };   // trailing
+let f = fn(x) {
+    // inside
+    x /* inline */ + 1
+    // before brace
+};
+if (true) { 1 } else { /* nothing */ }
+/* end */`
+
+	expected := `// header
+
+let add = fn(a, b) { a + b }; // trailing
+let f = fn(x) {
+	// inside
+	x + 1; /* inline */
+	// before brace
+};
+if (true) { 1 } else { /* nothing */ }
+/* end */
+`
+
+	actual, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+
+	if actual != expected {
+		t.Errorf("Source wrong.\nwant=%q\ngot= %q", expected, actual)
+	}
+}
+
+func TestSourceIsIdempotent(t *testing.T) {
+	inputs := []string{
+		"let fib = fn(x) { if (x < 2) { return x; } fib(x - 1) + fib(x - 2) }; fib(10)",
+		"// c1\nlet a = [1, 2, {\"k\": fn(x) { x }}]; // c2\n\n/* c3 */\nputs(\"${a[0]} ${-a[1]}\")",
+		"let m = fn(arr, f) {\n  let iter = fn(arr, acc) {\n    if (len(arr) == 0) { acc } else { iter(rest(arr), push(acc, f(first(arr)))) }\n  };\n  iter(arr, [])\n};",
+	}
+
+	for _, input := range inputs {
+		first, err := Source(input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", input, err)
+		}
+
+		second, err := Source(first)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", first, err)
+		}
+
+		if first != second {
+			t.Errorf("Source is not idempotent.\nfirst= %q\nsecond=%q", first, second)
+		}
+
+		// 整形しても意味が変わらないこと
+		if parse(t, input) != parse(t, first) {
+			t.Errorf("formatted program differs.\nwant=%q\ngot= %q", parse(t, input), parse(t, first))
+		}
+	}
+}
+
+func TestSourceKeepsStatementsApart(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(x) { x }; [1, 2];", "fn(x) { x };\n[1, 2];\n"},
+		{"fn(x) { x }; (1 + 2) * 3;", "fn(x) { x };\n(1 + 2) * 3;\n"},
+		{"if (c) { a }; -1;", "if (c) { a };\n-1;\n"},
+		{"if (c) { a } else { b }; [1][0];", "if (c) { a } else { b };\n[1][0];\n"},
+		{"let f = fn() {\nif (c) { a };\n-1\n};", "let f = fn() {\n\tif (c) { a };\n\t-1;\n};\n"},
+		// 次の文と続けて読まれない場合は ';' を付けない
+		{"if (c) { a }; !b; fn() {}; let x = 1;", "if (c) { a }\n!b;\nfn() {}\nlet x = 1;\n"},
+	}
+
+	for _, tt := range tests {
+		actual, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		if actual != tt.expected {
+			t.Errorf("Source(%q) wrong.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+
+		// 整形しても文の区切りと意味が変わらないこと
+		if parse(t, tt.input) != parse(t, actual) {
+			t.Errorf("formatted program differs.\nwant=%q\ngot= %q", parse(t, tt.input), parse(t, actual))
+		}
+		want := parser.New(lexer.New(tt.input)).ParseProgram().Statements
+		got := parser.New(lexer.New(actual)).ParseProgram().Statements
+		if len(want) != len(got) {
+			t.Errorf("formatted program has wrong number of statements. want=%d, got=%d", len(want), len(got))
+		}
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	_, err := Source("let = 1;")
+	if err == nil {
+		t.Fatalf("expected an error, got nil")
+	}
+}
+
+func parse(t *testing.T, input string) string {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program.String()
+}
@@ -0,0 +1,119 @@
+package format
+
+import (
+	"monkey/ast"
+	"monkey/parser"
+	"monkey/token"
+	"strings"
+)
+
+// startOf はノードの先頭の位置を返す
+func startOf(node ast.Node) position {
+	switch node := node.(type) {
+	case *ast.ExpressionStatement:
+		if node.Expression != nil {
+			return startOf(node.Expression)
+		}
+		return position{node.Token.Line, node.Token.Column}
+	case *ast.InfixExpression:
+		if isTemplate(node) {
+			return position{node.Token.Line, node.Token.Column}
+		}
+		return startOf(node.Left)
+	case *ast.CallExpression:
+		return startOf(node.Function)
+	case *ast.IndexExpression:
+		return startOf(node.Left)
+	case *ast.SliceExpression:
+		return startOf(node.Left)
+	}
+
+	tok := ast.TokenOf(node)
+	return position{tok.Line, tok.Column}
+}
+
+// lastLine はノードに含まれるトークンの最大の行番号を返す
+func lastLine(node ast.Node) int {
+	last := 0
+	ast.Inspect(node, func(n ast.Node) bool {
+		tok := ast.TokenOf(n)
+		line := tok.Line
+		if tok.Type == token.STRING || tok.Type == token.RAW_STRING || tok.Type == token.TEMPLATE {
+			line += countNewlines(tok.Literal)
+		}
+		if block, ok := n.(*ast.BlockStatement); ok && block.Rbrace.Line > line {
+			line = block.Rbrace.Line
+		}
+		if line > last {
+			last = line
+		}
+		return true
+	})
+	return last
+}
+
+func countNewlines(s string) int {
+	n := 0
+	for _, r := range s {
+		if r == '\n' {
+			n++
+		}
+	}
+	return n
+}
+
+// containsBlock はノードがブロックを含むかどうかを返す
+func containsBlock(node ast.Node) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if _, ok := n.(*ast.BlockStatement); ok {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// endsWithBlock は式がブロックで終わるかどうかを返す。そのような式文には通常 ';' を付けない
+func endsWithBlock(exp ast.Expression) bool {
+	switch exp.(type) {
+	case *ast.IfExpression:
+		return true
+	case *ast.FunctionLiteral:
+		return true
+	}
+	return false
+}
+
+// continuesExpression は文が '(', '[', '-' で始まるかどうかを返す。
+// ブロックで終わる式の直後にこのような文があると、';' がなければ呼び出し、添字、減算として
+// 前の式に続けて解析される
+func continuesExpression(stmt ast.Statement) bool {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok {
+		return false
+	}
+	p := &printer{}
+	p.expression(es.Expression, parser.LOWEST)
+	out := p.out.String()
+	return strings.HasPrefix(out, "(") || strings.HasPrefix(out, "[") || strings.HasPrefix(out, "-")
+}
+
+// isTemplate は文字列補間を脱糖したノードかどうかを返す
+func isTemplate(exp ast.Expression) bool {
+	return templateToken(exp).Type == token.TEMPLATE
+}
+
+func templateToken(exp ast.Expression) token.Token {
+	switch exp := exp.(type) {
+	case *ast.InfixExpression:
+		return exp.Token
+	case *ast.Interpolation:
+		return exp.Token
+	}
+	return token.Token{}
+}
+
+func tokenTypeOf(operator string) token.TokenType {
+	return token.TokenType(operator)
+}
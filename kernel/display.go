@@ -0,0 +1,147 @@
+package kernel
+
+import (
+	"html"
+	"monkey/object"
+	"strconv"
+	"strings"
+)
+
+// Display は値の表示形式を MIME タイプごとに返す。
+// すべての値は text/plain で表示し、配列とハッシュは text/html の表でも表示する
+func Display(obj object.Object) map[string]string {
+	data := map[string]string{"text/plain": obj.Inspect()}
+	if table := tableOf(obj); table != nil {
+		data["text/html"] = table.html()
+	}
+	return data
+}
+
+// table は HTML の表にする値の行と列
+type table struct {
+	columns []string
+	rows    [][]object.Object // 値のないセルは nil
+	labels  []string          // 行の見出し
+}
+
+// tableOf は値を表にする。
+//   - ハッシュはキーと値の2列
+//   - 文字列をキーとするハッシュの配列は、キーを列とし要素を行とする
+//   - 配列の配列は、内側の配列の要素を列とする
+//   - それ以外の配列は値の1列
+//
+// 表にしない値には nil を返す
+func tableOf(obj object.Object) *table {
+	switch obj := obj.(type) {
+	case *object.Hash:
+		t := &table{columns: []string{"key", "value"}}
+		for _, pair := range obj.Ordered() {
+			t.rows = append(t.rows, []object.Object{pair.Key, pair.Value})
+		}
+		return t
+	case *object.Array:
+		if t := recordTable(obj); t != nil {
+			return t
+		}
+		if t := matrixTable(obj); t != nil {
+			return t
+		}
+		t := &table{columns: []string{"value"}}
+		for i, e := range obj.Elements {
+			t.labels = append(t.labels, strconv.Itoa(i))
+			t.rows = append(t.rows, []object.Object{e})
+		}
+		return t
+	}
+	return nil
+}
+
+// recordTable は文字列をキーとするハッシュの配列を表にする。列はキーが最初に現れた順に並べる
+func recordTable(array *object.Array) *table {
+	if len(array.Elements) == 0 {
+		return nil
+	}
+	t := &table{}
+	index := map[string]int{}
+	for _, e := range array.Elements {
+		hash, ok := e.(*object.Hash)
+		if !ok {
+			return nil
+		}
+		for _, pair := range hash.Ordered() {
+			key, ok := pair.Key.(*object.String)
+			if !ok {
+				return nil
+			}
+			if _, ok := index[key.Value]; !ok {
+				index[key.Value] = len(t.columns)
+				t.columns = append(t.columns, key.Value)
+			}
+		}
+	}
+
+	for i, e := range array.Elements {
+		row := make([]object.Object, len(t.columns))
+		for _, pair := range e.(*object.Hash).Pairs {
+			row[index[pair.Key.(*object.String).Value]] = pair.Value
+		}
+		t.labels = append(t.labels, strconv.Itoa(i))
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+// matrixTable は配列の配列を表にする。列の数は最も長い配列に合わせる
+func matrixTable(array *object.Array) *table {
+	if len(array.Elements) == 0 {
+		return nil
+	}
+	t := &table{}
+	width := 0
+	for _, e := range array.Elements {
+		inner, ok := e.(*object.Array)
+		if !ok {
+			return nil
+		}
+		width = max(width, len(inner.Elements))
+	}
+	for i := 0; i < width; i++ {
+		t.columns = append(t.columns, strconv.Itoa(i))
+	}
+	for i, e := range array.Elements {
+		row := make([]object.Object, width)
+		copy(row, e.(*object.Array).Elements)
+		t.labels = append(t.labels, strconv.Itoa(i))
+		t.rows = append(t.rows, row)
+	}
+	return t
+}
+
+func (t *table) html() string {
+	var b strings.Builder
+	b.WriteString("<table>\n<thead><tr>")
+	if t.labels != nil {
+		b.WriteString("<th></th>")
+	}
+	for _, column := range t.columns {
+		b.WriteString("<th>" + html.EscapeString(column) + "</th>")
+	}
+	b.WriteString("</tr></thead>\n<tbody>\n")
+
+	for i, row := range t.rows {
+		b.WriteString("<tr>")
+		if t.labels != nil {
+			b.WriteString("<th>" + t.labels[i] + "</th>")
+		}
+		for _, cell := range row {
+			text := ""
+			if cell != nil {
+				text = cell.Inspect()
+			}
+			b.WriteString("<td>" + html.EscapeString(text) + "</td>")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>")
+	return b.String()
+}
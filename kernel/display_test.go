@@ -0,0 +1,62 @@
+package kernel
+
+import (
+	"monkey/object"
+	"strings"
+	"testing"
+)
+
+func TestDisplay(t *testing.T) {
+	str := func(s string) object.Object { return &object.String{Value: s} }
+	integer := func(i int64) object.Object { return &object.Integer{Value: i} }
+	hash := func(pairs ...object.Object) *object.Hash {
+		h := object.NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, _ := object.HashKeyOf(pairs[i])
+			h.Set(key, object.HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	array := func(elements ...object.Object) *object.Array { return &object.Array{Elements: elements} }
+
+	tests := []struct {
+		name     string
+		obj      object.Object
+		expected string // text/html の tbody。表にしない場合は空
+	}{
+		{"integer", integer(1), ""},
+		{"string", str("<b>"), ""},
+		{"array", array(integer(1), str("<b>")),
+			"<tr><th>0</th><td>1</td></tr>\n<tr><th>1</th><td>&lt;b&gt;</td></tr>\n"},
+		{"hash", hash(str("b"), integer(2), str("a"), integer(1)),
+			"<tr><td>b</td><td>2</td></tr>\n<tr><td>a</td><td>1</td></tr>\n"},
+		{"records", array(hash(str("name"), str("x"), str("age"), integer(1)), hash(str("name"), str("y"), str("id"), integer(7))),
+			"<tr><th>0</th><td>x</td><td>1</td><td></td></tr>\n<tr><th>1</th><td>y</td><td></td><td>7</td></tr>\n"},
+		{"matrix", array(array(integer(1), integer(2)), array(integer(3))),
+			"<tr><th>0</th><td>1</td><td>2</td></tr>\n<tr><th>1</th><td>3</td><td></td></tr>\n"},
+		{"non-string keys", array(hash(integer(1), integer(2))),
+			"<tr><th>0</th><td>{1: 2}</td></tr>\n"},
+		{"empty array", array(), ""},
+	}
+
+	for _, tt := range tests {
+		data := Display(tt.obj)
+		if data["text/plain"] != tt.obj.Inspect() {
+			t.Errorf("%s: wrong text/plain. got=%q", tt.name, data["text/plain"])
+		}
+
+		got := data["text/html"]
+		if start := strings.Index(got, "<tbody>\n"); start >= 0 {
+			got = strings.TrimSuffix(got[start+len("<tbody>\n"):], "</tbody>\n</table>")
+		}
+		if got != tt.expected {
+			t.Errorf("%s: wrong table.\nwant=%q\ngot= %q", tt.name, tt.expected, got)
+		}
+	}
+
+	// 列の見出しは最初に現れた順のキー
+	html := Display(array(hash(str("name"), str("x"), str("age"), integer(1)), hash(str("id"), integer(7))))["text/html"]
+	if !strings.Contains(html, "<thead><tr><th></th><th>name</th><th>age</th><th>id</th></tr></thead>") {
+		t.Errorf("wrong header: %s", html)
+	}
+}
@@ -0,0 +1,282 @@
+// Package kernel は Monkey の Jupyter カーネルを実装する。
+//
+// ZeroMQ のソケットの代わりに、カーネルゲートウェイなどが使う JSON over stdio の形式でメッセージをやり取りする。
+// 入力の1行が1つのメッセージで、送るメッセージも1行に1つずつ書き出す。
+// ZeroMQ ではソケットで区別するチャネルは、メッセージの channel に書く。
+//
+// セルは repl.Interpreter で実行するので、REPL と同じくグローバル変数と定数はセルをまたいで保持され、
+// 失敗したセルは状態を変えない。
+package kernel
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/repl"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Kernel は Jupyter のリクエストを処理する
+type Kernel struct {
+	in          *bufio.Reader
+	out         *json.Encoder
+	interpreter *repl.Interpreter
+
+	executionCount int
+	parent         *Message // 処理中のリクエスト
+}
+
+// New は prelude を読み込んだ状態のカーネルを返す
+func New(in io.Reader, out io.Writer) (*Kernel, error) {
+	interpreter, err := repl.NewInterpreter()
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(out)
+	enc.SetEscapeHTML(false)
+	return &Kernel{in: bufio.NewReader(in), out: enc, interpreter: interpreter}, nil
+}
+
+// Run は shutdown_request を受け取るか入力が終わるまでメッセージを処理する
+func (k *Kernel) Run() error {
+	for {
+		line, err := k.in.ReadBytes('\n')
+		if err == io.EOF && len(strings.TrimSpace(string(line))) == 0 {
+			return nil
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var msg Message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			return fmt.Errorf("invalid message: %s", err)
+		}
+		stop, err := k.handle(&msg)
+		if err != nil || stop {
+			return err
+		}
+	}
+}
+
+// handle はリクエストを処理する。処理している間は iopub で busy 状態を知らせる。
+// 知らないリクエストには応答しない
+func (k *Kernel) handle(msg *Message) (stop bool, err error) {
+	k.parent = msg
+	if err := k.publish("status", status{ExecutionState: "busy"}); err != nil {
+		return false, err
+	}
+
+	switch msg.Header.MsgType {
+	case "kernel_info_request":
+		err = k.reply(k.kernelInfo())
+	case "execute_request":
+		err = k.execute()
+	case "complete_request":
+		err = k.complete()
+	case "is_complete_request":
+		err = k.isComplete()
+	case "shutdown_request":
+		var req shutdownRequest
+		if err := json.Unmarshal(msg.Content, &req); err != nil {
+			return false, err
+		}
+		stop = true
+		err = k.reply(shutdownReply{Status: "ok", Restart: req.Restart})
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return stop, k.publish("status", status{ExecutionState: "idle"})
+}
+
+func (k *Kernel) kernelInfo() kernelInfoReply {
+	return kernelInfoReply{
+		Status:                "ok",
+		ProtocolVersion:       ProtocolVersion,
+		Implementation:        "monkey",
+		ImplementationVersion: "1.0",
+		LanguageInfo: languageInfo{
+			Name:          "monkey",
+			Version:       "1.0",
+			MimeType:      "text/x-monkey",
+			FileExtension: ".mk",
+		},
+		Banner: "Monkey",
+	}
+}
+
+// execute はセルを実行する。puts の出力は stdout のストリームとして、最後の式の値は execute_result として送る
+func (k *Kernel) execute() error {
+	var req executeRequest
+	if err := json.Unmarshal(k.parent.Content, &req); err != nil {
+		return err
+	}
+	if req.StoreHistory == nil || *req.StoreHistory {
+		k.executionCount++
+	}
+	if !req.Silent {
+		if err := k.publish("execute_input", executeInput{Code: req.Code, ExecutionCount: k.executionCount}); err != nil {
+			return err
+		}
+	}
+
+	var output strings.Builder
+	result, evalErr := k.interpreter.EvalTo(&output, req.Code)
+
+	if output.Len() != 0 && !req.Silent {
+		if err := k.publish("stream", stream{Name: "stdout", Text: output.String()}); err != nil {
+			return err
+		}
+	}
+
+	if evalErr != nil {
+		content := errorOf(evalErr)
+		if err := k.publish("error", content); err != nil {
+			return err
+		}
+		return k.reply(executeReply{
+			Status:         "error",
+			ExecutionCount: k.executionCount,
+			EName:          content.EName,
+			EValue:         content.EValue,
+			Traceback:      content.Traceback,
+		})
+	}
+
+	if result != nil && !req.Silent {
+		err := k.publish("execute_result", executeResult{
+			ExecutionCount: k.executionCount,
+			Data:           Display(result),
+			Metadata:       map[string]any{},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return k.reply(executeReply{Status: "ok", ExecutionCount: k.executionCount})
+}
+
+// 実行に失敗した段階ごとのエラーの名前
+var errorNames = map[repl.Stage]string{
+	repl.ParseStage:   "SyntaxError",
+	repl.CheckStage:   "TypeError",
+	repl.CompileStage: "CompileError",
+	repl.RunStage:     "RuntimeError",
+}
+
+func errorOf(err error) errorContent {
+	e, ok := err.(*repl.Error)
+	if !ok {
+		return errorContent{EName: "Error", EValue: err.Error(), Traceback: []string{err.Error()}}
+	}
+	return errorContent{
+		EName:     errorNames[e.Stage],
+		EValue:    strings.Join(e.Messages, "\n"),
+		Traceback: append([]string{string(e.Stage) + ":"}, e.Messages...),
+	}
+}
+
+// キーワード。補完の候補に含める
+var keywords = []string{"else", "false", "fn", "if", "let", "return", "true"}
+
+// complete はカーソルの前の識別子を、グローバル変数、組み込み関数、キーワードの名前で補完する。
+// cursor_pos はコードポイント単位の位置
+func (k *Kernel) complete() error {
+	var req completeRequest
+	if err := json.Unmarshal(k.parent.Content, &req); err != nil {
+		return err
+	}
+
+	code := []rune(req.Code)
+	end := min(max(req.CursorPos, 0), len(code))
+	start := end
+	for start > 0 && isIdentRune(code[start-1]) {
+		start--
+	}
+	prefix := string(code[start:end])
+
+	matches := []string{}
+	if prefix != "" && !unicode.IsDigit(code[start]) {
+		for _, name := range append(k.interpreter.Names(), keywords...) {
+			if strings.HasPrefix(name, prefix) {
+				matches = append(matches, name)
+			}
+		}
+	}
+	return k.reply(completeReply{
+		Status:      "ok",
+		Matches:     matches,
+		CursorStart: start,
+		CursorEnd:   end,
+		Metadata:    map[string]any{},
+	})
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isComplete は REPL と同じ規則で、セルの入力が途中で終わっているかどうかを答える
+func (k *Kernel) isComplete() error {
+	var req isCompleteRequest
+	if err := json.Unmarshal(k.parent.Content, &req); err != nil {
+		return err
+	}
+	if repl.Incomplete(req.Code) {
+		return k.reply(isCompleteReply{Status: "incomplete", Indent: "  "})
+	}
+	return k.reply(isCompleteReply{Status: "complete"})
+}
+
+// reply は処理中のリクエストと同じチャネルで応答を送る
+func (k *Kernel) reply(content any) error {
+	msgType := strings.TrimSuffix(k.parent.Header.MsgType, "_request") + "_reply"
+	return k.send(k.parent.Channel, msgType, content)
+}
+
+// publish は iopub チャネルでメッセージを送る
+func (k *Kernel) publish(msgType string, content any) error {
+	return k.send(IOPubChannel, msgType, content)
+}
+
+func (k *Kernel) send(channel, msgType string, content any) error {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(content); err != nil {
+		return err
+	}
+	parent := k.parent.Header
+	return k.out.Encode(&Message{
+		Channel: channel,
+		Header: Header{
+			MsgID:    newID(),
+			Session:  parent.Session,
+			Username: "kernel",
+			Date:     time.Now().UTC().Format(time.RFC3339Nano),
+			MsgType:  msgType,
+			Version:  ProtocolVersion,
+		},
+		ParentHeader: &parent,
+		Metadata:     map[string]any{},
+		Content:      bytes.TrimSpace(body.Bytes()),
+	})
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,199 @@
+package kernel
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// run はリクエストを順にカーネルに送り、送られたメッセージを返す
+func run(t *testing.T, requests ...string) []Message {
+	t.Helper()
+	var in strings.Builder
+	for i, r := range requests {
+		msgType, content, _ := strings.Cut(r, " ")
+		channel := ShellChannel
+		if msgType == "shutdown_request" {
+			channel = ControlChannel
+		}
+		fmt.Fprintf(&in, `{"channel":%q,"header":{"msg_id":"req%d","session":"s1","msg_type":%q,"version":"5.3"},"parent_header":{},"metadata":{},"content":%s}`+"\n",
+			channel, i, msgType, content)
+	}
+
+	var out strings.Builder
+	k, err := New(strings.NewReader(in.String()), &out)
+	if err != nil {
+		t.Fatalf("New failed: %s", err)
+	}
+	if err := k.Run(); err != nil {
+		t.Fatalf("Run failed: %s", err)
+	}
+
+	messages := []Message{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var msg Message
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("invalid message %q: %s", line, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+// find は parent のリクエストに対する msgType のメッセージの内容を返す
+func find(t *testing.T, messages []Message, parent, msgType string) map[string]any {
+	t.Helper()
+	for _, msg := range messages {
+		if msg.ParentHeader.MsgID == parent && msg.Header.MsgType == msgType {
+			var content map[string]any
+			if err := json.Unmarshal(msg.Content, &content); err != nil {
+				t.Fatalf("invalid content: %s", err)
+			}
+			return content
+		}
+	}
+	t.Fatalf("no %s message for %s", msgType, parent)
+	return nil
+}
+
+func TestExecute(t *testing.T) {
+	messages := run(t,
+		`execute_request {"code":"let double = fn(x) { x * 2 };"}`,
+		`execute_request {"code":"puts(\"hi\");\ndouble(21)"}`,
+		`execute_request {"code":"double(true) +"}`,
+		`execute_request {"code":"let call = fn(f) { f() }; let broken = call(1);"}`,
+		`execute_request {"code":"broken"}`,
+		`execute_request {"code":"double(1)","silent":true,"store_history":false}`,
+	)
+
+	// セルごとに busy と idle を知らせる
+	states := []string{}
+	for _, msg := range messages {
+		if msg.Header.MsgType == "status" {
+			var s status
+			json.Unmarshal(msg.Content, &s)
+			states = append(states, s.ExecutionState)
+		}
+		if msg.Header.Session != "s1" || msg.Header.Version != ProtocolVersion {
+			t.Errorf("wrong header: %+v", msg.Header)
+		}
+	}
+	if strings.Join(states, " ") != strings.TrimSpace(strings.Repeat("busy idle ", 6)) {
+		t.Errorf("wrong status messages: %v", states)
+	}
+
+	if reply := find(t, messages, "req0", "execute_reply"); reply["status"] != "ok" || reply["execution_count"] != 1.0 {
+		t.Errorf("wrong reply for let: %v", reply)
+	}
+	for _, msg := range messages {
+		if msg.ParentHeader.MsgID == "req0" && msg.Header.MsgType == "execute_result" {
+			t.Errorf("let statement has a result")
+		}
+	}
+
+	if s := find(t, messages, "req1", "stream"); s["name"] != "stdout" || s["text"] != "hi\n" {
+		t.Errorf("wrong stream: %v", s)
+	}
+	result := find(t, messages, "req1", "execute_result")
+	if data := result["data"].(map[string]any); data["text/plain"] != "42" || result["execution_count"] != 2.0 {
+		t.Errorf("wrong result: %v", result)
+	}
+	if input := find(t, messages, "req1", "execute_input"); input["code"] != "puts(\"hi\");\ndouble(21)" {
+		t.Errorf("wrong execute_input: %v", input)
+	}
+
+	if e := find(t, messages, "req2", "error"); e["ename"] != "SyntaxError" {
+		t.Errorf("wrong error: %v", e)
+	}
+	if reply := find(t, messages, "req2", "execute_reply"); reply["status"] != "error" || reply["ename"] != "SyntaxError" {
+		t.Errorf("wrong reply for an error: %v", reply)
+	}
+
+	// 実行時エラーのセルの let は取り消される
+	if e := find(t, messages, "req3", "error"); e["ename"] != "RuntimeError" {
+		t.Errorf("wrong error: %v", e)
+	}
+	if e := find(t, messages, "req4", "error"); e["ename"] != "CompileError" || !strings.Contains(e["evalue"].(string), "undefined variable broken") {
+		t.Errorf("failed cell changed the state: %v", e)
+	}
+
+	// silent のセルは結果を送らず、store_history が false なら実行回数を増やさない
+	for _, msg := range messages {
+		if msg.ParentHeader.MsgID == "req5" && msg.Channel == IOPubChannel && msg.Header.MsgType != "status" {
+			t.Errorf("silent cell published %s", msg.Header.MsgType)
+		}
+	}
+	if reply := find(t, messages, "req5", "execute_reply"); reply["execution_count"] != 5.0 {
+		t.Errorf("wrong execution count: %v", reply)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		code     string
+		cursor   int
+		expected string
+		start    int
+	}{
+		{"let total = 1;", 14, "", 14},
+		{"tot", 3, "total", 0},
+		{"[le", 3, "len let", 1},
+		{"ré", 2, "résumé", 0},
+		{"tot + 1", 2, "total", 0},
+		{"1", 1, "", 0},
+	}
+
+	for _, tt := range tests {
+		messages := run(t,
+			`execute_request {"code":"let total = 1; let résumé = 2;"}`,
+			fmt.Sprintf(`complete_request {"code":%q,"cursor_pos":%d}`, tt.code, tt.cursor),
+		)
+		reply := find(t, messages, "req1", "complete_reply")
+		matches := []string{}
+		for _, m := range reply["matches"].([]any) {
+			matches = append(matches, m.(string))
+		}
+		if strings.Join(matches, " ") != tt.expected || reply["cursor_start"] != float64(tt.start) || reply["cursor_end"] != float64(tt.cursor) {
+			t.Errorf("wrong completion for %q at %d. want %q from %d, got %v", tt.code, tt.cursor, tt.expected, tt.start, reply)
+		}
+	}
+}
+
+func TestKernelInfoAndShutdown(t *testing.T) {
+	messages := run(t,
+		`kernel_info_request {}`,
+		`is_complete_request {"code":"let f = fn(x) {"}`,
+		`is_complete_request {"code":"1 + 2"}`,
+		`unknown_request {}`,
+		`shutdown_request {"restart":false}`,
+		`execute_request {"code":"1"}`,
+	)
+
+	info := find(t, messages, "req0", "kernel_info_reply")
+	if language := info["language_info"].(map[string]any); language["name"] != "monkey" || language["file_extension"] != ".mk" {
+		t.Errorf("wrong kernel info: %v", info)
+	}
+	if reply := find(t, messages, "req1", "is_complete_reply"); reply["status"] != "incomplete" {
+		t.Errorf("wrong is_complete reply: %v", reply)
+	}
+	if reply := find(t, messages, "req2", "is_complete_reply"); reply["status"] != "complete" {
+		t.Errorf("wrong is_complete reply: %v", reply)
+	}
+
+	reply := find(t, messages, "req4", "shutdown_reply")
+	if reply["status"] != "ok" {
+		t.Errorf("wrong shutdown reply: %v", reply)
+	}
+	for _, msg := range messages {
+		if msg.Header.MsgType == "shutdown_reply" && msg.Channel != ControlChannel {
+			t.Errorf("shutdown reply is sent on %s", msg.Channel)
+		}
+		if msg.ParentHeader.MsgID == "req3" && msg.Header.MsgType != "status" {
+			t.Errorf("unknown request is answered with %s", msg.Header.MsgType)
+		}
+		if msg.ParentHeader.MsgID == "req5" {
+			t.Errorf("request after shutdown is handled")
+		}
+	}
+}
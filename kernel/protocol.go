@@ -0,0 +1,119 @@
+package kernel
+
+import "encoding/json"
+
+// ProtocolVersion は実装している Jupyter のメッセージングプロトコルのバージョン
+const ProtocolVersion = "5.3"
+
+// Message は Jupyter のメッセージ。1行に1つの JSON として読み書きする。
+// ZeroMQ ではソケットで区別するチャネルを Channel に書く
+type Message struct {
+	Channel      string          `json:"channel"`
+	Header       Header          `json:"header"`
+	ParentHeader *Header         `json:"parent_header"`
+	Metadata     map[string]any  `json:"metadata"`
+	Content      json.RawMessage `json:"content"`
+}
+
+type Header struct {
+	MsgID    string `json:"msg_id"`
+	Session  string `json:"session"`
+	Username string `json:"username"`
+	Date     string `json:"date"`
+	MsgType  string `json:"msg_type"`
+	Version  string `json:"version"`
+}
+
+// チャネル
+const (
+	ShellChannel   = "shell"
+	ControlChannel = "control"
+	IOPubChannel   = "iopub"
+)
+
+type executeRequest struct {
+	Code         string `json:"code"`
+	Silent       bool   `json:"silent"`
+	StoreHistory *bool  `json:"store_history"` // 省略した場合は true
+}
+
+type executeReply struct {
+	Status         string   `json:"status"`
+	ExecutionCount int      `json:"execution_count"`
+	EName          string   `json:"ename,omitempty"`
+	EValue         string   `json:"evalue,omitempty"`
+	Traceback      []string `json:"traceback,omitempty"`
+}
+
+type executeInput struct {
+	Code           string `json:"code"`
+	ExecutionCount int    `json:"execution_count"`
+}
+
+type executeResult struct {
+	ExecutionCount int               `json:"execution_count"`
+	Data           map[string]string `json:"data"`
+	Metadata       map[string]any    `json:"metadata"`
+}
+
+type stream struct {
+	Name string `json:"name"`
+	Text string `json:"text"`
+}
+
+type errorContent struct {
+	EName     string   `json:"ename"`
+	EValue    string   `json:"evalue"`
+	Traceback []string `json:"traceback"`
+}
+
+type status struct {
+	ExecutionState string `json:"execution_state"`
+}
+
+type completeRequest struct {
+	Code      string `json:"code"`
+	CursorPos int    `json:"cursor_pos"`
+}
+
+type completeReply struct {
+	Status      string         `json:"status"`
+	Matches     []string       `json:"matches"`
+	CursorStart int            `json:"cursor_start"`
+	CursorEnd   int            `json:"cursor_end"`
+	Metadata    map[string]any `json:"metadata"`
+}
+
+type isCompleteRequest struct {
+	Code string `json:"code"`
+}
+
+type isCompleteReply struct {
+	Status string `json:"status"`
+	Indent string `json:"indent,omitempty"`
+}
+
+type kernelInfoReply struct {
+	Status                string       `json:"status"`
+	ProtocolVersion       string       `json:"protocol_version"`
+	Implementation        string       `json:"implementation"`
+	ImplementationVersion string       `json:"implementation_version"`
+	LanguageInfo          languageInfo `json:"language_info"`
+	Banner                string       `json:"banner"`
+}
+
+type languageInfo struct {
+	Name          string `json:"name"`
+	Version       string `json:"version"`
+	MimeType      string `json:"mimetype"`
+	FileExtension string `json:"file_extension"`
+}
+
+type shutdownRequest struct {
+	Restart bool `json:"restart"`
+}
+
+type shutdownReply struct {
+	Status  string `json:"status"`
+	Restart bool   `json:"restart"`
+}
@@ -1,45 +1,126 @@
 package lexer
 
-import "monkey/token"
+import (
+	"fmt"
+	"monkey/token"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
 type Lexer struct {
 	input        string
-	position     int  // 入力における現在の位置（現在の文字）
-	readPosition int  // これから読み込む位置（現在の文字の次）
-	ch           byte // 現在検査中の文字
+	position     int  // 入力における現在の位置（現在の文字の先頭バイト）
+	readPosition int  // これから読み込む位置（現在の文字の次の先頭バイト）
+	ch           rune // 現在検査中の文字
+	line         int  // 現在の文字の行番号(1始まり)
+	column       int  // 現在の文字の列番号(1始まり、ルーン単位)
+
+	keepComments bool // true の場合、コメントを COMMENT トークンとして返す
+	errors       []*Error
+}
+
+// Error は位置情報付きの字句解析エラー
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
 }
 
 func New(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewAt(input, 1, 1)
+}
+
+// コメントを読み飛ばさず COMMENT トークンとして返す Lexer を作成する
+// フォーマッタやドキュメント生成など、コメントを保持したい場合に使う
+func NewWithComments(input string) *Lexer {
+	l := New(input)
+	l.keepComments = true
+	return l
+}
+
+// 入力の先頭文字の位置を指定して Lexer を作成する
+// 文字列補間の式部分など、別の入力の一部を字句解析するときに使う
+func NewAt(input string, line, column int) *Lexer {
+	l := &Lexer{input: input, line: line, column: column - 1}
 	l.readChar()
 	return l
 }
 
-// 1文字読み進める
+// 字句解析中に発生したエラーを "行:列: メッセージ" の形式で返す
+func (l *Lexer) Errors() []string {
+	messages := make([]string, len(l.errors))
+	for i, err := range l.errors {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// 字句解析中に発生したエラーを位置情報付きで返す
+func (l *Lexer) Diagnostics() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) error(line, column int, format string, a ...interface{}) {
+	l.errors = append(l.errors, &Error{Line: line, Column: column, Message: fmt.Sprintf(format, a...)})
+}
+
+// 1文字(UTF-8 の1ルーン)読み進める
 func (l *Lexer) readChar() {
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
+	width := 1
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
 	} else {
-		l.ch = l.input[l.readPosition] // ASCII文字コードのみに対応
+		l.ch, width = utf8.DecodeRuneInString(l.input[l.readPosition:])
 	}
 	l.position = l.readPosition
-	l.readPosition += 1
+	l.readPosition += width
 }
 
 // 次の文字を先読みする
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
 	}
 }
 
 // トークンを読み進める
 func (l *Lexer) NextToken() token.Token {
-	var tok token.Token
+	for {
+		l.skipWhiteSpace()
+		if !l.atComment() {
+			break
+		}
+
+		line, column := l.line, l.column
+		comment := l.readComment()
+		if l.keepComments {
+			return token.Token{Type: token.COMMENT, Literal: comment, Line: line, Column: column}
+		}
+	}
+
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line, tok.Column = line, column
+	return tok
+}
 
-	l.skipWhiteSpace()
+func (l *Lexer) readToken() token.Token {
+	var tok token.Token
 
 	switch l.ch {
 	case '=':
@@ -54,7 +135,12 @@ func (l *Lexer) NextToken() token.Token {
 	case '+':
 		tok = newToken(token.PLUS, l.ch)
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '>' {
+			l.readChar()
+			tok = token.Token{Type: token.ARROW, Literal: "->"}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -85,8 +171,10 @@ func (l *Lexer) NextToken() token.Token {
 	case '}':
 		tok = newToken(token.RBRACE, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		tok.Type, tok.Literal = l.readString()
+	case '`':
+		tok.Type = token.RAW_STRING
+		tok.Literal = l.readRawString()
 	case '[':
 		tok = newToken(token.LBRAKET, l.ch)
 	case ']':
@@ -115,7 +203,7 @@ func (l *Lexer) NextToken() token.Token {
 
 // トークンの初期化
 // トークンの種類とリテラルを返す
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
 
@@ -137,12 +225,167 @@ func (l *Lexer) readNumber() string {
 	return l.input[position:l.position]
 }
 
+// TemplatePart は文字列補間を含む文字列リテラルの構成要素
+type TemplatePart struct {
+	IsExpression bool
+	Value        string // 文字列部分ならエスケープ解除後の値、式部分ならソースコード
+	Line         int    // 式部分の先頭の位置
+	Column       int
+}
+
 // 文字列を読み込む
-func (l *Lexer) readString() string {
+// 補間 "${...}" を含まない場合はエスケープ解除後の値を STRING として、
+// 含む場合は引用符の間のソースコードをそのまま TEMPLATE として返す
+func (l *Lexer) readString() (token.TokenType, string) {
+	start := l.position + 1
+	parts := l.readStringParts()
+	end := l.position
+	if l.ch != '"' {
+		end = len(l.input)
+	}
+
+	for _, part := range parts {
+		if part.IsExpression {
+			return token.TEMPLATE, l.input[start:end]
+		}
+	}
+	if len(parts) == 0 {
+		return token.STRING, ""
+	}
+	return token.STRING, parts[0].Value
+}
+
+// SplitTemplate は TEMPLATE トークンを文字列部分と式部分に分割する
+func SplitTemplate(tok token.Token) []TemplatePart {
+	l := NewAt(`"`+tok.Literal+`"`, tok.Line, tok.Column)
+	return l.readStringParts()
+}
+
+// l.ch が開始の '"' の位置から終了の '"' までを読み込み、構成要素に分割する
+func (l *Lexer) readStringParts() []TemplatePart {
+	line, column := l.line, l.column
+	parts := []TemplatePart{}
+	var out strings.Builder
+
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == 0 && l.position >= len(l.input):
+			l.error(line, column, "unterminated string literal")
+			if out.Len() > 0 {
+				parts = append(parts, TemplatePart{Value: out.String()})
+			}
+			return parts
+		case l.ch == '"':
+			if out.Len() > 0 || len(parts) == 0 {
+				parts = append(parts, TemplatePart{Value: out.String()})
+			}
+			return parts
+		case l.ch == '\\':
+			l.readEscape(&out)
+		case l.ch == '$' && l.peekChar() == '{':
+			if out.Len() > 0 {
+				parts = append(parts, TemplatePart{Value: out.String()})
+				out.Reset()
+			}
+			parts = append(parts, l.readInterpolation())
+		default:
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// l.ch が '\\' の位置からエスケープシーケンスを読み込み、out に書き込む
+func (l *Lexer) readEscape(out *strings.Builder) {
+	line, column := l.line, l.column
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		out.WriteRune('\n')
+	case 't':
+		out.WriteRune('\t')
+	case 'r':
+		out.WriteRune('\r')
+	case '0':
+		out.WriteRune(0)
+	case '"', '\\', '$':
+		out.WriteRune(l.ch)
+	case 'u':
+		if l.peekChar() != '{' {
+			l.error(line, column, "invalid unicode escape: expected '{' after \\u")
+			return
+		}
+		l.readChar()
+		position := l.position + 1
+		for l.peekChar() != '}' && l.peekChar() != '"' && l.peekChar() != 0 {
+			l.readChar()
+		}
+		if l.peekChar() != '}' {
+			l.error(line, column, "unterminated unicode escape")
+			return
+		}
+		digits := l.input[position : l.position+1]
+		l.readChar()
+
+		code, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || code > unicode.MaxRune || (0xD800 <= code && code <= 0xDFFF) {
+			l.error(line, column, "invalid unicode escape: \\u{%s}", digits)
+			return
+		}
+		out.WriteRune(rune(code))
+	default:
+		if l.ch == 0 && l.position >= len(l.input) {
+			return
+		}
+		l.error(line, column, "unknown escape sequence: \\%c", l.ch)
+	}
+}
+
+// l.ch が "${" の '$' の位置から対応する '}' までを読み込み、式部分を返す
+func (l *Lexer) readInterpolation() TemplatePart {
+	line, column := l.line, l.column
+	l.readChar() // '{'
+	part := TemplatePart{IsExpression: true, Line: l.line, Column: l.column + 1}
+	position := l.position + 1
+
+	depth := 1
+	for {
+		l.readChar()
+
+		switch {
+		case l.ch == 0 && l.position >= len(l.input):
+			l.error(line, column, "unterminated string interpolation")
+			part.Value = l.input[position:]
+			return part
+		case l.ch == '{':
+			depth++
+		case l.ch == '}':
+			depth--
+			if depth == 0 {
+				part.Value = l.input[position:l.position]
+				return part
+			}
+		case l.ch == '"':
+			l.readStringParts() // 式の中の文字列リテラルは読み飛ばす
+		case l.ch == '`':
+			l.readRawString()
+		}
+	}
+}
+
+// 生文字列を読み込む。エスケープシーケンスや補間は解釈しない
+func (l *Lexer) readRawString() string {
+	line, column := l.line, l.column
 	position := l.position + 1
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
+		if l.ch == 0 && l.position >= len(l.input) {
+			l.error(line, column, "unterminated raw string literal")
+			return l.input[position:]
+		}
+		if l.ch == '`' {
 			break
 		}
 	}
@@ -151,15 +394,56 @@ func (l *Lexer) readString() string {
 
 // 空白文字をスキップする
 func (l *Lexer) skipWhiteSpace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' || (l.ch >= utf8.RuneSelf && unicode.IsSpace(l.ch)) {
+		l.readChar()
+	}
+}
+
+// コメントの開始位置にいるかどうか
+func (l *Lexer) atComment() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// コメントを読み込み、区切り文字を含むコメント全体を返す
+// ブロックコメント /* ... */ は入れ子にできる
+func (l *Lexer) readComment() string {
+	line, column := l.line, l.column
+	position := l.position
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && !(l.ch == 0 && l.position >= len(l.input)) {
+			l.readChar()
+		}
+		return strings.TrimRight(l.input[position:l.position], "\r")
+	}
+
+	l.readChar() // '*'
+	depth := 1
+	for depth > 0 {
 		l.readChar()
+
+		switch {
+		case l.ch == 0 && l.position >= len(l.input):
+			l.error(line, column, "unterminated block comment")
+			return l.input[position:]
+		case l.ch == '/' && l.peekChar() == '*':
+			l.readChar()
+			depth++
+		case l.ch == '*' && l.peekChar() == '/':
+			l.readChar()
+			depth--
+		}
 	}
+	l.readChar() // 最後の '/' の次へ
+
+	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// ASCII 以外の文字も Unicode の Letter であれば識別子に使える
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' || (ch >= utf8.RuneSelf && unicode.IsLetter(ch))
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
@@ -14,7 +14,7 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
 
 if ( 5 < 10 ) {
@@ -138,3 +138,258 @@ if ( 5 < 10 ) {
 		}
 	}
 }
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := "let 挨拶 = \"こんにちは、世界\";　café + _名前;"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.LET, "let"},
+		{token.IDENT, "挨拶"},
+		{token.ASSIGN, "="},
+		{token.STRING, "こんにちは、世界"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "café"},
+		{token.PLUS, "+"},
+		{token.IDENT, "_名前"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, token.STRING, "a\nb"},
+		{`"tab\there"`, token.STRING, "tab\there"},
+		{`"say \"hi\""`, token.STRING, `say "hi"`},
+		{`"back\\slash"`, token.STRING, `back\slash`},
+		{`"\u{65E5}\u{672C}"`, token.STRING, "日本"},
+		{`"cost \$5"`, token.STRING, "cost $5"},
+		{`""`, token.STRING, ""},
+		{"`raw \\n ${x}`", token.RAW_STRING, `raw \n ${x}`},
+		{"`multi\nline`", token.RAW_STRING, "multi\nline"},
+		{`"hello ${name}!"`, token.TEMPLATE, "hello ${name}!"},
+		{`"${ f("}") }"`, token.TEMPLATE, `${ f("}") }`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if len(l.Errors()) != 0 {
+			t.Fatalf("tests[%d] - unexpected errors: %v", i, l.Errors())
+		}
+
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Fatalf("tests[%d] - expected EOF after literal, got=%q", i, next.Type)
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"abc`, "1:1: unterminated string literal"},
+		{"let x = `abc", "1:9: unterminated raw string literal"},
+		{"\n  \"${x", "2:4: unterminated string interpolation"},
+		{`"\q"`, `1:2: unknown escape sequence: \q`},
+		{`"\u{110000}"`, `1:2: invalid unicode escape: \u{110000}`},
+		{`"\u41"`, `1:2: invalid unicode escape: expected '{' after \u`},
+	}
+
+	for i, tt := range tests {
+		l := New(tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+
+		errors := l.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("tests[%d] - expected an error, got none", i)
+		}
+
+		if errors[0] != tt.expectedError {
+			t.Fatalf("tests[%d] - wrong error. expected=%q, got=%q", i, tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestArrow(t *testing.T) {
+	input := "fn(x: int) -> int { x - -1 }"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FUNCTION, "fn"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.COLON, ":"},
+		{token.IDENT, "int"},
+		{token.RPAREN, ")"},
+		{token.ARROW, "->"},
+		{token.IDENT, "int"},
+		{token.LBRACE, "{"},
+		{token.IDENT, "x"},
+		{token.MINUS, "-"},
+		{token.MINUS, "-"},
+		{token.INT, "1"},
+		{token.RBRACE, "}"},
+		{token.EOF, ""},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	input := "let x = 5;\n  x + \"日本\" + y;"
+
+	tests := []struct {
+		expectedLiteral string
+		expectedLine    int
+		expectedColumn  int
+	}{
+		{"let", 1, 1},
+		{"x", 1, 5},
+		{"=", 1, 7},
+		{"5", 1, 9},
+		{";", 1, 10},
+		{"x", 2, 3},
+		{"+", 2, 5},
+		{"日本", 2, 7},
+		{"+", 2, 12},
+		{"y", 2, 14},
+	}
+
+	l := New(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedColumn, tok.Line, tok.Column)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// 行コメント
+let x = 1; // 末尾のコメント
+/* ブロック
+   コメント */
+let y = /* 入れ子 /* の */ コメント */ 2;
+x / y;`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.COMMENT, "// 行コメント"},
+		{token.LET, "let"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.COMMENT, "// 末尾のコメント"},
+		{token.COMMENT, "/* ブロック\n   コメント */"},
+		{token.LET, "let"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "="},
+		{token.COMMENT, "/* 入れ子 /* の */ コメント */"},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.SLASH, "/"},
+		{token.IDENT, "y"},
+		{token.SEMICOLON, ";"},
+		{token.EOF, ""},
+	}
+
+	withComments := NewWithComments(input)
+	withoutComments := New(input)
+
+	for i, tt := range tests {
+		tok := withComments.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tt.expectedType == token.COMMENT {
+			continue
+		}
+
+		tok = withoutComments.NextToken()
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong without comments. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+
+	if len(withComments.Errors()) != 0 || len(withoutComments.Errors()) != 0 {
+		t.Fatalf("unexpected errors: %v %v", withComments.Errors(), withoutComments.Errors())
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := New("let x = 1;\n/* /* */ 閉じていない")
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 {
+		t.Fatalf("expected 1 error, got=%v", errors)
+	}
+
+	if errors[0] != "2:1: unterminated block comment" {
+		t.Fatalf("wrong error. got=%q", errors[0])
+	}
+}
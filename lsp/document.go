@@ -0,0 +1,239 @@
+package lsp
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// document は開かれているファイルと、その解析結果
+type document struct {
+	uri   string
+	text  string
+	lines []string
+
+	program     *ast.Program
+	resolver    *resolver.Resolver
+	info        *resolver.Info
+	diagnostics []Diagnostic
+}
+
+var (
+	preludeOnce    sync.Once
+	preludeProgram *ast.Program
+)
+
+// prelude はコメント付きで解析した prelude を返す。解析結果は文書の間で共有する
+func prelude() *ast.Program {
+	preludeOnce.Do(func() {
+		program, err := stdlib.Program()
+		if err != nil {
+			program = &ast.Program{} // prelude は stdlib のテストで検査されている
+		}
+		preludeProgram = program
+	})
+	return preludeProgram
+}
+
+// newDocument は text を解析する。prelude の定義は組み込み関数と同様にグローバルとして扱う
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri, text: text, lines: strings.Split(text, "\n")}
+
+	p := parser.New(lexer.NewWithComments(text))
+	d.program = p.ParseProgram()
+
+	d.resolver = resolver.New()
+	d.resolver.Resolve(prelude())
+	d.info = d.resolver.Resolve(d.program)
+
+	d.diagnostics = []Diagnostic{}
+	for _, err := range p.Diagnostics() {
+		start := d.position(err.Line, err.Column)
+		d.diagnostics = append(d.diagnostics, Diagnostic{
+			Range:    Range{Start: start, End: Position{Line: start.Line, Character: start.Character + 1}},
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  err.Message,
+		})
+	}
+	for _, ident := range d.info.Unresolved {
+		d.diagnostics = append(d.diagnostics, Diagnostic{
+			Range:    d.identRange(ident),
+			Severity: SeverityError,
+			Source:   "monkey",
+			Message:  fmt.Sprintf("undefined variable %s", ident.Value),
+		})
+	}
+	return d
+}
+
+// position はトークンの位置(1始まりの行番号とルーン単位の列番号)を LSP の位置に変換する
+func (d *document) position(line, column int) Position {
+	if line < 1 {
+		return Position{}
+	}
+	if line > len(d.lines) {
+		return Position{Line: line - 1}
+	}
+
+	character, runes := 0, 0
+	for _, r := range d.lines[line-1] {
+		if runes >= column-1 {
+			break
+		}
+		character += utf16Len(r)
+		runes++
+	}
+	if runes < column-1 {
+		character += column - 1 - runes // 行末より後ろの位置
+	}
+	return Position{Line: line - 1, Character: character}
+}
+
+// location は LSP の位置をトークンの位置(1始まりの行番号とルーン単位の列番号)に変換する
+func (d *document) location(pos Position) (line, column int) {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return pos.Line + 1, pos.Character + 1
+	}
+
+	column = 1
+	units := 0
+	for _, r := range d.lines[pos.Line] {
+		if units >= pos.Character {
+			break
+		}
+		units += utf16Len(r)
+		column++
+	}
+	return pos.Line + 1, column
+}
+
+// utf16Len は r を UTF-16 で表したときのコードユニット数を返す
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+func (d *document) identRange(ident *ast.Identifier) Range {
+	tok := ident.Token
+	return Range{
+		Start: d.position(tok.Line, tok.Column),
+		End:   d.position(tok.Line, tok.Column+utf8.RuneCountInString(ident.Value)),
+	}
+}
+
+// identAt は pos にある識別子を返す。識別子がなければ nil を返す
+func (d *document) identAt(pos Position) *ast.Identifier {
+	line, column := d.location(pos)
+
+	matches := func(ident *ast.Identifier) bool {
+		tok := ident.Token
+		return tok.Line == line && column >= tok.Column && column <= tok.Column+utf8.RuneCountInString(ident.Value)
+	}
+
+	for ident := range d.info.Defs {
+		if matches(ident) {
+			return ident
+		}
+	}
+	for ident := range d.info.Uses {
+		if matches(ident) {
+			return ident
+		}
+	}
+	for _, ident := range d.info.Unresolved {
+		if matches(ident) {
+			return ident
+		}
+	}
+	return nil
+}
+
+// binding は識別子が定義または参照している束縛を返す
+func (d *document) binding(ident *ast.Identifier) *resolver.Binding {
+	if b, ok := d.info.Defs[ident]; ok {
+		return b
+	}
+	if ref, ok := d.info.Uses[ident]; ok {
+		return ref.Binding
+	}
+	return nil
+}
+
+// isLocal は束縛がこの文書で定義されているかどうかを返す
+func (d *document) isLocal(b *resolver.Binding) bool {
+	return b.Ident != nil && d.info.Defs[b.Ident] == b
+}
+
+// doc は束縛の直前に書かれたコメントをドキュメントとして返す
+func (d *document) doc(b *resolver.Binding) string {
+	if b.Ident == nil || b.Kind != resolver.Let {
+		return ""
+	}
+
+	comments := prelude().Comments
+	if d.isLocal(b) {
+		comments = d.program.Comments
+	}
+	return docComment(comments, b.Ident.Token.Line)
+}
+
+// docComment は line 行の直前に連続して書かれたコメントの本文を返す
+func docComment(comments []*ast.Comment, line int) string {
+	lines := []string{}
+	next := line
+	for i := len(comments) - 1; i >= 0; i-- {
+		c := comments[i]
+		end := c.Token.Line + strings.Count(c.Text, "\n")
+		if end >= line {
+			continue
+		}
+		if c.Trailing || end != next-1 {
+			break
+		}
+
+		lines = append([]string{commentText(c.Text)}, lines...)
+		next = c.Token.Line
+	}
+	return strings.Join(lines, "\n")
+}
+
+func commentText(text string) string {
+	if strings.HasPrefix(text, "//") {
+		return strings.TrimSpace(strings.TrimPrefix(text, "//"))
+	}
+	text = strings.TrimSuffix(strings.TrimPrefix(text, "/*"), "*/")
+	return strings.TrimSpace(text)
+}
+
+// nodeEnd はノードの末尾の位置(1始まりの行番号とルーン単位の列番号)を返す
+func nodeEnd(node ast.Node) (line, column int) {
+	update := func(l, c int) {
+		if l > line || l == line && c > column {
+			line, column = l, c
+		}
+	}
+
+	ast.Inspect(node, func(n ast.Node) bool {
+		tok := ast.TokenOf(n)
+		if strings.Contains(tok.Literal, "\n") {
+			lines := strings.Split(tok.Literal, "\n")
+			update(tok.Line+len(lines)-1, utf8.RuneCountInString(lines[len(lines)-1])+2)
+		} else {
+			update(tok.Line, tok.Column+utf8.RuneCountInString(tok.Literal))
+		}
+		if block, ok := n.(*ast.BlockStatement); ok {
+			update(block.Rbrace.Line, block.Rbrace.Column+1)
+		}
+		return true
+	})
+	return line, column
+}
@@ -0,0 +1,361 @@
+// Package lsp は Monkey の Language Server Protocol サーバーを実装する。
+// 標準入出力などのストリーム上で JSON-RPC のメッセージをやり取りし、
+// 診断(構文エラーと未定義の変数)、定義へのジャンプ、ホバー、補完、
+// ドキュメントシンボルを提供する。
+// 識別子の解決には resolver パッケージ(コンパイラの SymbolTable)を使う。
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/resolver"
+	"sort"
+	"strings"
+)
+
+// ErrExitWithoutShutdown は shutdown リクエストの前に exit 通知を受け取ったことを表す
+var ErrExitWithoutShutdown = errors.New("exit notification received before shutdown")
+
+var keywords = []string{"fn", "let", "true", "false", "if", "else", "return"}
+
+type Server struct {
+	in   *bufio.Reader
+	out  io.Writer
+	docs map[string]*document
+
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:   bufio.NewReader(in),
+		out:  out,
+		docs: make(map[string]*document),
+	}
+}
+
+// Run は exit 通知を受け取るか入力が終わるまでメッセージを処理する
+func (s *Server) Run() error {
+	for {
+		body, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			if err := s.replyError(nil, codeParseError, err.Error()); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if req.Method == "exit" {
+			if !s.shutdown {
+				return ErrExitWithoutShutdown
+			}
+			return nil
+		}
+
+		if err := s.handle(&req); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) handle(req *request) error {
+	// 通知には応答しない
+	if req.ID == nil {
+		return s.notify(req)
+	}
+
+	if s.shutdown {
+		return s.replyError(req.ID, codeInvalidRequest, "server is shutting down")
+	}
+
+	var result interface{}
+	var err error
+
+	switch req.Method {
+	case "initialize":
+		result = s.initialize()
+	case "shutdown":
+		s.shutdown = true
+	case "textDocument/definition":
+		result, err = s.withPosition(req.Params, s.definition)
+	case "textDocument/hover":
+		result, err = s.withPosition(req.Params, s.hover)
+	case "textDocument/completion":
+		result, err = s.withPosition(req.Params, s.completion)
+	case "textDocument/documentSymbol":
+		var params DocumentSymbolParams
+		if err = json.Unmarshal(req.Params, &params); err == nil {
+			result = s.documentSymbols(params)
+		}
+	default:
+		return s.replyError(req.ID, codeMethodNotFound, fmt.Sprintf("method not found: %s", req.Method))
+	}
+
+	if err != nil {
+		return s.replyError(req.ID, codeInvalidParams, err.Error())
+	}
+	return writeMessage(s.out, response{JSONRPC: "2.0", ID: req.ID, Result: result})
+}
+
+func (s *Server) notify(req *request) error {
+	switch req.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		return s.update(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil || len(params.ContentChanges) == 0 {
+			return nil
+		}
+		// 同期は文書全体で行うので、最後の変更が新しい内容になる
+		changes := params.ContentChanges
+		return s.update(params.TextDocument.URI, changes[len(changes)-1].Text)
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil
+		}
+		delete(s.docs, params.TextDocument.URI)
+		return s.publishDiagnostics(params.TextDocument.URI, []Diagnostic{})
+	}
+	// initialized や $/cancelRequest などは無視する
+	return nil
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.docs[uri] = doc
+	return s.publishDiagnostics(uri, doc.diagnostics)
+}
+
+func (s *Server) publishDiagnostics(uri string, diagnostics []Diagnostic) error {
+	return writeMessage(s.out, notification{
+		JSONRPC: "2.0",
+		Method:  "textDocument/publishDiagnostics",
+		Params:  PublishDiagnosticsParams{URI: uri, Diagnostics: diagnostics},
+	})
+}
+
+func (s *Server) replyError(id *json.RawMessage, code int, message string) error {
+	return writeMessage(s.out, errorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error:   &responseError{Code: code, Message: message},
+	})
+}
+
+func (s *Server) initialize() InitializeResult {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:       syncFull,
+			DefinitionProvider:     true,
+			HoverProvider:          true,
+			CompletionProvider:     &CompletionOptions{},
+			DocumentSymbolProvider: true,
+		},
+		ServerInfo: ServerInfo{Name: "monkey-lsp"},
+	}
+}
+
+// withPosition は位置を指定するリクエストの引数を解析し、開かれている文書に対して handler を呼ぶ。
+// 文書が開かれていない場合は null を返す
+func (s *Server) withPosition(raw json.RawMessage, handler func(*document, Position) interface{}) (interface{}, error) {
+	var params TextDocumentPositionParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, err
+	}
+
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil, nil
+	}
+	return handler(doc, params.Position), nil
+}
+
+func (s *Server) definition(doc *document, pos Position) interface{} {
+	ident := doc.identAt(pos)
+	if ident == nil {
+		return nil
+	}
+
+	// 組み込み関数と prelude の定義はこの文書の中にないので、ジャンプ先を返さない
+	b := doc.binding(ident)
+	if b == nil || !doc.isLocal(b) {
+		return nil
+	}
+	return Location{URI: doc.uri, Range: doc.identRange(b.Ident)}
+}
+
+func (s *Server) hover(doc *document, pos Position) interface{} {
+	ident := doc.identAt(pos)
+	if ident == nil {
+		return nil
+	}
+
+	b := doc.binding(ident)
+	if b == nil {
+		return nil
+	}
+
+	// 参照している位置から見たスコープ。自由変数や関数自身の参照もここでわかる
+	scope := b.Scope
+	if ref, ok := doc.info.Uses[ident]; ok {
+		scope = ref.Symbol.Scope
+	}
+
+	var out strings.Builder
+	out.WriteString("```monkey\n" + signature(b) + "\n```\n")
+	fmt.Fprintf(&out, "%s, scope: %s", describe(b), scopeName(scope))
+	if scope != b.Scope {
+		fmt.Fprintf(&out, " (defined as %s)", scopeName(b.Scope))
+	}
+	if doc := doc.doc(b); doc != "" {
+		out.WriteString("\n\n" + doc)
+	}
+
+	r := doc.identRange(ident)
+	return Hover{Contents: MarkupContent{Kind: "markdown", Value: out.String()}, Range: &r}
+}
+
+// completion はグローバル(prelude を含む)と組み込み関数、pos から見えるローカルの束縛、キーワードを返す
+func (s *Server) completion(doc *document, pos Position) interface{} {
+	items := map[string]CompletionItem{}
+
+	for _, kw := range keywords {
+		items[kw] = CompletionItem{Label: kw, Kind: CompletionKeyword}
+	}
+	for _, b := range doc.resolver.Globals() {
+		items[b.Name] = completionItem(b)
+	}
+
+	line, column := doc.location(pos)
+	for _, b := range doc.info.Bindings {
+		if b.Function != nil && visibleAt(b, line, column) {
+			items[b.Name] = completionItem(b)
+		}
+	}
+
+	result := make([]CompletionItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, item)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Label < result[j].Label })
+	return result
+}
+
+// visibleAt は関数内の束縛が line 行 column 列から見えるかどうかを返す
+func visibleAt(b *resolver.Binding, line, column int) bool {
+	fn := b.Function
+	if fn.Body == nil {
+		return false
+	}
+
+	after := func(l, c, line, column int) bool {
+		return line > l || line == l && column > c
+	}
+	if !after(b.Ident.Token.Line, b.Ident.Token.Column, line, column) {
+		return false
+	}
+	return after(line, column, fn.Body.Rbrace.Line, fn.Body.Rbrace.Column)
+}
+
+func completionItem(b *resolver.Binding) CompletionItem {
+	item := CompletionItem{Label: b.Name, Kind: CompletionVariable, Detail: describe(b)}
+	if _, ok := b.Value.(*ast.FunctionLiteral); ok || b.Kind == resolver.Builtin {
+		item.Kind = CompletionFunction
+		item.Detail = signature(b)
+	}
+	return item
+}
+
+func (s *Server) documentSymbols(params DocumentSymbolParams) interface{} {
+	doc, ok := s.docs[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	return doc.symbols(doc.program.Statements)
+}
+
+// symbols は文の並びに含まれる let 文をシンボルにする。関数の本体の let 文は子になる
+func (d *document) symbols(stmts []ast.Statement) []DocumentSymbol {
+	symbols := []DocumentSymbol{}
+	for _, stmt := range stmts {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok {
+			continue
+		}
+
+		endLine, endColumn := nodeEnd(let)
+		symbol := DocumentSymbol{
+			Name:           let.Name.Value,
+			Kind:           SymbolVariable,
+			Range:          Range{Start: d.position(let.Token.Line, let.Token.Column), End: d.position(endLine, endColumn)},
+			SelectionRange: d.identRange(let.Name),
+		}
+		if fn, ok := let.Value.(*ast.FunctionLiteral); ok {
+			symbol.Kind = SymbolFunction
+			symbol.Detail = functionSignature(fn)
+			if fn.Body != nil {
+				symbol.Children = d.symbols(fn.Body.Statements)
+			}
+		}
+		symbols = append(symbols, symbol)
+	}
+	return symbols
+}
+
+// signature は束縛の宣言を Monkey の構文で表す
+func signature(b *resolver.Binding) string {
+	switch b.Kind {
+	case resolver.Builtin:
+		return "builtin " + b.Name
+	case resolver.Parameter:
+		return "(parameter) " + b.Name
+	}
+
+	if fn, ok := b.Value.(*ast.FunctionLiteral); ok {
+		return "let " + b.Name + " = " + functionSignature(fn)
+	}
+	return "let " + b.Name
+}
+
+func functionSignature(fn *ast.FunctionLiteral) string {
+	params := make([]string, len(fn.Parameters))
+	for i, p := range fn.Parameters {
+		params[i] = p.Value
+	}
+	return "fn(" + strings.Join(params, ", ") + ")"
+}
+
+func describe(b *resolver.Binding) string {
+	switch b.Kind {
+	case resolver.Builtin:
+		return "builtin function"
+	case resolver.Parameter:
+		return "parameter"
+	}
+	if _, ok := b.Value.(*ast.FunctionLiteral); ok {
+		return "function"
+	}
+	return "variable"
+}
+
+func scopeName(scope compiler.SymbolScope) string {
+	return strings.ToLower(string(scope))
+}
@@ -0,0 +1,383 @@
+package lsp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const testURI = "file:///test.mk"
+
+// session はクライアントとして送るメッセージを組み立て、サーバーの応答を読み取る
+type session struct {
+	t      *testing.T
+	input  bytes.Buffer
+	nextID int
+}
+
+func newSession(t *testing.T, text string) *session {
+	s := &session{t: t}
+	s.request("initialize", map[string]interface{}{})
+	s.notify("initialized", map[string]interface{}{})
+	s.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: testURI, Version: 1, Text: text},
+	})
+	return s
+}
+
+func (s *session) request(method string, params interface{}) int {
+	s.nextID++
+	s.send(map[string]interface{}{"jsonrpc": "2.0", "id": s.nextID, "method": method, "params": params})
+	return s.nextID
+}
+
+func (s *session) notify(method string, params interface{}) {
+	s.send(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (s *session) send(v interface{}) {
+	if err := writeMessage(&s.input, v); err != nil {
+		s.t.Fatalf("writeMessage: %s", err)
+	}
+}
+
+func (s *session) position(method string, line, character int) int {
+	return s.request(method, TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: testURI},
+		Position:     Position{Line: line, Character: character},
+	})
+}
+
+type output struct {
+	ID     *int            `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+	Result json.RawMessage `json:"result"`
+	Error  *responseError  `json:"error"`
+}
+
+// run はサーバーを実行し、出力されたメッセージを返す
+func (s *session) run() []output {
+	var out bytes.Buffer
+	if err := NewServer(&s.input, &out).Run(); err != nil {
+		s.t.Fatalf("Run returned error: %s", err)
+	}
+
+	messages := []output{}
+	r := bufio.NewReader(&out)
+	for {
+		body, err := readMessage(r)
+		if err != nil {
+			break
+		}
+		var msg output
+		if err := json.Unmarshal(body, &msg); err != nil {
+			s.t.Fatalf("invalid message %s: %s", body, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func result(t *testing.T, messages []output, id int, v interface{}) {
+	t.Helper()
+	for _, msg := range messages {
+		if msg.ID == nil || *msg.ID != id {
+			continue
+		}
+		if msg.Error != nil {
+			t.Fatalf("request %d failed: %s", id, msg.Error.Message)
+		}
+		if err := json.Unmarshal(msg.Result, v); err != nil {
+			t.Fatalf("invalid result %s: %s", msg.Result, err)
+		}
+		return
+	}
+	t.Fatalf("no response for request %d", id)
+}
+
+func diagnostics(t *testing.T, messages []output) []Diagnostic {
+	t.Helper()
+	var last *PublishDiagnosticsParams
+	for _, msg := range messages {
+		if msg.Method == "textDocument/publishDiagnostics" {
+			last = &PublishDiagnosticsParams{}
+			json.Unmarshal(msg.Params, last)
+		}
+	}
+	if last == nil {
+		t.Fatalf("no diagnostics published")
+	}
+	return last.Diagnostics
+}
+
+func TestInitialize(t *testing.T) {
+	s := newSession(t, "")
+	messages := s.run()
+
+	var init InitializeResult
+	result(t, messages, 1, &init)
+
+	caps := init.Capabilities
+	if caps.TextDocumentSync != syncFull || !caps.DefinitionProvider || !caps.HoverProvider ||
+		caps.CompletionProvider == nil || !caps.DocumentSymbolProvider {
+		t.Errorf("wrong capabilities: %+v", caps)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	s := newSession(t, "let x = 1;\nlet y = x + z;\nlet = 2;")
+	diags := diagnostics(t, s.run())
+
+	expected := []Diagnostic{
+		{Range: Range{Position{2, 4}, Position{2, 5}}, Severity: SeverityError, Source: "monkey", Message: "expected next token to be IDENT, got = instead"},
+		{Range: Range{Position{2, 4}, Position{2, 5}}, Severity: SeverityError, Source: "monkey", Message: "no prefix parse function for = found"},
+		{Range: Range{Position{1, 12}, Position{1, 13}}, Severity: SeverityError, Source: "monkey", Message: "undefined variable z"},
+	}
+	if len(diags) != len(expected) {
+		t.Fatalf("wrong number of diagnostics. expected=%d, got=%d (%+v)", len(expected), len(diags), diags)
+	}
+	for i, d := range diags {
+		if d != expected[i] {
+			t.Errorf("diagnostics[%d] wrong.\nwant=%+v\ngot= %+v", i, expected[i], d)
+		}
+	}
+}
+
+func TestDiagnosticsAfterChange(t *testing.T) {
+	s := newSession(t, "x;")
+	s.notify("textDocument/didChange", DidChangeTextDocumentParams{
+		TextDocument:   TextDocumentIdentifier{URI: testURI},
+		ContentChanges: []TextDocumentContentChangeEvent{{Text: "let x = map([1], fn(e) { e });"}},
+	})
+	if diags := diagnostics(t, s.run()); len(diags) != 0 {
+		t.Errorf("expected no diagnostics, got=%+v", diags)
+	}
+}
+
+const sample = `// 2倍にする
+let double = fn(x) { x * 2 };
+let 日本 = 1; let n = 日本;
+let adder = fn(a) {
+  let b = a;
+  fn(c) { a + b + c + double(len([])) }
+};`
+
+func TestDefinition(t *testing.T) {
+	s := newSession(t, sample)
+	tests := []struct {
+		line, character int
+		expected        *Range
+	}{
+		{5, 10, &Range{Position{3, 15}, Position{3, 16}}}, // a -> 引数 a
+		{5, 14, &Range{Position{4, 6}, Position{4, 7}}},   // b -> let b
+		{5, 22, &Range{Position{1, 4}, Position{1, 10}}},  // double の末尾
+		{2, 21, &Range{Position{2, 4}, Position{2, 6}}},   // 日本
+		{5, 31, nil}, // len は組み込み関数
+		{0, 3, nil},  // コメント
+	}
+
+	ids := make([]int, len(tests))
+	for i, tt := range tests {
+		ids[i] = s.position("textDocument/definition", tt.line, tt.character)
+	}
+	messages := s.run()
+
+	for i, tt := range tests {
+		var loc *Location
+		result(t, messages, ids[i], &loc)
+
+		if tt.expected == nil {
+			if loc != nil {
+				t.Errorf("tests[%d]: expected no definition, got=%+v", i, loc)
+			}
+			continue
+		}
+		if loc == nil {
+			t.Errorf("tests[%d]: expected a definition, got null", i)
+			continue
+		}
+		if loc.URI != testURI || loc.Range != *tt.expected {
+			t.Errorf("tests[%d]: wrong definition. want=%+v, got=%+v", i, *tt.expected, loc.Range)
+		}
+	}
+}
+
+func TestHover(t *testing.T) {
+	s := newSession(t, sample)
+	tests := []struct {
+		line, character int
+		expected        []string
+	}{
+		{1, 5, []string{"let double = fn(x)", "function, scope: global", "2倍にする"}},
+		{5, 10, []string{"(parameter) a", "parameter, scope: free (defined as local)"}},
+		{4, 6, []string{"let b", "variable, scope: local"}},
+		{5, 30, []string{"builtin len", "builtin function, scope: builtin"}},
+		{0, 0, nil},
+	}
+
+	ids := make([]int, len(tests))
+	for i, tt := range tests {
+		ids[i] = s.position("textDocument/hover", tt.line, tt.character)
+	}
+	ids = append(ids, s.request("textDocument/hover", TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: "file:///unknown.mk"},
+	}))
+	messages := s.run()
+
+	for i, tt := range tests {
+		var hover *Hover
+		result(t, messages, ids[i], &hover)
+
+		if tt.expected == nil {
+			if hover != nil {
+				t.Errorf("tests[%d]: expected no hover, got=%+v", i, hover)
+			}
+			continue
+		}
+		if hover == nil {
+			t.Fatalf("tests[%d]: expected hover, got null", i)
+		}
+		for _, want := range tt.expected {
+			if !strings.Contains(hover.Contents.Value, want) {
+				t.Errorf("tests[%d]: hover %q does not contain %q", i, hover.Contents.Value, want)
+			}
+		}
+	}
+
+	var hover *Hover
+	result(t, messages, ids[len(ids)-1], &hover)
+	if hover != nil {
+		t.Errorf("expected no hover for unknown document, got=%+v", hover)
+	}
+}
+
+func TestHoverPreludeDoc(t *testing.T) {
+	s := newSession(t, "map([1], fn(x) { x });")
+	id := s.position("textDocument/hover", 0, 1)
+	messages := s.run()
+
+	var hover *Hover
+	result(t, messages, id, &hover)
+	if hover == nil || !strings.Contains(hover.Contents.Value, "let map = fn(arr, f)") {
+		t.Fatalf("wrong hover for prelude function: %+v", hover)
+	}
+	if strings.Count(hover.Contents.Value, "\n\n") == 0 {
+		t.Errorf("expected documentation from the prelude, got=%q", hover.Contents.Value)
+	}
+}
+
+func TestCompletion(t *testing.T) {
+	s := newSession(t, sample)
+	inside := s.position("textDocument/completion", 5, 10)
+	outside := s.position("textDocument/completion", 6, 2)
+	messages := s.run()
+
+	labels := func(id int) map[string]CompletionItem {
+		var items []CompletionItem
+		result(t, messages, id, &items)
+		m := map[string]CompletionItem{}
+		for _, item := range items {
+			m[item.Label] = item
+		}
+		return m
+	}
+
+	in := labels(inside)
+	for _, name := range []string{"double", "adder", "日本", "len", "puts", "map", "let", "a", "b", "c"} {
+		if _, ok := in[name]; !ok {
+			t.Errorf("completion inside function does not contain %s", name)
+		}
+	}
+	if in["double"].Kind != CompletionFunction || in["double"].Detail != "let double = fn(x)" {
+		t.Errorf("wrong completion item for double: %+v", in["double"])
+	}
+	if in["n"].Kind != CompletionVariable {
+		t.Errorf("wrong completion item for n: %+v", in["n"])
+	}
+
+	out := labels(outside)
+	for _, name := range []string{"a", "b", "c", "x"} {
+		if _, ok := out[name]; ok {
+			t.Errorf("completion outside function contains local %s", name)
+		}
+	}
+}
+
+func TestDocumentSymbols(t *testing.T) {
+	s := newSession(t, sample)
+	id := s.request("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: testURI}})
+	messages := s.run()
+
+	var symbols []DocumentSymbol
+	result(t, messages, id, &symbols)
+
+	got := []string{}
+	var collect func(prefix string, symbols []DocumentSymbol)
+	collect = func(prefix string, symbols []DocumentSymbol) {
+		for _, sym := range symbols {
+			got = append(got, fmt.Sprintf("%s%s:%d", prefix, sym.Name, sym.Kind))
+			collect(prefix+sym.Name+".", sym.Children)
+		}
+	}
+	collect("", symbols)
+
+	expected := []string{"double:12", "日本:13", "n:13", "adder:12", "adder.b:13"}
+	if strings.Join(got, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong symbols.\nwant=%v\ngot= %v", expected, got)
+	}
+
+	adder := symbols[3]
+	if adder.Range.Start != (Position{3, 0}) || adder.Range.End != (Position{6, 1}) {
+		t.Errorf("wrong range for adder: %+v", adder.Range)
+	}
+}
+
+func TestUTF16Positions(t *testing.T) {
+	// 😀 は UTF-16 で2コードユニット
+	s := newSession(t, `let s = "😀"; let v = s + w;`)
+	id := s.position("textDocument/definition", 0, 22)
+	messages := s.run()
+
+	diags := diagnostics(t, messages)
+	if len(diags) != 1 || diags[0].Range != (Range{Position{0, 26}, Position{0, 27}}) {
+		t.Fatalf("wrong diagnostics: %+v", diags)
+	}
+
+	var loc *Location
+	result(t, messages, id, &loc)
+	if loc == nil || loc.Range != (Range{Position{0, 4}, Position{0, 5}}) {
+		t.Errorf("wrong definition: %+v", loc)
+	}
+}
+
+func TestShutdownAndExit(t *testing.T) {
+	s := &session{t: t}
+	id := s.request("shutdown", nil)
+	s.notify("exit", nil)
+	s.request("textDocument/hover", nil) // exit の後は読まれない
+
+	messages := s.run()
+	if len(messages) != 1 || messages[0].ID == nil || *messages[0].ID != id || string(messages[0].Result) != "null" {
+		t.Errorf("wrong messages: %+v", messages)
+	}
+
+	s = &session{t: t}
+	s.notify("exit", nil)
+	if err := NewServer(&s.input, &bytes.Buffer{}).Run(); err != ErrExitWithoutShutdown {
+		t.Errorf("expected ErrExitWithoutShutdown, got=%v", err)
+	}
+}
+
+func TestUnknownMethod(t *testing.T) {
+	s := &session{t: t}
+	s.request("workspace/symbol", nil)
+	messages := s.run()
+
+	if len(messages) != 1 || messages[0].Error == nil || messages[0].Error.Code != codeMethodNotFound {
+		t.Errorf("expected method not found error, got=%+v", messages)
+	}
+}
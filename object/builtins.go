@@ -1,6 +1,13 @@
 package object
 
-import "fmt"
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
 
 var Builtins = []struct {
 	Name    string
@@ -15,9 +22,9 @@ var Builtins = []struct {
 
 			switch arg := args[0].(type) {
 			case *String:
-				return &Integer{Value: int64(len(arg.Value))}
+				return NewInteger(int64(utf8.RuneCountInString(arg.Value)))
 			case *Array:
-				return &Integer{Value: int64(len(arg.Elements))}
+				return NewInteger(int64(len(arg.Elements)))
 			default:
 				return newError("argument to `len` not supported, got %s", args[0].Type())
 			}
@@ -26,9 +33,9 @@ var Builtins = []struct {
 	},
 	{
 		"puts",
-		&Builtin{Fn: func(args ...Object) Object {
+		&Builtin{Write: func(out io.Writer, args ...Object) Object {
 			for _, arg := range args {
-				fmt.Println(arg.Inspect())
+				fmt.Fprintln(out, arg.Inspect())
 			}
 			return nil
 		},
@@ -99,16 +106,585 @@ var Builtins = []struct {
 			if args[0].Type() != ARRAY_OBJ {
 				return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
 			}
+			return args[0].(*Array).Push(args[1])
+		},
+		},
+	},
+	{
+		"range",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 || len(args) > 3 {
+				return newError("wrong number of arguments. got=%d, want=1..3", len(args))
+			}
+			bounds := make([]int64, len(args))
+			for i, arg := range args {
+				integer, ok := arg.(*Integer)
+				if !ok {
+					return newError("argument to `range` must be INTEGER, got %s", arg.Type())
+				}
+				bounds[i] = integer.Value
+			}
+
+			var start, end, step int64 = 0, 0, 1
+			switch len(bounds) {
+			case 1:
+				end = bounds[0]
+			case 2:
+				start, end = bounds[0], bounds[1]
+			case 3:
+				start, end, step = bounds[0], bounds[1], bounds[2]
+			}
+			if step == 0 {
+				return newError("step of `range` must not be 0")
+			}
+
+			elements := []Object{}
+			for i := start; (step > 0 && i < end) || (step < 0 && i > end); i += step {
+				elements = append(elements, NewInteger(i))
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"sort",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `sort` must be ARRAY, got %s", args[0].Type())
+			}
 			arr := args[0].(*Array)
 			length := len(arr.Elements)
 
-			newElements := make([]Object, length+1, length+1)
+			newElements := make([]Object, length, length)
 			copy(newElements, arr.Elements)
-			newElements[length] = args[1]
+			if length == 0 {
+				return &Array{Elements: newElements}
+			}
+
+			// 整数同士、文字列同士のみ比較できる
+			elemType := newElements[0].Type()
+			for _, el := range newElements {
+				if el.Type() != elemType || (elemType != INTEGER_OBJ && elemType != STRING_OBJ) {
+					return newError("elements of `sort` must be all INTEGER or all STRING, got %s", el.Type())
+				}
+			}
+
+			sort.SliceStable(newElements, func(i, j int) bool {
+				if elemType == INTEGER_OBJ {
+					return newElements[i].(*Integer).Value < newElements[j].(*Integer).Value
+				}
+				return newElements[i].(*String).Value < newElements[j].(*String).Value
+			})
 			return &Array{Elements: newElements}
 		},
 		},
 	},
+	{
+		"join",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `join` must be ARRAY, got %s", args[0].Type())
+			}
+			if args[1].Type() != STRING_OBJ {
+				return newError("separator of `join` must be STRING, got %s", args[1].Type())
+			}
+			arr := args[0].(*Array)
+
+			elements := make([]string, len(arr.Elements))
+			for i, el := range arr.Elements {
+				elements[i] = el.Inspect()
+			}
+			return &String{Value: strings.Join(elements, args[1].(*String).Value)}
+		},
+		},
+	},
+	{
+		"split",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != STRING_OBJ || args[1].Type() != STRING_OBJ {
+				return newError("arguments to `split` must be STRING, got %s and %s", args[0].Type(), args[1].Type())
+			}
+
+			parts := strings.Split(args[0].(*String).Value, args[1].(*String).Value)
+			elements := make([]Object, len(parts))
+			for i, part := range parts {
+				elements[i] = &String{Value: part}
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"keys",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `keys` must be HASH, got %s", args[0].Type())
+			}
+			hash := args[0].(*Hash)
+
+			elements := make([]Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Ordered() {
+				elements = append(elements, pair.Key)
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"values",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `values` must be HASH, got %s", args[0].Type())
+			}
+			hash := args[0].(*Hash)
+
+			elements := make([]Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Ordered() {
+				elements = append(elements, pair.Value)
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"set",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `set` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			// push と同様に元のハッシュは変更せず、新しいハッシュを返す
+			newHash := args[0].(*Hash).Copy()
+			newHash.Set(key, HashPair{Key: args[1], Value: args[2]})
+			return newHash
+		},
+		},
+	},
+	{
+		"trim",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `trim` must be STRING, got %s", args[0].Type())
+			}
+			return &String{Value: strings.TrimSpace(args[0].(*String).Value)}
+		},
+		},
+	},
+	{
+		"upper",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `upper` must be STRING, got %s", args[0].Type())
+			}
+			return &String{Value: strings.ToUpper(args[0].(*String).Value)}
+		},
+		},
+	},
+	{
+		"lower",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `lower` must be STRING, got %s", args[0].Type())
+			}
+			return &String{Value: strings.ToLower(args[0].(*String).Value)}
+		},
+		},
+	},
+	{
+		"contains",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `contains` must be STRING, got %s", args[1].Type())
+				}
+				return nativeBoolToBoolean(strings.Contains(arg.Value, sub.Value))
+			case *Array:
+				return nativeBoolToBoolean(indexOfElement(arg, args[1]) >= 0)
+			default:
+				return newError("argument to `contains` must be STRING or ARRAY, got %s", args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"replace",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=3", len(args))
+			}
+			for _, arg := range args {
+				if arg.Type() != STRING_OBJ {
+					return newError("arguments to `replace` must be STRING, got %s", arg.Type())
+				}
+			}
+			str, old, new := args[0].(*String), args[1].(*String), args[2].(*String)
+			return &String{Value: strings.ReplaceAll(str.Value, old.Value, new.Value)}
+		},
+		},
+	},
+	{
+		"startsWith",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != STRING_OBJ || args[1].Type() != STRING_OBJ {
+				return newError("arguments to `startsWith` must be STRING, got %s and %s", args[0].Type(), args[1].Type())
+			}
+			return nativeBoolToBoolean(strings.HasPrefix(args[0].(*String).Value, args[1].(*String).Value))
+		},
+		},
+	},
+	{
+		"indexOf",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			switch arg := args[0].(type) {
+			case *String:
+				sub, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `indexOf` must be STRING, got %s", args[1].Type())
+				}
+				return NewInteger(int64(runeIndex(arg.Value, sub.Value)))
+			case *Array:
+				return NewInteger(int64(indexOfElement(arg, args[1])))
+			default:
+				return newError("argument to `indexOf` must be STRING or ARRAY, got %s", args[0].Type())
+			}
+		},
+		},
+	},
+	{
+		"format",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) < 1 {
+				return newError("wrong number of arguments. got=%d, want>=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("first argument to `format` must be STRING, got %s", args[0].Type())
+			}
+
+			// "{}" を順に引数の Inspect() で置き換える
+			parts := strings.Split(args[0].(*String).Value, "{}")
+			values := args[1:]
+			if len(parts)-1 != len(values) {
+				return newError("wrong number of arguments to `format`. placeholders=%d, got=%d", len(parts)-1, len(values))
+			}
+
+			var out strings.Builder
+			for i, part := range parts {
+				out.WriteString(part)
+				if i < len(values) {
+					out.WriteString(values[i].Inspect())
+				}
+			}
+			return &String{Value: out.String()}
+		},
+		},
+	},
+	{
+		"chars",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != STRING_OBJ {
+				return newError("argument to `chars` must be STRING, got %s", args[0].Type())
+			}
+
+			runes := []rune(args[0].(*String).Value)
+			elements := make([]Object, len(runes))
+			for i, r := range runes {
+				elements[i] = &String{Value: string(r)}
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"str",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if str, ok := args[0].(*String); ok {
+				return str
+			}
+			return &String{Value: args[0].Inspect()}
+		},
+		},
+	},
+	{
+		"assert",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			if args[0] != TRUE && args[0] != FALSE {
+				return newError("argument to `assert` must be BOOLEAN, got %s", args[0].Type())
+			}
+			if args[0] == FALSE {
+				return assertionError("assertion failed", args[1:])
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"assertEqual",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 && len(args) != 3 {
+				return newError("wrong number of arguments. got=%d, want=2 or 3", len(args))
+			}
+			if !Equal(args[0], args[1]) {
+				return assertionError(fmt.Sprintf("got %s, want %s", describe(args[0]), describe(args[1])), args[2:])
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"assertError",
+		&Builtin{Call: func(call Caller, args ...Object) Object {
+			if len(args) != 1 && len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=1 or 2", len(args))
+			}
+			var want string
+			if len(args) == 2 {
+				s, ok := args[1].(*String)
+				if !ok {
+					return newError("second argument to `assertError` must be STRING, got %s", args[1].Type())
+				}
+				want = s.Value
+			}
+
+			result := call(args[0])
+			if result == nil {
+				result = NULL
+			}
+			err, ok := result.(*Error)
+			switch {
+			case !ok:
+				return assertionError(fmt.Sprintf("expected an error, got %s", describe(result)), nil)
+			case !strings.Contains(err.Message, want):
+				return assertionError(fmt.Sprintf("error %q does not contain %q", err.Message, want), nil)
+			}
+			return nil
+		},
+		},
+	},
+	{
+		"entries",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `entries` must be HASH, got %s", args[0].Type())
+			}
+			hash := args[0].(*Hash)
+
+			elements := make([]Object, 0, len(hash.Pairs))
+			for _, pair := range hash.Ordered() {
+				elements = append(elements, &Array{Elements: []Object{pair.Key, pair.Value}})
+			}
+			return &Array{Elements: elements}
+		},
+		},
+	},
+	{
+		"delete",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `delete` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+
+			// set と同様に元のハッシュは変更せず、新しいハッシュを返す
+			newHash := args[0].(*Hash).Copy()
+			newHash.Delete(key)
+			return newHash
+		},
+		},
+	},
+	{
+		"has",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `has` must be HASH, got %s", args[0].Type())
+			}
+			key, ok := HashKeyOf(args[1])
+			if !ok {
+				return newError("unusable as hash key: %s", args[1].Type())
+			}
+			_, ok = args[0].(*Hash).Pairs[key]
+			return nativeBoolToBoolean(ok)
+		},
+		},
+	},
+	{
+		"merge",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ || args[1].Type() != HASH_OBJ {
+				return newError("arguments to `merge` must be HASH, got %s and %s", args[0].Type(), args[1].Type())
+			}
+
+			// set を繰り返すとペアごとにハッシュ全体をコピーするので、一度だけコピーして書き足す
+			merged := args[0].(*Hash).Copy()
+			for _, pair := range args[1].(*Hash).Ordered() {
+				key, _ := HashKeyOf(pair.Key)
+				merged.Set(key, pair)
+			}
+			return merged
+		},
+		},
+	},
+	{
+		"fromPairs",
+		&Builtin{Fn: func(args ...Object) Object {
+			if len(args) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1", len(args))
+			}
+			if args[0].Type() != ARRAY_OBJ {
+				return newError("argument to `fromPairs` must be ARRAY, got %s", args[0].Type())
+			}
+			elements := args[0].(*Array).Elements
+
+			hash := NewHash(len(elements))
+			for _, el := range elements {
+				pair, ok := el.(*Array)
+				if !ok || len(pair.Elements) != 2 {
+					return newError("elements of `fromPairs` must be [key, value], got %s", el.Inspect())
+				}
+				key, ok := HashKeyOf(pair.Elements[0])
+				if !ok {
+					return newError("unusable as hash key: %s", pair.Elements[0].Type())
+				}
+				hash.Set(key, HashPair{Key: pair.Elements[0], Value: pair.Elements[1]})
+			}
+			return hash
+		},
+		},
+	},
+	{
+		"mapValues",
+		&Builtin{Call: func(call Caller, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `mapValues` must be HASH, got %s", args[0].Type())
+			}
+			pairs := args[0].(*Hash).Ordered()
+
+			hash := NewHash(len(pairs))
+			for _, pair := range pairs {
+				value := call(args[1], pair.Value)
+				if err, ok := value.(*Error); ok {
+					return err
+				}
+				if value == nil {
+					value = NULL
+				}
+				key, _ := HashKeyOf(pair.Key)
+				hash.Set(key, HashPair{Key: pair.Key, Value: value})
+			}
+			return hash
+		},
+		},
+	},
+	{
+		"filterValues",
+		&Builtin{Call: func(call Caller, args ...Object) Object {
+			if len(args) != 2 {
+				return newError("wrong number of arguments. got=%d, want=2", len(args))
+			}
+			if args[0].Type() != HASH_OBJ {
+				return newError("argument to `filterValues` must be HASH, got %s", args[0].Type())
+			}
+			pairs := args[0].(*Hash).Ordered()
+
+			hash := NewHash(len(pairs))
+			for _, pair := range pairs {
+				keep := call(args[1], pair.Value)
+				if err, ok := keep.(*Error); ok {
+					return err
+				}
+				if isTruthy(keep) {
+					key, _ := HashKeyOf(pair.Key)
+					hash.Set(key, pair)
+				}
+			}
+			return hash
+		},
+		},
+	},
+}
+
+// assertionError はアサーションの失敗を表すエラーを返す。args に説明の文字列があれば加える
+func assertionError(message string, args []Object) *Error {
+	if len(args) > 0 {
+		message += ": " + args[0].Inspect()
+	}
+	return &Error{Message: message, Assertion: true}
+}
+
+// describe はアサーションの失敗の説明に使う形式で値を文字列にする。文字列は引用符で囲む
+func describe(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return strconv.Quote(s.Value)
+	}
+	return obj.Inspect()
 }
 
 func GetBuiltinByName(name string) *Builtin {
@@ -120,6 +696,54 @@ func GetBuiltinByName(name string) *Builtin {
 	return nil
 }
 
+// BuiltinIndex は組み込み関数の Builtins 内の位置を返す。見つからない場合は -1
+func BuiltinIndex(name string) int {
+	for i, def := range Builtins {
+		if def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// 文字列中で sub が最初に現れる位置をルーン単位で返す。見つからない場合は -1
+func runeIndex(s, sub string) int {
+	i := strings.Index(s, sub)
+	if i < 0 {
+		return -1
+	}
+	return utf8.RuneCountInString(s[:i])
+}
+
+// 配列中で value と等しい最初の要素の添字を返す。見つからない場合は -1
+func indexOfElement(arr *Array, value Object) int {
+	for i, el := range arr.Elements {
+		if Equal(el, value) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isTruthy は if の条件と同じく、null と false 以外を真とする
+func isTruthy(obj Object) bool {
+	switch obj := obj.(type) {
+	case *Boolean:
+		return obj.Value
+	case *Null, nil:
+		return false
+	default:
+		return true
+	}
+}
+
+func nativeBoolToBoolean(input bool) *Boolean {
+	if input {
+		return TRUE
+	}
+	return FALSE
+}
+
 func newError(format string, a ...interface{}) *Error {
 	return &Error{Message: fmt.Sprintf(format, a...)}
 }
@@ -1,22 +1,98 @@
 package object
 
+import (
+	"io"
+	"monkey/ast"
+	"os"
+)
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Object)
-	return &Environment{store: s}
+	return &Environment{store: s, evaluation: &evaluation{}}
 
 }
 
 // 現在の環境を包含する新しい環境を作成する
 // 関数呼び出しなどの変数の束縛は、この新しい環境に保存することで、元の環境が変更されないようにする
 func NewEnclosedEnvironment(outer *Environment) *Environment {
-	env := NewEnvironment()
-	env.outer = outer
-	return env
+	return &Environment{store: make(map[string]Object), outer: outer, evaluation: outer.evaluation}
 }
 
 type Environment struct {
 	store map[string]Object
 	outer *Environment
+
+	// NewEnvironment で作った環境と、それを包含して作った環境がすべて共有する評価の設定
+	evaluation *evaluation
+}
+
+// evaluation はひとつの評価に固有の設定。
+// パッケージ変数にすると、同時に行う評価や別の利用者の評価にまで設定が及ぶので、環境に持たせる
+type evaluation struct {
+	tracer Tracer
+	output io.Writer
+}
+
+// Tracer は評価器による評価の様子を観察する。
+// Enter は節を評価する前に、Exit は評価した後に結果とともに呼ばれる。
+// Call と Return は関数の本体を評価する前と後に呼ばれる
+type Tracer interface {
+	Enter(node ast.Node)
+	Exit(node ast.Node, result Object)
+	Call(fn *Function)
+	Return(fn *Function)
+}
+
+// Tracers は複数の Tracer に順に通知する Tracer
+type Tracers []Tracer
+
+func (t Tracers) Enter(node ast.Node) {
+	for _, tracer := range t {
+		tracer.Enter(node)
+	}
+}
+
+func (t Tracers) Exit(node ast.Node, result Object) {
+	for _, tracer := range t {
+		tracer.Exit(node, result)
+	}
+}
+
+func (t Tracers) Call(fn *Function) {
+	for _, tracer := range t {
+		tracer.Call(fn)
+	}
+}
+
+func (t Tracers) Return(fn *Function) {
+	for _, tracer := range t {
+		tracer.Return(fn)
+	}
+}
+
+// SetTracer は環境を使う評価を観察する Tracer を設定する。nil を渡すと取り外す。
+// 同じ NewEnvironment から作られた環境すべてに適用される
+func (e *Environment) SetTracer(t Tracer) {
+	e.evaluation.tracer = t
+}
+
+// Tracer は環境を使う評価を観察する Tracer を返す。設定されていなければ nil
+func (e *Environment) Tracer() Tracer {
+	return e.evaluation.tracer
+}
+
+// SetOutput は環境を使う評価で puts が書き出す先を設定する。nil を渡すと標準出力に戻す。
+// 同じ NewEnvironment から作られた環境すべてに適用される
+func (e *Environment) SetOutput(w io.Writer) {
+	e.evaluation.output = w
+}
+
+// Output は環境を使う評価で puts が書き出す先を返す
+func (e *Environment) Output() io.Writer {
+	if e.evaluation.output == nil {
+		return os.Stdout
+	}
+	return e.evaluation.output
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -0,0 +1,90 @@
+package object
+
+// Equal は == 演算子と assertEqual が使う値の等しさを返す。どちらのエンジンもこの定義で比べる。
+//
+//   - 整数、真偽値、文字列は値が等しければ等しい。null は null とだけ等しい
+//   - 配列は長さが同じで、同じ位置の要素がすべて等しければ等しい
+//   - ハッシュは同じキーの組を持ち、それぞれの値が等しければ等しい。組の順序は比べない
+//   - エラーはメッセージが、return の値は中身が等しければ等しい
+//   - 関数と組み込み関数は同じものだけが等しい
+//
+// 型が異なる値は等しくない。nil は null として扱う。
+// Go のコードで作った、自分自身を含む配列やハッシュでも停止する
+func Equal(a, b Object) bool {
+	return equal(a, b, nil)
+}
+
+// comparing は比べている途中の配列とハッシュの組。
+// 同じ組をもう一度比べることになったら、循環しているので等しいと仮定する
+type comparing map[[2]Object]bool
+
+func equal(a, b Object, seen comparing) bool {
+	if a == nil {
+		a = NULL
+	}
+	if b == nil {
+		b = NULL
+	}
+	if a == b {
+		return true
+	}
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *Boolean:
+		return a.Value == b.(*Boolean).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Null:
+		return true
+	case *Error:
+		return a.Message == b.(*Error).Message
+	case *ReturnValue:
+		return equal(a.Value, b.(*ReturnValue).Value, seen)
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		if seen, ok := seen.enter(a, b); ok {
+			for i := range a.Elements {
+				if !equal(a.Elements[i], b.Elements[i], seen) {
+					return false
+				}
+			}
+		}
+		return true
+	case *Hash:
+		b := b.(*Hash)
+		if len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		if seen, ok := seen.enter(a, b); ok {
+			for key, pair := range a.Pairs {
+				other, ok := b.Pairs[key]
+				if !ok || !equal(pair.Value, other.Value, seen) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// enter は a と b を比べ始めたことを記録する。既に比べている途中なら false を返す
+func (seen comparing) enter(a, b Object) (comparing, bool) {
+	if seen == nil {
+		seen = comparing{}
+	}
+	pair := [2]Object{a, b}
+	if seen[pair] {
+		return seen, false
+	}
+	seen[pair] = true
+	return seen, true
+}
@@ -3,9 +3,10 @@ package object
 import (
 	"bytes"
 	"fmt"
-	"hash/fnv"
+	"io"
 	"monkey/ast"
 	"monkey/code"
+	"sort"
 	"strings"
 )
 
@@ -27,6 +28,14 @@ const (
 	CLOSURE               = "CLOSURE"
 )
 
+// 真偽値と null は evaluator と vm で共有する単一のインスタンスを使う。
+// 両エンジンとも同一性で比較するため、組み込み関数もこれらを返す必要がある。
+var (
+	TRUE  = &Boolean{Value: true}
+	FALSE = &Boolean{Value: false}
+	NULL  = &Null{}
+)
+
 type Object interface {
 	Type() ObjectType
 	Inspect() string
@@ -43,6 +52,30 @@ type Integer struct {
 func (i *Integer) Inspect() string  { return fmt.Sprintf("%d", i.Value) }
 func (i *Integer) Type() ObjectType { return INTEGER_OBJ }
 
+// NewInteger が共有のインスタンスを返す整数の範囲。ループの添字や再帰の引数などに現れる小さい値
+const (
+	MinSmallInteger = -128
+	MaxSmallInteger = 1023
+)
+
+// smallIntegers は小さい整数のインスタンス。Integer は作った後に変更しないので、同じ値のものを共有できる
+var smallIntegers = func() []Integer {
+	integers := make([]Integer, MaxSmallInteger-MinSmallInteger+1)
+	for i := range integers {
+		integers[i].Value = int64(i + MinSmallInteger)
+	}
+	return integers
+}()
+
+// NewInteger は value の Integer を返す。小さい整数では共有のインスタンスを返し、演算のたびにメモリを確保しない。
+// 整数は値で比べるので、同じ値の Integer が同じインスタンスかどうかに依存してはいけない
+func NewInteger(value int64) *Integer {
+	if value >= MinSmallInteger && value <= MaxSmallInteger {
+		return &smallIntegers[value-MinSmallInteger]
+	}
+	return &Integer{Value: value}
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -63,7 +96,8 @@ func (rv *ReturnValue) Type() ObjectType { return RETURN_VALUE_OBJ }
 func (rv *ReturnValue) Inspect() string  { return rv.Value.Inspect() }
 
 type Error struct {
-	Message string
+	Message   string
+	Assertion bool // assert、assertEqual、assertError が失敗を表すために返したエラー
 }
 
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
@@ -73,6 +107,7 @@ type Function struct {
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
+	Name       string // let で束縛した関数の名前。無名関数では空
 }
 
 func (f *Function) Type() ObjectType { return FUNCTION_OBJ }
@@ -101,8 +136,20 @@ type String struct {
 func (s *String) Type() ObjectType { return STRING_OBJ }
 func (s *String) Inspect() string  { return s.Value }
 
+// Caller calls a function from a builtin function. The evaluator and the VM provide their own.
+type Caller func(fn Object, args ...Object) Object
+
+// CallingFunction is a builtin function that calls the functions given as arguments.
+type CallingFunction func(call Caller, args ...Object) Object
+
+// WritingFunction is a builtin function that writes output. The evaluator and the VM pass the
+// writer of the running program, so that programs running at the same time don't share it.
+type WritingFunction func(out io.Writer, args ...Object) Object
+
 type Builtin struct {
-	Fn BuiltinFunction
+	Fn    BuiltinFunction
+	Call  CallingFunction // Set instead of Fn if the builtin calls functions
+	Write WritingFunction // Set instead of Fn if the builtin writes output
 }
 
 func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
@@ -110,6 +157,27 @@ func (b *Builtin) Inspect() string  { return "builtin function" }
 
 type Array struct {
 	Elements []Object
+
+	// filled は Elements の背後の配列のうち、要素が書き込まれている長さ。Push で作った配列の間で共有する。
+	// Elements の長さが filled と等しい配列だけが空き容量にその場で書き足せるので、
+	// 他の配列から見える要素は変わらない。Elements に直接 append してはいけない
+	filled *int
+}
+
+// Push は末尾に obj を追加した配列を返す。ao 自身は変わらない。
+// 最後に追加した配列に続けて追加する場合は要素をコピーしないので、push を繰り返して配列を作っても線形時間で済む
+func (ao *Array) Push(obj Object) *Array {
+	length := len(ao.Elements)
+	if ao.filled != nil && *ao.filled == length && length < cap(ao.Elements) {
+		*ao.filled++
+		return &Array{Elements: append(ao.Elements, obj), filled: ao.filled}
+	}
+
+	elements := make([]Object, length+1, 2*(length+1))
+	copy(elements, ao.Elements)
+	elements[length] = obj
+	filled := length + 1
+	return &Array{Elements: elements, filled: &filled}
 }
 
 func (ao *Array) Type() ObjectType { return ARRAY_OBJ }
@@ -128,9 +196,13 @@ func (ao *Array) Inspect() string {
 	return out.String()
 }
 
+// HashKey はハッシュのキーにした値を、Go のマップのキーとして比べられる形で表す。
+// 整数と真偽値は Value に、文字列、配列、ハッシュは Data に値そのものを持つので、
+// 2つの HashKey が等しいのはキーにした値が等しいときに限る。ハッシュ値が衝突して別のキーと取り違えることはない
 type HashKey struct {
 	Type  ObjectType
 	Value uint64
+	Data  string
 }
 
 func (b *Boolean) HashKey() HashKey {
@@ -149,9 +221,50 @@ func (i *Integer) HashKey() HashKey {
 }
 
 func (s *String) HashKey() HashKey {
-	h := fnv.New64a()
-	h.Write([]byte(s.Value))
-	return HashKey{Type: s.Type(), Value: h.Sum64()}
+	return HashKey{Type: s.Type(), Data: s.Value}
+}
+
+// HashKeyOf は値をハッシュのキーにする。Hashable な値に加えて、
+// 要素がすべてキーにできる配列と、値がすべてキーにできるハッシュもキーにできる。
+// 配列とハッシュは作った後に変更できないので、キーにしたあとで値が変わることはない。
+// キーにできない値には false を返す
+func HashKeyOf(obj Object) (HashKey, bool) {
+	switch obj := obj.(type) {
+	case Hashable:
+		return obj.HashKey(), true
+	case *Array:
+		var b strings.Builder
+		for _, e := range obj.Elements {
+			key, ok := HashKeyOf(e)
+			if !ok {
+				return HashKey{}, false
+			}
+			key.encode(&b)
+		}
+		return HashKey{Type: obj.Type(), Value: uint64(len(obj.Elements)), Data: b.String()}, true
+	case *Hash:
+		// 同じ組を持つハッシュは、組の順序によらず同じキーにする
+		pairs := make([]string, 0, len(obj.Pairs))
+		for key, pair := range obj.Pairs {
+			value, ok := HashKeyOf(pair.Value)
+			if !ok {
+				return HashKey{}, false
+			}
+			var b strings.Builder
+			key.encode(&b)
+			value.encode(&b)
+			pairs = append(pairs, b.String())
+		}
+		sort.Strings(pairs)
+		return HashKey{Type: obj.Type(), Value: uint64(len(pairs)), Data: strings.Join(pairs, "")}, true
+	}
+	return HashKey{}, false
+}
+
+// encode は配列やハッシュのキーの一部としてキーを書く。
+// Data の長さを前に書くので、続けて書いたキーの境目が曖昧になることはない
+func (k HashKey) encode(b *strings.Builder) {
+	fmt.Fprintf(b, "%s:%d:%d:%s", k.Type, k.Value, len(k.Data), k.Data)
 }
 
 type HashPair struct {
@@ -159,8 +272,73 @@ type HashPair struct {
 	Value Object
 }
 
+// Hash は組を挿入した順に保持するハッシュ。
+// Pairs でキーから組を引き、Keys で挿入した順に辿る。組を追加・削除するときは Set と Delete を使って両方を揃える
 type Hash struct {
 	Pairs map[HashKey]HashPair
+	Keys  []HashKey // 挿入した順のキー
+}
+
+// NewHash は size 個の組を入れられる空のハッシュを返す
+func NewHash(size int) *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair, size), Keys: make([]HashKey, 0, size)}
+}
+
+// Set は key の組を追加する。key は pair.Key の HashKeyOf の値。既にあるキーなら値を置き換え、順序は変えない
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+// Delete はキーの組を取り除く。残りの組の順序は変えない
+func (h *Hash) Delete(key HashKey) {
+	if _, ok := h.Pairs[key]; !ok {
+		return
+	}
+	delete(h.Pairs, key)
+	for i, k := range h.Keys {
+		if k == key {
+			h.Keys = append(h.Keys[:i:i], h.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+// Copy は同じ組を同じ順序で持つ新しいハッシュを返す
+func (h *Hash) Copy() *Hash {
+	copied := NewHash(len(h.Pairs))
+	for _, pair := range h.Ordered() {
+		key, _ := HashKeyOf(pair.Key)
+		copied.Set(key, pair)
+	}
+	return copied
+}
+
+// Ordered は組を挿入した順に返す。
+// Keys を使わずに Pairs だけで作ったハッシュでは、Keys にない組をキーの表示の順に後ろに並べる
+func (h *Hash) Ordered() []HashPair {
+	pairs := make([]HashPair, 0, len(h.Pairs))
+	seen := make(map[HashKey]bool, len(h.Keys))
+	for _, key := range h.Keys {
+		if pair, ok := h.Pairs[key]; ok && !seen[key] {
+			seen[key] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	if len(pairs) == len(h.Pairs) {
+		return pairs
+	}
+
+	rest := []HashPair{}
+	for key, pair := range h.Pairs {
+		if !seen[key] {
+			rest = append(rest, pair)
+		}
+	}
+	sort.Slice(rest, func(i, j int) bool { return rest[i].Key.Inspect() < rest[j].Key.Inspect() })
+	return append(pairs, rest...)
 }
 
 func (h *Hash) Type() ObjectType { return HASH_OBJ }
@@ -168,7 +346,7 @@ func (h *Hash) Inspect() string {
 	var out bytes.Buffer
 
 	pairs := []string{}
-	for _, pair := range h.Pairs {
+	for _, pair := range h.Ordered() {
 		pairs = append(pairs, fmt.Sprintf("%s: %s", pair.Key.Inspect(), pair.Value.Inspect()))
 	}
 
@@ -183,6 +361,18 @@ type CompiledFunction struct {
 	Instructions  code.Instructions
 	NumLocals     int // Number of local variables the function uses. note: this includes the function's arguments.
 	NumParameters int // Number of parameters the function takes
+
+	// Fused is Instructions with superinstructions, as returned by code.Fuse. It has the same
+	// offsets as Instructions. The VM runs it instead of Instructions when no hook is attached.
+	// nil if the function has not been fused.
+	Fused code.Instructions
+
+	// Debug information. These are not needed to run the function.
+	Name       string         // The name bound by a let statement. Empty for anonymous functions.
+	SourceMap  code.SourceMap // Maps instruction offsets to source lines
+	Branches   code.SourceMap // Maps offsets of OpJumpNotTruthy to the if expressions
+	LocalNames []string       // Names of the local variables indexed by OpGetLocal's operand
+	FreeNames  []string       // Names of the free variables indexed by OpGetFree's operand
 }
 
 func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
@@ -20,3 +20,209 @@ func TestStringHashKey(t *testing.T) {
 		t.Errorf("strings with different content have same hash keys")
 	}
 }
+
+func TestHashOrder(t *testing.T) {
+	str := func(s string) *String { return &String{Value: s} }
+	hash := NewHash(0)
+	hash.Set(str("b").HashKey(), HashPair{Key: str("b"), Value: &Integer{Value: 1}})
+	hash.Set(str("a").HashKey(), HashPair{Key: str("a"), Value: &Integer{Value: 2}})
+	hash.Set(str("c").HashKey(), HashPair{Key: str("c"), Value: &Integer{Value: 3}})
+	hash.Set(str("b").HashKey(), HashPair{Key: str("b"), Value: &Integer{Value: 4}})
+
+	if got := hash.Inspect(); got != "{b: 4, a: 2, c: 3}" {
+		t.Errorf("wrong order after Set. got=%s", got)
+	}
+
+	copied := hash.Copy()
+	hash.Delete(str("a").HashKey())
+	hash.Delete(str("x").HashKey())
+	if got := hash.Inspect(); got != "{b: 4, c: 3}" {
+		t.Errorf("wrong order after Delete. got=%s", got)
+	}
+	if got := copied.Inspect(); got != "{b: 4, a: 2, c: 3}" {
+		t.Errorf("Delete changed the copy. got=%s", got)
+	}
+	if len(hash.Pairs) != len(hash.Keys) {
+		t.Errorf("Pairs and Keys have different lengths. %d != %d", len(hash.Pairs), len(hash.Keys))
+	}
+
+	// Keys を持たないハッシュはキーの表示の順に並べる
+	unordered := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []string{"y", "z", "x"} {
+		unordered.Pairs[str(key).HashKey()] = HashPair{Key: str(key), Value: NULL}
+	}
+	if got := unordered.Inspect(); got != "{x: null, y: null, z: null}" {
+		t.Errorf("wrong order without Keys. got=%s", got)
+	}
+}
+
+func TestHashKeyOf(t *testing.T) {
+	str := func(s string) Object { return &String{Value: s} }
+	integer := func(i int64) Object { return &Integer{Value: i} }
+	array := func(elements ...Object) Object { return &Array{Elements: elements} }
+	hash := func(pairs ...Object) Object {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, _ := HashKeyOf(pairs[i])
+			h.Set(key, HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+
+	tests := []struct {
+		a, b  Object
+		equal bool
+	}{
+		{array(integer(1), str("a")), array(integer(1), str("a")), true},
+		{array(integer(1), integer(2)), array(integer(2), integer(1)), false},
+		{array(str("a")), str("a"), false},
+		{array(), hash(), false},
+		{array(str("ab"), str("c")), array(str("a"), str("bc")), false},
+		{array(array(integer(1)), integer(2)), array(integer(1), array(integer(2))), false},
+		{array(integer(1)), array(TRUE), false},
+		{hash(str("a"), integer(1), str("b"), integer(2)), hash(str("b"), integer(2), str("a"), integer(1)), true},
+		{hash(str("a"), integer(1)), hash(str("a"), integer(2)), false},
+		{hash(array(integer(1)), hash()), hash(array(integer(1)), hash()), true},
+		{str("1"), integer(1), false},
+	}
+
+	for _, tt := range tests {
+		a, ok := HashKeyOf(tt.a)
+		if !ok {
+			t.Fatalf("%s is not hashable", tt.a.Inspect())
+		}
+		b, ok := HashKeyOf(tt.b)
+		if !ok {
+			t.Fatalf("%s is not hashable", tt.b.Inspect())
+		}
+		if (a == b) != tt.equal {
+			t.Errorf("HashKeyOf(%s) == HashKeyOf(%s) is %t, want %t", tt.a.Inspect(), tt.b.Inspect(), a == b, tt.equal)
+		}
+	}
+
+	unhashable := []Object{
+		&Builtin{},
+		NULL,
+		array(integer(1), &Builtin{}),
+		hash(str("f"), &Builtin{}),
+	}
+	for _, obj := range unhashable {
+		if _, ok := HashKeyOf(obj); ok {
+			t.Errorf("%s (%T) should not be hashable", obj.Inspect(), obj)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	str := func(s string) Object { return &String{Value: s} }
+	integer := func(i int64) Object { return &Integer{Value: i} }
+	array := func(elements ...Object) *Array { return &Array{Elements: elements} }
+	hash := func(pairs ...Object) *Hash {
+		h := NewHash(len(pairs) / 2)
+		for i := 0; i < len(pairs); i += 2 {
+			key, _ := HashKeyOf(pairs[i])
+			h.Set(key, HashPair{Key: pairs[i], Value: pairs[i+1]})
+		}
+		return h
+	}
+	builtin := &Builtin{}
+
+	// 自分自身を含む配列とハッシュ
+	cyclic1, cyclic2 := array(integer(1)), array(integer(1))
+	cyclic1.Elements = append(cyclic1.Elements, cyclic1)
+	cyclic2.Elements = append(cyclic2.Elements, cyclic2)
+	cyclic3 := array(integer(2))
+	cyclic3.Elements = append(cyclic3.Elements, cyclic3)
+	selfHash1, selfHash2 := hash(), hash()
+	selfHash1.Set(str("self").(Hashable).HashKey(), HashPair{Key: str("self"), Value: selfHash1})
+	selfHash2.Set(str("self").(Hashable).HashKey(), HashPair{Key: str("self"), Value: selfHash2})
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{integer(1), integer(1), true},
+		{integer(1), integer(2), false},
+		{integer(1), str("1"), false},
+		{str("a"), str("a"), true},
+		{str("a"), str("b"), false},
+		{TRUE, &Boolean{Value: true}, true},
+		{TRUE, FALSE, false},
+		{NULL, nil, true},
+		{NULL, &Null{}, true},
+		{NULL, FALSE, false},
+		{array(), array(), true},
+		{array(integer(1), str("a")), array(integer(1), str("a")), true},
+		{array(integer(1)), array(integer(1), integer(1)), false},
+		{array(array(integer(1))), array(array(integer(2))), false},
+		{hash(str("a"), integer(1), str("b"), array()), hash(str("b"), array(), str("a"), integer(1)), true},
+		{hash(str("a"), integer(1)), hash(str("a"), integer(2)), false},
+		{hash(str("a"), integer(1)), hash(str("b"), integer(1)), false},
+		{hash(), array(), false},
+		{&Error{Message: "x"}, &Error{Message: "x"}, true},
+		{&ReturnValue{Value: integer(1)}, &ReturnValue{Value: integer(1)}, true},
+		{builtin, builtin, true},
+		{builtin, &Builtin{}, false},
+		{&Closure{Fn: &CompiledFunction{}}, &Closure{Fn: &CompiledFunction{}}, false},
+		{cyclic1, cyclic2, true},
+		{cyclic1, cyclic3, false},
+		{selfHash1, selfHash2, true},
+	}
+
+	for i, tt := range tests {
+		if got := Equal(tt.a, tt.b); got != tt.expected {
+			t.Errorf("tests[%d]: Equal is %t, want %t", i, got, tt.expected)
+		}
+		if got := Equal(tt.b, tt.a); got != tt.expected {
+			t.Errorf("tests[%d]: Equal is not symmetric", i)
+		}
+	}
+}
+
+func TestNewInteger(t *testing.T) {
+	for _, v := range []int64{MinSmallInteger - 1, MinSmallInteger, -1, 0, 1, MaxSmallInteger, MaxSmallInteger + 1, 1 << 40} {
+		a, b := NewInteger(v), NewInteger(v)
+		if a.Value != v {
+			t.Errorf("NewInteger(%d) has wrong value. got=%d", v, a.Value)
+		}
+		small := v >= MinSmallInteger && v <= MaxSmallInteger
+		if (a == b) != small {
+			t.Errorf("NewInteger(%d) shares instances: %t, want %t", v, a == b, small)
+		}
+	}
+}
+
+func TestArrayPush(t *testing.T) {
+	a := &Array{Elements: []Object{NewInteger(1)}}
+	b := a.Push(NewInteger(2))
+	c := a.Push(NewInteger(3))
+	d := b.Push(NewInteger(4))
+	e := b.Push(NewInteger(5))
+	f := d.Push(NewInteger(6))
+
+	// 追加しても元の配列や、同じ配列から作った他の配列は変わらない
+	tests := []struct {
+		array    *Array
+		expected string
+	}{
+		{a, "[1]"},
+		{b, "[1, 2]"},
+		{c, "[1, 3]"},
+		{d, "[1, 2, 4]"},
+		{e, "[1, 2, 5]"},
+		{f, "[1, 2, 4, 6]"},
+	}
+	for _, tt := range tests {
+		if tt.array.Inspect() != tt.expected {
+			t.Errorf("wrong elements. want=%s, got=%s", tt.expected, tt.array.Inspect())
+		}
+	}
+
+	// 最後に追加した配列に続けて追加する場合は要素をコピーしない
+	if &d.Elements[0] != &b.Elements[0] || &f.Elements[0] != &b.Elements[0] {
+		t.Errorf("Push copied the elements of the last pushed array")
+	}
+	if &e.Elements[0] == &b.Elements[0] {
+		t.Errorf("Push wrote into the elements of another array")
+	}
+}
@@ -10,10 +10,12 @@ import (
 
 type Parser struct {
 	l         *lexer.Lexer
-	errors    []string
+	errors    []*lexer.Error
 	curToken  token.Token
 	peekToken token.Token
 
+	comments []*ast.Comment
+
 	prefixParseFns map[token.TokenType]prefixParseFn
 	infixParseFns  map[token.TokenType]infixParseFn
 }
@@ -53,7 +55,7 @@ var precedences = map[token.TokenType]int{
 func New(l *lexer.Lexer) *Parser {
 	p := &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*lexer.Error{},
 	}
 
 	// 前置構文解析関数の登録
@@ -68,6 +70,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(token.IF, p.parseIfExpression)
 	p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(token.STRING, p.parseStringLiteral)
+	p.registerPrefix(token.RAW_STRING, p.parseStringLiteral)
+	p.registerPrefix(token.TEMPLATE, p.parseTemplateLiteral)
 	p.registerPrefix(token.LBRAKET, p.parseArrayLiteral)
 	p.registerPrefix(token.LBRACE, p.parseHashLiteral)
 
@@ -93,7 +97,19 @@ func New(l *lexer.Lexer) *Parser {
 // トークン関連
 func (p *Parser) nextToken() {
 	p.curToken = p.peekToken
+	previous := p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// コメントは構文解析の対象にせず、Program.Comments に集める
+	for p.peekToken.Type == token.COMMENT {
+		p.comments = append(p.comments, &ast.Comment{
+			Token:    p.peekToken,
+			Text:     p.peekToken.Literal,
+			Trailing: previous.Type != "" && previous.Type != token.COMMENT && previous.Line == p.peekToken.Line,
+		})
+		previous = p.peekToken
+		p.peekToken = p.l.NextToken()
+	}
 }
 
 func (p *Parser) curTokenIs(t token.TokenType) bool {
@@ -114,6 +130,15 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 	}
 }
 
+// Precedence は中置演算子のトークンの優先順位を返す
+// 中置演算子でない場合は LOWEST を返す
+func Precedence(t token.TokenType) int {
+	if p, ok := precedences[t]; ok {
+		return p
+	}
+	return LOWEST
+}
+
 func (p *Parser) peekPrecedence() int {
 	if p, ok := precedences[p.peekToken.Type]; ok {
 		return p
@@ -128,13 +153,29 @@ func (p *Parser) curPrecedence() int {
 	return LOWEST
 }
 
+// 字句解析のエラーと構文解析のエラーを "行:列: メッセージ" の形式で返す
 func (p *Parser) Errors() []string {
-	return p.errors
+	diagnostics := p.Diagnostics()
+	messages := make([]string, len(diagnostics))
+	for i, err := range diagnostics {
+		messages[i] = err.Error()
+	}
+	return messages
+}
+
+// 字句解析のエラーと構文解析のエラーを位置情報付きで返す
+func (p *Parser) Diagnostics() []*lexer.Error {
+	errors := append([]*lexer.Error{}, p.l.Diagnostics()...)
+	return append(errors, p.errors...)
+}
+
+// tok の位置で構文解析のエラーを記録する
+func (p *Parser) error(tok token.Token, format string, a ...interface{}) {
+	p.errors = append(p.errors, &lexer.Error{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)})
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	p.error(p.peekToken, "expected next token to be %s, got %s instead", t, p.peekToken.Type)
 }
 
 // パース関連
@@ -149,13 +190,18 @@ func (p *Parser) ParseProgram() *ast.Program {
 		}
 		p.nextToken()
 	}
+	program.Comments = p.comments
 	return program
 }
 
 func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case token.LET:
-		return p.parseLetStatement()
+		// 解析に失敗した場合は型付きの nil ではなく nil を返す
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
 	case token.RETURN:
 		return p.parseReturnStatement()
 	default:
@@ -170,6 +216,7 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name.Type = p.parseTypeAnnotation()
 
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
@@ -213,8 +260,7 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 }
 
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.error(p.curToken, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) parseExpression(precedence int) ast.Expression {
@@ -256,8 +302,7 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.error(p.curToken, "could not parse %q as integer", p.curToken.Literal)
 		return nil
 	}
 	lit.Value = value
@@ -355,6 +400,7 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 		}
 		p.nextToken()
 	}
+	block.Rbrace = p.curToken
 
 	return block
 }
@@ -368,6 +414,12 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 
 	lit.Parameters = p.parseFunctionParameters()
 
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		lit.ReturnType = p.parseType()
+	}
+
 	if !p.expectPeek(token.LBRACE) {
 		return nil
 	}
@@ -388,12 +440,14 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	p.nextToken()
 
 	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	ident.Type = p.parseTypeAnnotation()
 	identifiers = append(identifiers, ident)
 
 	for p.peekTokenIs(token.COMMA) {
 		p.nextToken()
 		p.nextToken()
 		ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+		ident.Type = p.parseTypeAnnotation()
 		identifiers = append(identifiers, ident)
 	}
 
@@ -404,6 +458,87 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return identifiers
 }
 
+// 識別子に続く ": 型" を解析する。型注釈がなければ nil を返す
+func (p *Parser) parseTypeAnnotation() ast.Type {
+	if !p.peekTokenIs(token.COLON) {
+		return nil
+	}
+	p.nextToken()
+	p.nextToken()
+	return p.parseType()
+}
+
+// 型を解析する。curToken は型の最初のトークン
+//
+//	int  string  bool  null  any  [int]  {string: int}  fn(int, int) -> int
+func (p *Parser) parseType() ast.Type {
+	switch p.curToken.Type {
+	case token.IDENT:
+		return &ast.NamedType{Token: p.curToken, Name: p.curToken.Literal}
+	case token.LBRAKET:
+		t := &ast.ArrayType{Token: p.curToken}
+		p.nextToken()
+		if t.Element = p.parseType(); t.Element == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRAKET) {
+			return nil
+		}
+		return t
+	case token.LBRACE:
+		t := &ast.HashType{Token: p.curToken}
+		p.nextToken()
+		if t.Key = p.parseType(); t.Key == nil {
+			return nil
+		}
+		if !p.expectPeek(token.COLON) {
+			return nil
+		}
+		p.nextToken()
+		if t.Value = p.parseType(); t.Value == nil {
+			return nil
+		}
+		if !p.expectPeek(token.RBRACE) {
+			return nil
+		}
+		return t
+	case token.FUNCTION:
+		return p.parseFunctionType()
+	}
+
+	p.error(p.curToken, "expected type, got %s instead", p.curToken.Type)
+	return nil
+}
+
+func (p *Parser) parseFunctionType() ast.Type {
+	t := &ast.FunctionType{Token: p.curToken, Parameters: []ast.Type{}}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	for !p.peekTokenIs(token.RPAREN) {
+		if len(t.Parameters) > 0 && !p.expectPeek(token.COMMA) {
+			return nil
+		}
+		p.nextToken()
+		param := p.parseType()
+		if param == nil {
+			return nil
+		}
+		t.Parameters = append(t.Parameters, param)
+	}
+	p.nextToken()
+
+	if p.peekTokenIs(token.ARROW) {
+		p.nextToken()
+		p.nextToken()
+		if t.Return = p.parseType(); t.Return == nil {
+			return nil
+		}
+	}
+	return t
+}
+
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
 	exp.Arguments = p.parseExpressionList(token.RPAREN)
@@ -438,6 +573,71 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// 文字列補間を文字列の連結に脱糖する
+// "a ${x} b" は "a " + ${x} + " b" の連結になり、${x} は ast.Interpolation で表す。
+// フォーマッタが元の形を復元できるよう、最も外側のノードには TEMPLATE トークンを持たせる。
+func (p *Parser) parseTemplateLiteral() ast.Expression {
+	tok := p.curToken
+
+	var result ast.Expression
+	for _, part := range lexer.SplitTemplate(tok) {
+		var exp ast.Expression
+		if part.IsExpression {
+			exp = p.parseInterpolation(part)
+			if exp == nil {
+				return nil
+			}
+		} else {
+			exp = &ast.StringLiteral{
+				Token: token.Token{Type: token.STRING, Literal: part.Value, Line: tok.Line, Column: tok.Column},
+				Value: part.Value,
+			}
+		}
+
+		if result == nil {
+			result = exp
+			continue
+		}
+		result = &ast.InfixExpression{
+			Token:    token.Token{Type: token.PLUS, Literal: "+", Line: tok.Line, Column: tok.Column},
+			Left:     result,
+			Operator: "+",
+			Right:    exp,
+		}
+	}
+
+	switch result := result.(type) {
+	case *ast.InfixExpression:
+		result.Token = tok
+	case *ast.Interpolation:
+		result.Token = tok
+	}
+	return result
+}
+
+// 補間の式部分を別の構文解析器で解析し、ast.Interpolation にする
+func (p *Parser) parseInterpolation(part lexer.TemplatePart) ast.Expression {
+	sub := New(lexer.NewAt(part.Value, part.Line, part.Column))
+	if sub.curTokenIs(token.EOF) {
+		p.errors = append(p.errors, &lexer.Error{Line: part.Line, Column: part.Column, Message: "empty string interpolation"})
+		return nil
+	}
+
+	exp := sub.parseExpression(LOWEST)
+	if !sub.peekTokenIs(token.EOF) {
+		sub.error(sub.peekToken, "unexpected %s in string interpolation", sub.peekToken.Type)
+	}
+	p.errors = append(p.errors, sub.Diagnostics()...)
+	if exp == nil {
+		return nil
+	}
+
+	return &ast.Interpolation{
+		Token: token.Token{Type: token.INTERPOLATION, Literal: "${", Line: part.Line, Column: part.Column},
+		Value: exp,
+	}
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	array := &ast.ArrayLiteral{Token: p.curToken}
 	array.Elements = p.parseExpressionList(token.RBRAKET)
@@ -445,10 +645,38 @@ func (p *Parser) parseArrayLiteral() ast.Expression {
 }
 
 func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
-	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+	tok := p.curToken
+
+	// arr[:end] の形式
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, nil)
+	}
 
 	p.nextToken()
-	exp.Index = p.parseExpression(LOWEST)
+	index := p.parseExpression(LOWEST)
+
+	// arr[start:] または arr[start:end] の形式
+	if p.peekTokenIs(token.COLON) {
+		p.nextToken()
+		return p.parseSliceExpression(tok, left, index)
+	}
+
+	if !p.expectPeek(token.RBRAKET) {
+		return nil
+	}
+
+	return &ast.IndexExpression{Token: tok, Left: left, Index: index}
+}
+
+// curToken が ':' の位置から、スライスの終端と ']' を読み込む
+func (p *Parser) parseSliceExpression(tok token.Token, left, start ast.Expression) ast.Expression {
+	exp := &ast.SliceExpression{Token: tok, Left: left, Start: start}
+
+	if !p.peekTokenIs(token.RBRAKET) {
+		p.nextToken()
+		exp.End = p.parseExpression(LOWEST)
+	}
 
 	if !p.expectPeek(token.RBRAKET) {
 		return nil
@@ -473,6 +701,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		value := p.parseExpression(LOWEST)
 
 		hash.Pairs[key] = value
+		hash.Keys = append(hash.Keys, key)
 
 		if !p.peekTokenIs(token.RBRACE) && !p.expectPeek(token.COMMA) {
 			return nil
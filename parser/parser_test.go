@@ -557,6 +557,111 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestStringInterpolationParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"hello ${name}!"`, `(("hello " + str(name)) + "!")`},
+		{`"${a + b}"`, `str((a + b))`},
+		{`"${a}${b}"`, `(str(a) + str(b))`},
+		{"`${a}`", `"${a}"`},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		actual := quoteStringLiterals(stmt.Expression)
+		if actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+
+	// 補間は識別子 str の呼び出しではなく専用のノードになる
+	program := New(lexer.New(`"a${x}"`)).ParseProgram()
+	infix := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.InfixExpression)
+	interpolation, ok := infix.Right.(*ast.Interpolation)
+	if !ok {
+		t.Fatalf("right is not *ast.Interpolation. got=%T", infix.Right)
+	}
+	if interpolation.Token.Line != 1 || interpolation.Token.Column != 5 {
+		t.Errorf("interpolation has wrong position. got=%d:%d", interpolation.Token.Line, interpolation.Token.Column)
+	}
+}
+
+func TestStringInterpolationErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`"${}"`, "1:4: empty string interpolation"},
+		{`"${a b}"`, "1:6: unexpected IDENT in string interpolation"},
+		{`"abc`, "1:1: unterminated string literal"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
+
+func TestParserErrorPositions(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+		expectedError  string
+	}{
+		{"let = 5;", 1, 5, "expected next token to be IDENT, got = instead"},
+		{"let x = 1;\n  let y 2;", 2, 9, "expected next token to be =, got INT instead"},
+		{"1 + ;", 1, 5, "no prefix parse function for ; found"},
+		{"\n\t99999999999999999999", 2, 2, `could not parse "99999999999999999999" as integer`},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		diagnostics := p.Diagnostics()
+		if len(diagnostics) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+
+		err := diagnostics[0]
+		if err.Line != tt.expectedLine || err.Column != tt.expectedColumn {
+			t.Errorf("wrong position for %q. expected=%d:%d, got=%d:%d", tt.input, tt.expectedLine, tt.expectedColumn, err.Line, err.Column)
+		}
+		if err.Message != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, err.Message)
+		}
+	}
+}
+
+// 文字列リテラルを引用符で囲んで式を文字列化する
+func quoteStringLiterals(exp ast.Expression) string {
+	switch exp := exp.(type) {
+	case *ast.StringLiteral:
+		return `"` + exp.Value + `"`
+	case *ast.InfixExpression:
+		return "(" + quoteStringLiterals(exp.Left) + " " + exp.Operator + " " + quoteStringLiterals(exp.Right) + ")"
+	default:
+		return exp.String()
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 
@@ -603,6 +708,51 @@ func TestParsingIndexExpressions(t *testing.T) {
 	}
 }
 
+func TestParsingSliceExpressions(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedStart interface{}
+		expectedEnd   interface{}
+	}{
+		{"myArray[1:2]", 1, 2},
+		{"myArray[:2]", nil, 2},
+		{"myArray[1:]", 1, nil},
+		{"myArray[:]", nil, nil},
+	}
+
+	for _, tt := range tests {
+		l := lexer.New(tt.input)
+		p := New(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		sliceExp, ok := stmt.Expression.(*ast.SliceExpression)
+		if !ok {
+			t.Fatalf("exp is not ast.SliceExpression. got=%T", stmt.Expression)
+		}
+
+		if !testIdentifier(t, sliceExp.Left, "myArray") {
+			return
+		}
+
+		for _, bound := range []struct {
+			exp      ast.Expression
+			expected interface{}
+		}{{sliceExp.Start, tt.expectedStart}, {sliceExp.End, tt.expectedEnd}} {
+			if bound.expected == nil {
+				if bound.exp != nil {
+					t.Errorf("bound is not nil. got=%s", bound.exp.String())
+				}
+				continue
+			}
+			if !testLiteralExpression(t, bound.exp, bound.expected) {
+				return
+			}
+		}
+	}
+}
+
 func TestParsingHashLiteralsStringKeys(t *testing.T) {
 	input := `{"one": 1, "two": 2, "three": 3}`
 
@@ -736,6 +886,49 @@ func TestFunctionalLiteralWithName(t *testing.T) {
 }
 
 // helper functions
+func TestParsingComments(t *testing.T) {
+	input := `// 先頭のコメント
+let x = 1; // x の説明
+/* ブロック */
+x;`
+
+	l := lexer.NewWithComments(input)
+	p := New(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain 2 statements. got=%d", len(program.Statements))
+	}
+
+	tests := []struct {
+		expectedText     string
+		expectedLine     int
+		expectedTrailing bool
+	}{
+		{"// 先頭のコメント", 1, false},
+		{"// x の説明", 2, true},
+		{"/* ブロック */", 3, false},
+	}
+
+	if len(program.Comments) != len(tests) {
+		t.Fatalf("program.Comments has wrong length. want=%d, got=%d", len(tests), len(program.Comments))
+	}
+
+	for i, tt := range tests {
+		comment := program.Comments[i]
+		if comment.Text != tt.expectedText {
+			t.Errorf("comments[%d] - text wrong. want=%q, got=%q", i, tt.expectedText, comment.Text)
+		}
+		if comment.Token.Line != tt.expectedLine {
+			t.Errorf("comments[%d] - line wrong. want=%d, got=%d", i, tt.expectedLine, comment.Token.Line)
+		}
+		if comment.Trailing != tt.expectedTrailing {
+			t.Errorf("comments[%d] - trailing wrong. want=%t, got=%t", i, tt.expectedTrailing, comment.Trailing)
+		}
+	}
+}
+
 func checkParserErrors(t *testing.T, p *Parser) {
 	errors := p.Errors()
 	if len(errors) == 0 {
@@ -860,3 +1053,77 @@ func testInfixExpression(t *testing.T, exp ast.Expression, left interface{}, ope
 	}
 	return true
 }
+
+func TestParsingTypeAnnotations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x: int = 5;", "let x: int = 5;"},
+		{"let xs: [string] = [];", "let xs: [string] = [];"},
+		{"let h: {string: [int]} = {};", "let h: {string: [int]} = {};"},
+		{"let x = 5;", "let x = 5;"},
+		{"fn(a: string, b: [int]) -> int { 1 }", "fn(a: string,b: [int]) -> int1"},
+		{"fn(a, b: bool) { a }", "fn(a,b: bool)a"},
+		{"let f: fn(int, fn() -> any) -> null = fn(a, g) { puts(a) };", "let f: fn(int, fn() -> any) -> null = fn<f>(a,g)puts(a);"},
+		{"fn(f: fn(int)) { f }", "fn(f: fn(int))f"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if actual := program.String(); actual != tt.expected {
+			t.Errorf("expected=%q, got=%q", tt.expected, actual)
+		}
+	}
+}
+
+func TestTypeAnnotationNodes(t *testing.T) {
+	p := New(lexer.New("fn(a: {string: int}) -> [bool] { a }"))
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	fn := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+
+	hash, ok := fn.Parameters[0].Type.(*ast.HashType)
+	if !ok {
+		t.Fatalf("parameter type is not *ast.HashType. got=%T", fn.Parameters[0].Type)
+	}
+	if hash.Key.(*ast.NamedType).Name != "string" || hash.Value.(*ast.NamedType).Name != "int" {
+		t.Errorf("wrong hash type. got=%s", hash)
+	}
+
+	array, ok := fn.ReturnType.(*ast.ArrayType)
+	if !ok {
+		t.Fatalf("return type is not *ast.ArrayType. got=%T", fn.ReturnType)
+	}
+	if array.Token.Line != 1 || array.Token.Column != 25 {
+		t.Errorf("wrong position for return type. got=%d:%d", array.Token.Line, array.Token.Column)
+	}
+}
+
+func TestTypeAnnotationErrors(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{"let x: = 5;", "1:8: expected type, got = instead"},
+		{"let x: [int = 5;", "1:13: expected next token to be ], got = instead"},
+		{"fn(a: int) -> 5 { a }", "1:15: expected type, got INT instead"},
+	}
+
+	for _, tt := range tests {
+		p := New(lexer.New(tt.input))
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("expected parser errors for %q, got none", tt.input)
+		}
+		if errors[0] != tt.expectedError {
+			t.Errorf("wrong error. expected=%q, got=%q", tt.expectedError, errors[0])
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"io"
+	"monkey/object"
+)
+
+// pprof 形式は profile.proto で定義された protobuf を gzip したもの。
+// 使うフィールドは少ないので、依存を増やさずに直接エンコードする。
+// https://github.com/google/pprof/blob/main/proto/profile.proto
+
+// Profile のフィールド番号
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+)
+
+// WritePprof は呼び出しスタックごとの命令数と時間を pprof 形式で書き出す。
+// 1つの標本は「ある呼び出しスタックである行を実行していた」ことを表し、
+// 値は命令の数と時間(ナノ秒)の2つ
+func (p *Profiler) WritePprof(w io.Writer) error {
+	b := &pprofBuilder{
+		strings:   map[string]int64{"": 0},
+		table:     []string{""},
+		functions: map[*object.CompiledFunction]uint64{},
+		locations: map[location]uint64{},
+	}
+
+	b.valueType(profileSampleType, "instructions", "count")
+	b.valueType(profileSampleType, "time", "nanoseconds")
+
+	var walk func(n *node, stack []uint64)
+	walk = func(n *node, stack []uint64) {
+		// pprof の標本のスタックは末端の関数が先頭
+		stack = append([]uint64{b.location(p, n)}, stack...)
+		if n.instructions > 0 {
+			b.sample(stack, n.instructions, n.nanos)
+		}
+		for _, c := range n.children {
+			walk(c, stack)
+		}
+	}
+	for _, c := range p.root.children {
+		walk(c, nil)
+	}
+
+	for _, s := range b.table {
+		b.profile.bytes(profileStringTable, []byte(s))
+	}
+	b.profile.varint(profileTimeNanos, uint64(p.start.UnixNano()))
+	b.profile.varint(profileDurationNanos, uint64(p.total))
+	b.valueType(profilePeriodType, "instructions", "count")
+	b.profile.varint(profilePeriod, 1)
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(b.profile); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+type pprofBuilder struct {
+	profile protobuf
+
+	strings   map[string]int64
+	table     []string
+	functions map[*object.CompiledFunction]uint64
+	locations map[location]uint64
+}
+
+// str は文字列表での s の位置を返す
+func (b *pprofBuilder) str(s string) int64 {
+	if i, ok := b.strings[s]; ok {
+		return i
+	}
+	i := int64(len(b.table))
+	b.strings[s] = i
+	b.table = append(b.table, s)
+	return i
+}
+
+func (b *pprofBuilder) valueType(field int, typ, unit string) {
+	var m protobuf
+	m.varint(1, uint64(b.str(typ)))
+	m.varint(2, uint64(b.str(unit)))
+	b.profile.bytes(field, m)
+}
+
+func (b *pprofBuilder) sample(stack []uint64, instructions, nanos int64) {
+	var m protobuf
+	m.packed(1, stack)
+	m.packed(2, []uint64{uint64(instructions), uint64(nanos)})
+	b.profile.bytes(profileSample, m)
+}
+
+// function は関数の ID を返す。初めての関数なら Function を書き出す
+func (b *pprofBuilder) function(p *Profiler, fn *object.CompiledFunction) uint64 {
+	if id, ok := b.functions[fn]; ok {
+		return id
+	}
+	id := uint64(len(b.functions) + 1)
+	b.functions[fn] = id
+
+	name := b.str(p.functionName(fn))
+	var m protobuf
+	m.varint(1, id)
+	m.varint(2, uint64(name))
+	m.varint(3, uint64(name))
+	m.varint(4, uint64(b.str(p.fileName(fn))))
+	m.varint(5, uint64(startLine(fn)))
+	b.profile.bytes(profileFunction, m)
+	return id
+}
+
+// location は節の関数と行の ID を返す。初めての組み合わせなら Location を書き出す
+func (b *pprofBuilder) location(p *Profiler, n *node) uint64 {
+	key := location{n.fn, n.line}
+	if id, ok := b.locations[key]; ok {
+		return id
+	}
+	id := uint64(len(b.locations) + 1)
+	b.locations[key] = id
+
+	var line protobuf
+	line.varint(1, b.function(p, n.fn))
+	line.varint(2, uint64(n.line))
+
+	var m protobuf
+	m.varint(1, id)
+	m.bytes(4, line)
+	b.profile.bytes(profileLocation, m)
+	return id
+}
+
+// protobuf はエンコードしたメッセージ
+type protobuf []byte
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (m *protobuf) uvarint(v uint64) {
+	for v >= 0x80 {
+		*m = append(*m, byte(v)|0x80)
+		v >>= 7
+	}
+	*m = append(*m, byte(v))
+}
+
+func (m *protobuf) tag(field, wire int) {
+	m.uvarint(uint64(field)<<3 | uint64(wire))
+}
+
+// varint は整数のフィールドを書き出す。値が0なら省略する
+func (m *protobuf) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	m.tag(field, wireVarint)
+	m.uvarint(v)
+}
+
+func (m *protobuf) bytes(field int, v []byte) {
+	m.tag(field, wireBytes)
+	m.uvarint(uint64(len(v)))
+	*m = append(*m, v...)
+}
+
+func (m *protobuf) packed(field int, vs []uint64) {
+	var data protobuf
+	for _, v := range vs {
+		data.uvarint(v)
+	}
+	m.bytes(field, data)
+}
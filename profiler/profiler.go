@@ -0,0 +1,160 @@
+// Package profiler は VM で実行する Monkey プログラムのプロファイラーを提供する。
+//
+// Profiler は vm.Hook として VM に接続し、命令を実行するたびに呼び出しスタックを記録する
+// 計測型(instrumenting)のプロファイラーで、オペコードごとの命令数、関数ごとの呼び出し回数と
+// self / total の時間、行ごとの命令数と時間を集計する。
+// 時間は命令の間の経過時間を測るので、フックの呼び出しにかかる時間も含まれる。
+//
+// 結果はテキストのレポートと、go tool pprof で読める pprof 形式(gzip した protobuf)で書き出せる。
+package profiler
+
+import (
+	"monkey/code"
+	"monkey/debugger"
+	"monkey/object"
+	"monkey/vm"
+	"strconv"
+	"time"
+)
+
+// node は呼び出しスタックの木の節で、ある関数のある行を実行していたことを表す。
+// 根から節までの経路が、その行を実行していたときの呼び出しスタックになる
+type node struct {
+	fn       *object.CompiledFunction
+	line     int
+	children map[location]*node
+
+	instructions int64 // この行で実行した命令の数
+	nanos        int64 // この行の命令の実行にかかった時間
+}
+
+type location struct {
+	fn   *object.CompiledFunction
+	line int
+}
+
+func (n *node) child(fn *object.CompiledFunction, line int) *node {
+	key := location{fn, line}
+	c, ok := n.children[key]
+	if !ok {
+		c = &node{fn: fn, line: line, children: make(map[location]*node)}
+		n.children[key] = c
+	}
+	return c
+}
+
+type Profiler struct {
+	program *debugger.Program
+	file    string // 利用者のプログラムのファイル名
+
+	start time.Time
+	last  time.Time // 直前の命令を実行し始めた時刻
+	total time.Duration
+
+	root *node
+	path []*node // path[0] は root、path[i+1] は i 番目のフレームが実行している行の節
+	main *object.CompiledFunction
+
+	opcodes [256]int64
+	calls   map[*object.CompiledFunction]int64
+}
+
+// New は program のプロファイラーを返す。file はレポートに表示するファイル名
+func New(program *debugger.Program, file string) *Profiler {
+	root := &node{children: make(map[location]*node)}
+	return &Profiler{
+		program: program,
+		file:    file,
+		root:    root,
+		path:    []*node{root},
+		calls:   make(map[*object.CompiledFunction]int64),
+	}
+}
+
+// Before は VM が命令を実行する前に呼ばれ、直前の命令の時間と、これから実行する命令を記録する
+func (p *Profiler) Before(machine *vm.VM) error {
+	now := time.Now()
+	if p.start.IsZero() {
+		p.start = now
+	} else {
+		p.path[len(p.path)-1].nanos += int64(now.Sub(p.last))
+	}
+	p.last = now
+
+	frames := machine.Frames()
+	n := len(frames)
+	if p.main == nil {
+		p.main = frames[0].Closure().Fn
+	}
+
+	// 関数から戻ったフレームの節を取り除き、呼び出したフレームの節を加える。
+	// 呼び出し元のフレームの行は、呼び出している間は変わらない
+	if len(p.path) > n+1 {
+		p.path = p.path[:n+1]
+	}
+	for i := len(p.path) - 1; i < n; i++ {
+		fn := frames[i].Closure().Fn
+		p.calls[fn]++
+		p.path = append(p.path, p.path[i].child(fn, frameLine(frames[i])))
+	}
+
+	top := frames[n-1]
+	fn, line := top.Closure().Fn, frameLine(top)
+	if current := p.path[n]; current.fn != fn || current.line != line {
+		p.path[n] = p.path[n-1].child(fn, line)
+	}
+	p.path[n].instructions++
+	p.opcodes[top.Closure().Fn.Instructions[top.IP()]]++
+	return nil
+}
+
+// Stop は最後の命令の時間を記録する。プログラムの実行が終わったら呼び出す
+func (p *Profiler) Stop() {
+	if p.start.IsZero() {
+		return
+	}
+	now := time.Now()
+	p.path[len(p.path)-1].nanos += int64(now.Sub(p.last))
+	p.total = now.Sub(p.start)
+}
+
+func frameLine(frame *vm.Frame) int {
+	line, _ := debugger.FrameLine(frame)
+	return line
+}
+
+// functionName は関数の表示名を返す。無名関数は定義した位置で区別する
+func (p *Profiler) functionName(fn *object.CompiledFunction) string {
+	switch {
+	case fn == p.main:
+		return "main"
+	case fn.Name != "":
+		return fn.Name
+	default:
+		return "fn@" + p.fileName(fn) + ":" + strconv.Itoa(startLine(fn))
+	}
+}
+
+// fileName は関数を定義したファイルの名前を返す。prelude の関数は "prelude"
+func (p *Profiler) fileName(fn *object.CompiledFunction) string {
+	if p.program.IsLibrary(fn) {
+		return "prelude"
+	}
+	return p.file
+}
+
+// startLine は関数の最初の文の行を返す
+func startLine(fn *object.CompiledFunction) int {
+	if len(fn.SourceMap) == 0 {
+		return 0
+	}
+	return fn.SourceMap[0].Line
+}
+
+func opcodeName(op int) string {
+	def, err := code.Lookup(byte(op))
+	if err != nil {
+		return "Op" + strconv.Itoa(op)
+	}
+	return def.Name
+}
@@ -0,0 +1,236 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"monkey/debugger"
+	"strings"
+	"testing"
+)
+
+func profile(t *testing.T, src string) *Profiler {
+	t.Helper()
+	program, err := debugger.Compile(src)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+	p := New(program, "test.mk")
+	if err := program.Run(p); err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+	p.Stop()
+	return p
+}
+
+const fibSource = `let fib = fn(n) {
+  if (n < 2) { return n; }
+  fib(n - 1) + fib(n - 2);
+};
+let double = map([1, 2, 3], fn(x) { x * 2 });
+fib(10);`
+
+func TestFunctions(t *testing.T) {
+	p := profile(t, fibSource)
+
+	calls := map[string]int64{}
+	for _, f := range p.Functions() {
+		calls[f.Name] = f.Calls
+		if f.Total < f.Self {
+			t.Errorf("%s: total %s is less than self %s", f.Name, f.Total, f.Self)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		calls int64
+	}{
+		{"main", 1},
+		{"fib", 177},
+		{"map", 1},
+		{"fn@test.mk:5", 3},
+	}
+	for _, tt := range tests {
+		if calls[tt.name] != tt.calls {
+			t.Errorf("calls of %s wrong. want=%d, got=%d", tt.name, tt.calls, calls[tt.name])
+		}
+	}
+
+	for _, f := range p.Functions() {
+		if f.Name == "main" && f.Total != p.total {
+			t.Errorf("total of main wrong. want=%s, got=%s", p.total, f.Total)
+		}
+	}
+}
+
+func TestOpcodesAndLines(t *testing.T) {
+	p := profile(t, "let x = 1 + 2;\nlet y = x * 3;\ny;")
+
+	opcodes := map[string]int64{}
+	for _, op := range p.Opcodes() {
+		opcodes[op.Name] = op.Instructions
+	}
+	want := map[string]int64{
+		"OpConstant":  3,
+		"OpAdd":       1,
+		"OpMul":       1,
+		"OpSetGlobal": 2,
+		"OpGetGlobal": 2,
+		"OpPop":       1,
+	}
+	for name, n := range want {
+		if opcodes[name] != n {
+			t.Errorf("count of %s wrong. want=%d, got=%d", name, n, opcodes[name])
+		}
+	}
+	if p.Instructions() != 10 {
+		t.Errorf("instructions wrong. want=10, got=%d", p.Instructions())
+	}
+
+	lines := map[int]int64{}
+	for _, l := range p.Lines() {
+		lines[l.Line] = l.Instructions
+	}
+	for line, n := range map[int]int64{1: 4, 2: 4, 3: 2} {
+		if lines[line] != n {
+			t.Errorf("instructions at line %d wrong. want=%d, got=%d", line, n, lines[line])
+		}
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	p := profile(t, fibSource)
+
+	var out strings.Builder
+	if err := p.WriteReport(&out); err != nil {
+		t.Fatalf("WriteReport failed: %s", err)
+	}
+
+	for _, want := range []string{
+		"functions:",
+		"opcodes:",
+		"hot lines:",
+		"  fib\n",
+		"OpCall\n",
+		"test.mk:3  fib(n - 1) + fib(n - 2);\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWritePprof(t *testing.T) {
+	p := profile(t, fibSource)
+
+	var buf bytes.Buffer
+	if err := p.WritePprof(&buf); err != nil {
+		t.Fatalf("WritePprof failed: %s", err)
+	}
+	gz, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("not gzipped: %s", err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("could not decompress: %s", err)
+	}
+
+	fields := decode(t, data)
+	var table []string
+	for _, s := range fields[profileStringTable] {
+		table = append(table, string(s.bytes))
+	}
+	if len(table) == 0 || table[0] != "" {
+		t.Fatalf("string table must start with an empty string. got=%q", table)
+	}
+
+	// サンプルの値の合計は命令の総数と一致する
+	var instructions uint64
+	for _, s := range fields[profileSample] {
+		sample := decode(t, s.bytes)
+		values := unpack(t, sample[2][0].bytes)
+		if len(values) != 2 {
+			t.Fatalf("sample must have 2 values. got=%d", len(values))
+		}
+		instructions += values[0]
+		if len(unpack(t, sample[1][0].bytes)) == 0 {
+			t.Errorf("sample has no locations")
+		}
+	}
+	if instructions != uint64(p.Instructions()) {
+		t.Errorf("instructions wrong. want=%d, got=%d", p.Instructions(), instructions)
+	}
+
+	names := map[string]bool{}
+	for _, f := range fields[profileFunction] {
+		function := decode(t, f.bytes)
+		names[table[function[2][0].varint]] = true
+	}
+	for _, name := range []string{"main", "fib", "map", "fn@test.mk:5"} {
+		if !names[name] {
+			t.Errorf("function %s not in profile. got=%v", name, names)
+		}
+	}
+
+	sampleType := fields[profileSampleType]
+	if len(sampleType) != 2 {
+		t.Fatalf("sample_type wrong. want=2, got=%d", len(sampleType))
+	}
+	if typ := decode(t, sampleType[1].bytes); table[typ[1][0].varint] != "time" || table[typ[2][0].varint] != "nanoseconds" {
+		t.Errorf("second sample type must be time/nanoseconds")
+	}
+}
+
+// field は protobuf のフィールドの値
+type field struct {
+	varint uint64
+	bytes  []byte
+}
+
+// decode はテストに必要な分だけ protobuf のメッセージを読む
+func decode(t *testing.T, data []byte) map[int][]field {
+	t.Helper()
+	fields := map[int][]field{}
+	for len(data) > 0 {
+		key := readVarint(t, &data)
+		number, wire := int(key>>3), key&7
+		switch wire {
+		case wireVarint:
+			fields[number] = append(fields[number], field{varint: readVarint(t, &data)})
+		case wireBytes:
+			n := readVarint(t, &data)
+			if uint64(len(data)) < n {
+				t.Fatalf("truncated message")
+			}
+			fields[number] = append(fields[number], field{bytes: data[:n]})
+			data = data[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", wire)
+		}
+	}
+	return fields
+}
+
+func unpack(t *testing.T, data []byte) []uint64 {
+	t.Helper()
+	var values []uint64
+	for len(data) > 0 {
+		values = append(values, readVarint(t, &data))
+	}
+	return values
+}
+
+func readVarint(t *testing.T, data *[]byte) uint64 {
+	t.Helper()
+	var v uint64
+	for i, b := range *data {
+		v |= uint64(b&0x7f) << (7 * i)
+		if b < 0x80 {
+			*data = (*data)[i+1:]
+			return v
+		}
+	}
+	t.Fatalf("truncated varint")
+	return 0
+}
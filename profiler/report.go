@@ -0,0 +1,207 @@
+package profiler
+
+import (
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/stdlib"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FunctionStats は関数ごとの集計
+type FunctionStats struct {
+	Name         string
+	File         string
+	Calls        int64
+	Instructions int64         // 関数自身が実行した命令の数
+	Self         time.Duration // 関数自身の命令の実行にかかった時間
+	Total        time.Duration // 関数から呼び出した関数の時間も含めた時間
+}
+
+// LineStats は行ごとの集計
+type LineStats struct {
+	File         string
+	Line         int
+	Instructions int64
+	Time         time.Duration
+}
+
+// OpcodeStats はオペコードごとの命令数
+type OpcodeStats struct {
+	Name         string
+	Instructions int64
+}
+
+// Functions は関数ごとの集計を、self の時間が長い順に返す
+func (p *Profiler) Functions() []FunctionStats {
+	stats := map[*object.CompiledFunction]*FunctionStats{}
+	get := func(fn *object.CompiledFunction) *FunctionStats {
+		s, ok := stats[fn]
+		if !ok {
+			s = &FunctionStats{Name: p.functionName(fn), File: p.fileName(fn), Calls: p.calls[fn]}
+			stats[fn] = s
+		}
+		return s
+	}
+
+	// total は、スタックに同じ関数が現れない最も外側の節について、部分木の時間を合計する
+	onStack := map[*object.CompiledFunction]int{}
+	var walk func(n *node) int64
+	walk = func(n *node) int64 {
+		s := get(n.fn)
+		s.Instructions += n.instructions
+		s.Self += time.Duration(n.nanos)
+
+		onStack[n.fn]++
+		subtree := n.nanos
+		for _, c := range n.children {
+			subtree += walk(c)
+		}
+		onStack[n.fn]--
+
+		if onStack[n.fn] == 0 {
+			s.Total += time.Duration(subtree)
+		}
+		return subtree
+	}
+	for _, c := range p.root.children {
+		walk(c)
+	}
+
+	result := []FunctionStats{}
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Self != result[j].Self {
+			return result[i].Self > result[j].Self
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Lines は行ごとの集計を、命令の数が多い順に返す
+func (p *Profiler) Lines() []LineStats {
+	type key struct {
+		file string
+		line int
+	}
+	stats := map[key]*LineStats{}
+
+	var walk func(n *node)
+	walk = func(n *node) {
+		k := key{p.fileName(n.fn), n.line}
+		s, ok := stats[k]
+		if !ok {
+			s = &LineStats{File: k.file, Line: k.line}
+			stats[k] = s
+		}
+		s.Instructions += n.instructions
+		s.Time += time.Duration(n.nanos)
+
+		for _, c := range n.children {
+			walk(c)
+		}
+	}
+	for _, c := range p.root.children {
+		walk(c)
+	}
+
+	result := []LineStats{}
+	for _, s := range stats {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Instructions != b.Instructions {
+			return a.Instructions > b.Instructions
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return result
+}
+
+// Opcodes はオペコードごとの命令数を、多い順に返す。実行しなかったオペコードは含まない
+func (p *Profiler) Opcodes() []OpcodeStats {
+	result := []OpcodeStats{}
+	for op, n := range p.opcodes {
+		if n > 0 {
+			result = append(result, OpcodeStats{Name: opcodeName(op), Instructions: n})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Instructions != result[j].Instructions {
+			return result[i].Instructions > result[j].Instructions
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// Instructions は実行した命令の総数を返す
+func (p *Profiler) Instructions() int64 {
+	var total int64
+	for _, n := range p.opcodes {
+		total += n
+	}
+	return total
+}
+
+// hotLines はレポートに表示する行の数
+const hotLines = 10
+
+// WriteReport はテキストのレポートを書き出す
+func (p *Profiler) WriteReport(w io.Writer) error {
+	instructions := p.Instructions()
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "total: %s, %d instructions\n", p.total.Round(time.Microsecond), instructions)
+
+	fmt.Fprintf(&b, "\nfunctions:\n")
+	fmt.Fprintf(&b, "%10s %12s %7s %12s %7s  %s\n", "calls", "self", "self%", "total", "total%", "function")
+	for _, f := range p.Functions() {
+		fmt.Fprintf(&b, "%10d %12s %6.1f%% %12s %6.1f%%  %s\n",
+			f.Calls, f.Self.Round(time.Microsecond), percent(int64(f.Self), int64(p.total)),
+			f.Total.Round(time.Microsecond), percent(int64(f.Total), int64(p.total)), f.Name)
+	}
+
+	fmt.Fprintf(&b, "\nopcodes:\n")
+	fmt.Fprintf(&b, "%12s %7s  %s\n", "instructions", "%", "opcode")
+	for _, op := range p.Opcodes() {
+		fmt.Fprintf(&b, "%12d %6.1f%%  %s\n", op.Instructions, percent(op.Instructions, instructions), op.Name)
+	}
+
+	fmt.Fprintf(&b, "\nhot lines:\n")
+	fmt.Fprintf(&b, "%12s %12s  %s\n", "instructions", "time", "line")
+	preludeLines := strings.Split(stdlib.Prelude, "\n")
+	for i, l := range p.Lines() {
+		if i == hotLines {
+			break
+		}
+		lines := p.program.Lines
+		if l.File == "prelude" {
+			lines = preludeLines
+		}
+		text := ""
+		if l.Line >= 1 && l.Line <= len(lines) {
+			text = strings.TrimSpace(lines[l.Line-1])
+		}
+		fmt.Fprintf(&b, "%12d %12s  %s:%d  %s\n", l.Instructions, l.Time.Round(time.Microsecond), l.File, l.Line, text)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,187 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/object"
+	"os"
+	"strings"
+	"time"
+)
+
+const COMMANDS_HELP = `commands:
+  :ast <code>        show the syntax tree of code without running it
+  :type <expression> show the type of an expression without running it
+  :bytecode <code>   show the bytecode of code, then run it
+  :time <code>       run code and show how long it took
+  :env               show the global variables and their values
+  :load <file>       run a file
+  :reset             forget all global variables
+  :help              show this help
+  :quit              leave the REPL
+`
+
+// isCommand は入力が REPL のコマンドかどうかを返す
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+// command は REPL のコマンドを実行し、結果を out に書き出す。REPL を終了する場合は true を返す
+func (s *session) command(out io.Writer, input string, disabled map[string]bool) bool {
+	name, arg, _ := strings.Cut(strings.TrimSpace(input), " ")
+	arg = strings.TrimSpace(arg)
+	if disabled[name] {
+		fmt.Fprintf(out, "command %s is not available in this session\n", name)
+		return false
+	}
+
+	switch name {
+	case ":ast":
+		printAST(out, arg)
+	case ":type":
+		s.printType(out, arg)
+	case ":bytecode":
+		s.printBytecode(out, arg)
+	case ":time":
+		s.time(out, arg)
+	case ":env":
+		s.printEnv(out)
+	case ":load":
+		s.load(out, arg)
+	case ":reset":
+		s.reset(out)
+	case ":help":
+		io.WriteString(out, COMMANDS_HELP)
+	case ":quit", ":q":
+		return true
+	default:
+		fmt.Fprintf(out, "unknown command %q. type :help for the list of commands\n", name)
+	}
+	return false
+}
+
+func printAST(out io.Writer, arg string) {
+	program, err := parse(arg)
+	if err != nil {
+		printError(out, err)
+		return
+	}
+	ast.Fprint(out, program)
+}
+
+func (s *session) printType(out io.Writer, arg string) {
+	program, err := parse(arg)
+	if err != nil {
+		printError(out, err)
+		return
+	}
+	if len(program.Statements) != 1 {
+		fmt.Fprintln(out, "expected an expression")
+		return
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		fmt.Fprintln(out, "expected an expression")
+		return
+	}
+
+	t, errors := s.checker.TypeOf(stmt.Expression)
+	if len(errors) != 0 {
+		messages := []string{}
+		for _, err := range errors {
+			messages = append(messages, err.Error())
+		}
+		printError(out, &Error{Stage: CheckStage, Messages: messages})
+		return
+	}
+	fmt.Fprintln(out, t)
+}
+
+// printBytecode は code をコンパイルして、トップレベルの命令とこの入力で定義した関数の命令を表示してから実行する。
+// コンパイルで定義したグローバル変数に値が入るように、表示したあとで実行する
+func (s *session) printBytecode(out io.Writer, arg string) {
+	result, err := s.evaluate(out, arg, func(code *compiler.Bytecode, defined int) {
+		fmt.Fprintf(out, "main:\n%s", code.Instructions)
+		for i, c := range code.Constants[defined:] {
+			fn, ok := c.(*object.CompiledFunction)
+			if !ok {
+				continue
+			}
+			name := fn.Name
+			if name == "" {
+				name = "<anonymous>"
+			}
+			fmt.Fprintf(out, "constant %d: fn %s\n%s", defined+i, name, fn.Instructions)
+		}
+	})
+	if err != nil {
+		printError(out, err)
+		return
+	}
+	printResult(out, result)
+}
+
+// time は code を実行して、VM での実行にかかった時間を表示する。構文解析とコンパイルの時間は含まない
+func (s *session) time(out io.Writer, arg string) {
+	var start time.Time
+	result, err := s.evaluate(out, arg, func(*compiler.Bytecode, int) { start = time.Now() })
+	elapsed := time.Since(start)
+	if err != nil {
+		printError(out, err)
+		if start.IsZero() {
+			return
+		}
+	}
+	printResult(out, result)
+	fmt.Fprintf(out, "time: %s\n", elapsed)
+}
+
+// printEnv は入力で定義したグローバル変数を定義した順に表示する。prelude の関数は表示しない
+func (s *session) printEnv(out io.Writer) {
+	printed := false
+	for _, sym := range s.symbolTable.Definitions()[s.preludeGlobals:] {
+		if resolved, ok := s.symbolTable.Resolve(sym.Name); !ok || resolved != sym {
+			continue // 同じ名前で再定義された
+		}
+		value := "<nil>"
+		if obj := s.globals[sym.Index]; obj != nil {
+			value = obj.Inspect()
+		}
+		fmt.Fprintf(out, "%s = %s\n", sym.Name, value)
+		printed = true
+	}
+	if !printed {
+		fmt.Fprintln(out, "no global variables")
+	}
+}
+
+func (s *session) load(out io.Writer, arg string) {
+	if arg == "" {
+		fmt.Fprintln(out, "expected a file name")
+		return
+	}
+	src, err := os.ReadFile(arg)
+	if err != nil {
+		fmt.Fprintf(out, "Woops! Loading file failed:\n %s\n", err)
+		return
+	}
+
+	result, err := s.evaluate(out, string(src), nil)
+	if err != nil {
+		printError(out, err)
+		return
+	}
+	printResult(out, result)
+}
+
+// reset はグローバル変数と型を捨てて、prelude を読み込んだ直後の状態に戻す
+func (s *session) reset(out io.Writer) {
+	fresh, err := newSession()
+	if err != nil {
+		fmt.Fprintf(out, "Woops! Loading prelude failed:\n %s\n", err)
+		return
+	}
+	*s = *fresh
+}
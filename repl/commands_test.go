@@ -0,0 +1,60 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lib.mk")
+	if err := os.WriteFile(file, []byte("let square = fn(x) { x * x };\nsquare(3)\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{":ast 1 + x", []string{
+			"Program\n  Statements[0]: ExpressionStatement 1:1\n    Expression: InfixExpression 1:3 Operator=\"+\"\n",
+			"      Right: Identifier 1:5 Value=\"x\"\n",
+		}},
+		{"let f = fn(a: int) { a };\n:type f", []string{"fn(int) -> int\n"}},
+		{":type [1, 2]", []string{"[int]\n"}},
+		{":type let x = 1;", []string{"expected an expression\n"}},
+		{`:type 1 + "a"`, []string{"Type check failed:\n 1:3: type mismatch: int + string\n"}},
+		{":bytecode let g = fn() { 1 }; g()", []string{
+			"main:\n0000 OpClosure ",
+			"OpSetGlobal ",
+			": fn g\n0000 OpConstant ",
+			"OpReturnValue\n1\n",
+		}},
+		{":env", []string{"no global variables\n"}},
+		{"let x = 1;\nlet y = [x];\nlet x = 2;\n:env", []string{"y = [1]\nx = 2\n>> "}},
+		{":time 1 + 1", []string{"2\ntime: "}},
+		{":load " + file + "\n:env", []string{"9\n>> square = Closure["}},
+		{":load", []string{"expected a file name\n"}},
+		{":load " + file + ".missing", []string{"Loading file failed:"}},
+		{"let x = 1;\n:reset\n:env\nx", []string{"no global variables\n>> Woops! Compilation failed:\n undefined variable x\n"}},
+		{":nope", []string{`unknown command ":nope"`}},
+		{":help", []string{COMMANDS_HELP}},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		Start(strings.NewReader(tt.input+"\n"), &out)
+		for _, want := range tt.expected {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("wrong output for %q. want to contain %q, got=%q", tt.input, want, out.String())
+			}
+		}
+	}
+
+	var out strings.Builder
+	Start(strings.NewReader(":quit\n1 + 1\n"), &out)
+	if strings.Contains(out.String(), "2") {
+		t.Errorf(":quit does not leave the REPL: %q", out.String())
+	}
+}
@@ -0,0 +1,343 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+)
+
+// ErrInterrupted は Ctrl-C で入力を取り消したときに ReadLine が返すエラー
+var ErrInterrupted = errors.New("interrupted")
+
+// LineReader は REPL の入力を1行ずつ読む
+type LineReader interface {
+	// ReadLine は prompt を表示して1行を読む。入力の終わりでは io.EOF を返す
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader は行編集をせずに1行ずつ読む。端末でない入力に使う
+type scannerReader struct {
+	scanner *bufio.Scanner
+	out     io.Writer
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", io.EOF
+	}
+	// telnet などは行末に CR を送る
+	return strings.TrimSuffix(r.scanner.Text(), "\r"), nil
+}
+
+// 制御文字のキー
+const (
+	keyCtrlA     = 0x01
+	keyCtrlB     = 0x02
+	keyCtrlC     = 0x03
+	keyCtrlD     = 0x04
+	keyCtrlE     = 0x05
+	keyCtrlF     = 0x06
+	keyCtrlH     = 0x08
+	keyTab       = 0x09
+	keyCtrlJ     = 0x0a
+	keyCtrlK     = 0x0b
+	keyCtrlL     = 0x0c
+	keyEnter     = 0x0d
+	keyCtrlN     = 0x0e
+	keyCtrlP     = 0x10
+	keyCtrlT     = 0x14
+	keyCtrlU     = 0x15
+	keyCtrlW     = 0x17
+	keyCtrlY     = 0x19
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+// Editor は端末で1行を編集する LineReader。
+// 入力を1文字ずつ読んで emacs 風のキー操作で行を編集し、行全体を ANSI エスケープシーケンスで描き直す。
+// 端末を raw モードにするのは呼び出し側の役割なので、テストでは任意の io.Reader からキーを与えられる。
+//
+//	Ctrl-A, Home        行頭へ           Ctrl-E, End         行末へ
+//	Ctrl-B, ←           1文字戻る         Ctrl-F, →           1文字進む
+//	Alt-B               1単語戻る         Alt-F               1単語進む
+//	Ctrl-H, Backspace   前の文字を削除     Ctrl-D, Delete      カーソルの文字を削除(空の行では入力の終わり)
+//	Ctrl-K              行末まで切り取る   Ctrl-U              行頭まで切り取る
+//	Ctrl-W, Alt-Backspace 前の単語を切り取る Alt-D               次の単語を切り取る
+//	Ctrl-Y              切り取った文字列を貼り付ける
+//	Ctrl-T              前後の文字を入れ替える
+//	Ctrl-P, ↑           前の履歴          Ctrl-N, ↓           次の履歴
+//	Ctrl-L              画面を消去する     Ctrl-C              入力を取り消す
+type Editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *History
+
+	// raw は端末を raw モードにして、元に戻す関数を返す。nil なら何もしない
+	raw func() (restore func(), err error)
+
+	prompt string
+	line   []rune
+	pos    int
+	killed []rune
+
+	// 履歴を辿っている位置。len(history) なら編集中の行
+	index int
+	// 履歴を辿り始める前に編集していた行
+	draft []rune
+}
+
+// NewEditor は in からキーを読み、out に行を描く Editor を返す。history が nil なら履歴を使わない
+func NewEditor(in io.Reader, out io.Writer, history *History) *Editor {
+	if history == nil {
+		history = NewHistory()
+	}
+	return &Editor{in: bufio.NewReader(in), out: out, history: history}
+}
+
+// ReadLine は prompt を表示して、Enter が押されるまで行を編集する。
+// 空の行で Ctrl-D が押されると io.EOF を、Ctrl-C が押されると ErrInterrupted を返す
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	e.prompt = prompt
+	e.line = e.line[:0]
+	e.pos = 0
+	e.index = len(e.history.Entries())
+	e.draft = nil
+	e.refresh()
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(e.line) != 0 {
+				// 改行のない最後の行
+				e.write("\n")
+				return string(e.line), nil
+			}
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, keyCtrlJ:
+			e.pos = len(e.line)
+			e.refresh()
+			e.write("\n")
+			return string(e.line), nil
+		case keyCtrlC:
+			e.write("^C\n")
+			return "", ErrInterrupted
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				e.write("\n")
+				return "", io.EOF
+			}
+			e.deleteChar()
+		case keyCtrlA:
+			e.pos = 0
+		case keyCtrlE:
+			e.pos = len(e.line)
+		case keyCtrlB:
+			e.pos = max(e.pos-1, 0)
+		case keyCtrlF:
+			e.pos = min(e.pos+1, len(e.line))
+		case keyCtrlH, keyBackspace:
+			if e.pos > 0 {
+				e.line = append(e.line[:e.pos-1], e.line[e.pos:]...)
+				e.pos--
+			}
+		case keyCtrlK:
+			e.kill(e.pos, len(e.line))
+		case keyCtrlU:
+			e.kill(0, e.pos)
+		case keyCtrlW:
+			e.kill(e.wordStart(), e.pos)
+		case keyCtrlY:
+			e.insert(e.killed...)
+		case keyCtrlT:
+			e.transpose()
+		case keyCtrlP:
+			e.recall(e.index - 1)
+		case keyCtrlN:
+			e.recall(e.index + 1)
+		case keyCtrlL:
+			e.write("\x1b[H\x1b[2J")
+		case keyTab:
+			e.insert(' ', ' ')
+		case keyEscape:
+			e.escape()
+		default:
+			if unicode.IsPrint(r) {
+				e.insert(r)
+			}
+		}
+		e.refresh()
+	}
+}
+
+// escape は ESC で始まるキーを処理する。
+// 矢印キーなどの CSI シーケンス(ESC [ ...)、SS3 シーケンス(ESC O ...)、Alt との組み合わせ(ESC キー)を解釈する
+func (e *Editor) escape() {
+	r, _, err := e.in.ReadRune()
+	if err != nil {
+		return
+	}
+
+	switch r {
+	case '[', 'O':
+		// パラメータのあとの最後の文字までを読む
+		params := ""
+		for {
+			c, _, err := e.in.ReadRune()
+			if err != nil {
+				return
+			}
+			if c < '0' || c > '9' && c != ';' {
+				e.sequence(params, c)
+				return
+			}
+			params += string(c)
+		}
+	case 'b', 'B':
+		e.pos = e.wordStart()
+	case 'f', 'F':
+		e.pos = e.wordEnd()
+	case 'd', 'D':
+		e.kill(e.pos, e.wordEnd())
+	case keyBackspace, keyCtrlH:
+		e.kill(e.wordStart(), e.pos)
+	}
+}
+
+func (e *Editor) sequence(params string, final rune) {
+	switch {
+	case final == 'A':
+		e.recall(e.index - 1)
+	case final == 'B':
+		e.recall(e.index + 1)
+	case final == 'C':
+		e.pos = min(e.pos+1, len(e.line))
+	case final == 'D':
+		e.pos = max(e.pos-1, 0)
+	case final == 'H', final == '~' && (params == "1" || params == "7"):
+		e.pos = 0
+	case final == 'F', final == '~' && (params == "4" || params == "8"):
+		e.pos = len(e.line)
+	case final == '~' && params == "3":
+		e.deleteChar()
+	}
+}
+
+func (e *Editor) insert(runes ...rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.pos]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.pos:]...)
+	e.pos += len(runes)
+}
+
+func (e *Editor) deleteChar() {
+	if e.pos < len(e.line) {
+		e.line = append(e.line[:e.pos], e.line[e.pos+1:]...)
+	}
+}
+
+// kill は行の [start, end) を切り取って、Ctrl-Y で貼り付けられるようにする
+func (e *Editor) kill(start, end int) {
+	if start >= end {
+		return
+	}
+	e.killed = append([]rune{}, e.line[start:end]...)
+	e.line = append(e.line[:start], e.line[end:]...)
+	e.pos = start
+}
+
+// transpose はカーソルの前後の文字を入れ替えてカーソルを進める。行末では直前の2文字を入れ替える
+func (e *Editor) transpose() {
+	if len(e.line) < 2 || e.pos == 0 {
+		return
+	}
+	if e.pos == len(e.line) {
+		e.pos--
+	}
+	e.line[e.pos-1], e.line[e.pos] = e.line[e.pos], e.line[e.pos-1]
+	e.pos++
+}
+
+// wordStart はカーソルの前の単語の先頭の位置を返す
+func (e *Editor) wordStart() int {
+	i := e.pos
+	for i > 0 && !isWordRune(e.line[i-1]) {
+		i--
+	}
+	for i > 0 && isWordRune(e.line[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd はカーソルの後の単語の末尾の位置を返す
+func (e *Editor) wordEnd() int {
+	i := e.pos
+	for i < len(e.line) && !isWordRune(e.line[i]) {
+		i++
+	}
+	for i < len(e.line) && isWordRune(e.line[i]) {
+		i++
+	}
+	return i
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// recall は履歴の index 番目の入力を行にする。index が履歴の数と等しければ履歴を辿る前の行に戻る
+func (e *Editor) recall(index int) {
+	entries := e.history.Entries()
+	if index < 0 || index > len(entries) || index == e.index {
+		return
+	}
+	if e.index == len(entries) {
+		e.draft = append([]rune{}, e.line...)
+	}
+
+	e.index = index
+	if index == len(entries) {
+		e.line = append([]rune{}, e.draft...)
+	} else {
+		e.line = []rune(entries[index])
+	}
+	e.pos = len(e.line)
+}
+
+// refresh はプロンプトと行を描き直し、カーソルを移動する。
+// 複数行の履歴は1行で表示するので、改行を ↵ で表す
+func (e *Editor) refresh() {
+	line := strings.ReplaceAll(string(e.line), "\n", "↵")
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(line)
+	b.WriteString("\x1b[K\r")
+	if column := len([]rune(e.prompt)) + e.pos; column > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", column)
+	}
+	e.write(b.String())
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
@@ -0,0 +1,110 @@
+package repl
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEditor(t *testing.T) {
+	history := NewHistory()
+	history.Add("let x = 1;")
+	history.Add("x + 1")
+
+	tests := []struct {
+		name     string
+		keys     string
+		expected string
+	}{
+		{"insert", "abc\r", "abc"},
+		{"newline", "abc\n", "abc"},
+		{"end of input", "abc", "abc"},
+		{"backspace", "abcd\x7f\x08\r", "ab"},
+		{"move and insert", "bc\x01a\x05d\r", "abcd"},
+		{"left and right", "ac\x02b\x06d\r", "abcd"},
+		{"arrow keys", "ac\x1b[Db\x1b[Cd\r", "abcd"},
+		{"home and end", "bc\x1b[Ha\x1b[Fd\r", "abcd"},
+		{"home and end with tilde", "bc\x1b[1~a\x1b[4~d\r", "abcd"},
+		{"delete", "abc\x01\x04\x1b[3~\r", "c"},
+		{"kill to end and yank", "abcd\x02\x02\x0b\x01\x19\r", "cdab"},
+		{"kill to start", "abcd\x02\x15\r", "d"},
+		{"kill word", "let foo_bar\x17baz\r", "let baz"},
+		{"alt backspace", "f(a, b)\x1b\x7f\r", "f(a, "},
+		{"word movement", "one two three\x1bb\x1bbX\x1bfY\r", "one XtwoY three"},
+		{"kill next word", "one two\x01\x1bd\r", " two"},
+		{"transpose", "ab\x14\r", "ba"},
+		{"transpose in middle", "abc\x02\x14\r", "acb"},
+		{"tab", "\tx\r", "  x"},
+		{"unicode", "あいう\x02\x7f\r", "あう"},
+		{"previous history", "\x10\r", "x + 1"},
+		{"history with arrows", "\x1b[A\x1b[A\r", "let x = 1;"},
+		{"history past the oldest", "\x10\x10\x10\r", "let x = 1;"},
+		{"back to draft", "draft\x10\x10\x0e\x0e\r", "draft"},
+		{"edit recalled", "\x10\x7f2\r", "x + 2"},
+		{"ignore control keys", "a\x07\x1c\x1b[5~b\r", "ab"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := NewEditor(strings.NewReader(tt.keys), &out, history)
+		line, err := e.ReadLine(PROMPT)
+		if err != nil {
+			t.Errorf("%s: ReadLine failed: %s", tt.name, err)
+			continue
+		}
+		if line != tt.expected {
+			t.Errorf("%s: wrong line. want=%q, got=%q", tt.name, tt.expected, line)
+		}
+	}
+}
+
+func TestEditorEndOfInput(t *testing.T) {
+	tests := []struct {
+		keys     string
+		expected error
+	}{
+		{"", io.EOF},
+		{"\x04", io.EOF},
+		{"abc\x03", ErrInterrupted},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		e := NewEditor(strings.NewReader(tt.keys), &out, nil)
+		if _, err := e.ReadLine(PROMPT); err != tt.expected {
+			t.Errorf("ReadLine(%q) wrong error. want=%v, got=%v", tt.keys, tt.expected, err)
+		}
+	}
+}
+
+func TestEditorRefresh(t *testing.T) {
+	var out strings.Builder
+	e := NewEditor(strings.NewReader("ab\x02\r"), &out, nil)
+	if _, err := e.ReadLine(PROMPT); err != nil {
+		t.Fatalf("ReadLine failed: %s", err)
+	}
+
+	// ← のあとはプロンプトと行を描き直し、カーソルを b の位置に移動する
+	expected := "\r>> ab\x1b[K\r\x1b[4C"
+	if !strings.Contains(out.String(), expected) {
+		t.Errorf("wrong output. want to contain %q, got=%q", expected, out.String())
+	}
+	if !strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("Enter does not end the line: %q", out.String())
+	}
+}
+
+func TestReadInput(t *testing.T) {
+	var out strings.Builder
+	e := NewEditor(strings.NewReader("let f = fn() {\r1\r}\r"), &out, nil)
+	input, err := readInput(e)
+	if err != nil {
+		t.Fatalf("readInput failed: %s", err)
+	}
+	if input != "let f = fn() {\n1\n}" {
+		t.Errorf("wrong input. got=%q", input)
+	}
+	if !strings.Contains(out.String(), CONTINUATION_PROMPT) {
+		t.Errorf("continuation prompt is not shown: %q", out.String())
+	}
+}
@@ -0,0 +1,136 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HISTORY_FILE はホームディレクトリに置く履歴ファイルの名前
+const HISTORY_FILE = ".monkey_history"
+
+// MaxHistory は履歴に残す入力の数
+const MaxHistory = 1000
+
+// History は REPL の入力の履歴。
+// ファイルを指定すると、読み込んだ入力をファイルに1行ずつ追記する。
+// 複数行の入力は改行とバックスラッシュをエスケープして1行に書く
+type History struct {
+	entries []string
+	path    string
+}
+
+// NewHistory はファイルに保存しない空の履歴を返す
+func NewHistory() *History {
+	return &History{}
+}
+
+// LoadHistory は path の履歴を読み込む。ファイルがなければ空の履歴を返し、最初の Add で作成する
+func LoadHistory(path string) (*History, error) {
+	h := &History{path: path}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return h, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			h.entries = append(h.entries, unescapeHistory(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// 古い入力を捨てたらファイルも書き直して、ファイルが際限なく大きくならないようにする
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[len(h.entries)-MaxHistory:]
+		if err := h.rewrite(); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// DefaultHistoryFile はホームディレクトリの履歴ファイルのパスを返す
+func DefaultHistoryFile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, HISTORY_FILE), nil
+}
+
+// Entries は古い順に履歴を返す
+func (h *History) Entries() []string {
+	return h.entries
+}
+
+// Add は入力を履歴に加える。空白だけの入力と、直前と同じ入力は加えない
+func (h *History) Add(input string) error {
+	input = strings.TrimRight(input, " \t\r\n")
+	if strings.TrimSpace(input) == "" {
+		return nil
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == input {
+		return nil
+	}
+
+	h.entries = append(h.entries, input)
+	if len(h.entries) > MaxHistory {
+		h.entries = h.entries[1:]
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(escapeHistory(input) + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (h *History) rewrite() error {
+	var b strings.Builder
+	for _, entry := range h.entries {
+		b.WriteString(escapeHistory(entry))
+		b.WriteByte('\n')
+	}
+	return os.WriteFile(h.path, []byte(b.String()), 0600)
+}
+
+var historyEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHistory(s string) string {
+	return historyEscaper.Replace(s)
+}
+
+func unescapeHistory(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		i++
+		if s[i] == 'n' {
+			b.WriteByte('\n')
+		} else {
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
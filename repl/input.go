@@ -0,0 +1,63 @@
+package repl
+
+import (
+	"monkey/lexer"
+	"monkey/token"
+)
+
+// 入力が続くことを示すエラー。lexer のエラーのうち、入力を続ければ解消するもの
+var unterminated = map[string]bool{
+	"unterminated string literal":       true,
+	"unterminated raw string literal":   true,
+	"unterminated string interpolation": true,
+	"unterminated block comment":        true,
+}
+
+// 行末にあると式や文が続くトークン
+var continuing = map[token.TokenType]bool{
+	token.ASSIGN:   true,
+	token.PLUS:     true,
+	token.MINUS:    true,
+	token.BANG:     true,
+	token.ASTERISK: true,
+	token.SLASH:    true,
+	token.LT:       true,
+	token.GT:       true,
+	token.EQ:       true,
+	token.NOT_EQ:   true,
+	token.ARROW:    true,
+	token.COMMA:    true,
+	token.COLON:    true,
+	token.FUNCTION: true,
+	token.LET:      true,
+	token.IF:       true,
+	token.ELSE:     true,
+}
+
+// Incomplete は src が入力の途中で終わっているかどうかを返す。
+// 括弧が閉じていない場合、文字列やブロックコメントが終わっていない場合、演算子やカンマで終わっている場合に true になる。
+// 閉じ括弧が多すぎる場合は、続きを読んでも正しくならないので false を返す
+func Incomplete(src string) bool {
+	l := lexer.New(src)
+	depth := 0
+	var last token.Token
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACE, token.LBRAKET:
+			depth++
+		case token.RPAREN, token.RBRACE, token.RBRAKET:
+			depth--
+			if depth < 0 {
+				return false
+			}
+		}
+		last = tok
+	}
+
+	for _, err := range l.Diagnostics() {
+		if unterminated[err.Message] {
+			return true
+		}
+	}
+	return depth > 0 || continuing[last.Type]
+}
@@ -4,61 +4,102 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"monkey/compiler"
-	"monkey/lexer"
-	"monkey/object"
-	"monkey/parser"
-	"monkey/vm"
+	"os"
+	"strings"
 )
 
 const PROMPT = ">> "
 
+// CONTINUATION_PROMPT は入力が続くときのプロンプト
+const CONTINUATION_PROMPT = ".. "
+
+// Start は in から読んだ入力を VM で実行し、結果を out に書き出す。
+// 括弧が閉じていないなど入力が途中で終わっていれば、続きの行を読んでから実行する。
+// : で始まる入力は REPL のコマンドとして扱う。
+// in が端末なら行編集を有効にし、入力をホームディレクトリの履歴ファイルに保存する
 func Start(in io.Reader, out io.Writer) {
-	scanner := bufio.NewScanner(in)
-	constants := []object.Object{}
-	globals := make([]object.Object, vm.GlobalSize)
-	symbolTable := compiler.NewSymbolTable()
-	for i, v := range object.Builtins {
-		symbolTable.DefineBuiltin(i, v.Name)
+	reader, history := newLineReader(in, out)
+	s, err := newSession()
+	if err != nil {
+		fmt.Fprintf(out, "Woops! Loading prelude failed:\n %s\n", err)
+		return
 	}
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		scanned := scanner.Scan()
-		if !scanned {
+		input, err := readInput(reader)
+		if err == ErrInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
-
-		line := scanner.Text()
-		l := lexer.New(line)
-		p := parser.New(l)
-
-		program := p.ParseProgram()
-		if len(p.Errors()) != 0 {
-			printParseErrors(out, p.Errors())
+		if strings.TrimSpace(input) == "" {
 			continue
 		}
+		if err := history.Add(input); err != nil {
+			fmt.Fprintf(out, "Woops! Saving history failed:\n %s\n", err)
+		}
 
-		comp := compiler.NewWithState(symbolTable, constants)
-		err := comp.Compile(program)
-		if err != nil {
-			fmt.Fprintf(out, "Woops! Compilation failed:\n %s\n", err)
-			continue
+		if quit := s.handle(out, input, nil); quit {
+			return
 		}
+	}
+}
 
-		code := comp.Bytecode()
-		constants = code.Constants
+// newLineReader は in が端末なら行編集と履歴ファイルを使う Editor を、そうでなければ1行ずつ読む LineReader を返す
+func newLineReader(in io.Reader, out io.Writer) (LineReader, *History) {
+	f, ok := in.(*os.File)
+	if !ok || !isTerminal(f.Fd()) {
+		return &scannerReader{scanner: bufio.NewScanner(in), out: out}, NewHistory()
+	}
 
-		machine := vm.NewWithGlobalStore(code, globals)
-		err = machine.Run()
+	history := NewHistory()
+	if path, err := DefaultHistoryFile(); err == nil {
+		if h, err := LoadHistory(path); err == nil {
+			history = h
+		} else {
+			fmt.Fprintf(out, "Woops! Loading history failed:\n %s\n", err)
+		}
+	}
+
+	editor := NewEditor(in, out, history)
+	editor.raw = func() (func(), error) { return makeRaw(f.Fd()) }
+	return editor, history
+}
+
+// readInput は入力が完結するまで行を読み、改行でつないで返す
+func readInput(reader LineReader) (string, error) {
+	line, err := reader.ReadLine(PROMPT)
+	if err != nil {
+		return "", err
+	}
+	input := line
+	for Incomplete(input) {
+		line, err := reader.ReadLine(CONTINUATION_PROMPT)
 		if err != nil {
-			fmt.Fprintf(out, "Woops! Executing bytecode failed:\n %s\n", err)
-			continue
+			return "", err
 		}
+		input += "\n" + line
+	}
+	return input, nil
+}
+
+// printError は入力を実行できなかった理由を表示する
+func printError(out io.Writer, err error) {
+	e, ok := err.(*Error)
+	if !ok {
+		fmt.Fprintf(out, "Woops! %s\n", err)
+		return
+	}
+	if e.Stage == ParseStage {
+		printParseErrors(out, e.Messages)
+		return
+	}
 
-		lastPopped := machine.LastPoppedStackElem()
-		io.WriteString(out, lastPopped.Inspect())
-		io.WriteString(out, "\n")
+	stage := string(e.Stage)
+	fmt.Fprintf(out, "Woops! %s%s:\n", strings.ToUpper(stage[:1]), stage[1:])
+	for _, msg := range e.Messages {
+		fmt.Fprintf(out, " %s\n", msg)
 	}
 }
 
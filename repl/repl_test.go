@@ -0,0 +1,140 @@
+package repl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"", false},
+		{"let x = 1;", false},
+		{"let f = fn(x) {", true},
+		{"let f = fn(x) {\n  x * 2\n};", false},
+		{"[1, 2,", true},
+		{"puts(1", true},
+		{"1 +", true},
+		{"let x =", true},
+		{"if (x) { 1 } else", true},
+		{`"abc`, true},
+		{"`abc", true},
+		{`"${x`, true},
+		{"/* comment", true},
+		{"1 // +", false},
+		{"}", false},
+		{"{1: 2}}", false},
+	}
+
+	for _, tt := range tests {
+		if got := Incomplete(tt.input); got != tt.expected {
+			t.Errorf("Incomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	input := "let f = fn(x) {\n  x * 2\n}\nf(21)\n\n[1,\n2]\nlet x = ;\n"
+	var out strings.Builder
+	Start(strings.NewReader(input), &out)
+
+	// 関数の定義は3行で1つの入力になり、let 文と空行は何も表示しない
+	expected := ">> .. .. >> 42\n>> >> .. [1, 2]\n>> "
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Errorf("wrong output. want prefix=%q, got=%q", expected, out.String())
+	}
+	if !strings.Contains(out.String(), "parser errors:") {
+		t.Errorf("parser errors are not reported: %q", out.String())
+	}
+}
+
+func TestTransactions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		// コンパイルに失敗した let 文の名前は定義されない
+		{"let x = y;\nx", "undefined variable x"},
+		{"let x = y;\nlet x = 2;\nx", ">> >> 2\n"},
+		// 型エラーの入力で定義した型は残らない
+		{"let s = \"a\" + 1;\nlet s = 1;\ns + 1", ">> >> 2\n"},
+		// 実行時エラーの前に定義したグローバル変数も取り消す
+		{"let call = fn(f) { f() };\nlet a = 1; let b = call(1);\na", ">> Woops! Executing bytecode failed:\n calling non-function and non-built-in\n>> Woops! Compilation failed:\n undefined variable a\n"},
+		{"let call = fn(f) { f() };\nlet a = 1; let b = call(1);\nlet a = 5; a", ">> 5\n"},
+		// 同じ名前を再定義する入力が失敗しても、前の値が残る
+		{"let a = 1;\nlet a = 2; let b = 1();\na", ">> 1\n"},
+		{":bytecode let c = 1(); \nc", "undefined variable c"},
+		// 値を捨てない入力は何も表示しない
+		{"// comment\nlet a = 1;\n1", ">> >> >> 1\n"},
+		// トップレベルの return は入力のプログラムを終え、その値を表示する
+		{"return 1;\n2", ">> 1\n>> 2\n"},
+		{"return 1; 2\nlet a = 3; return a; 4", ">> 1\n>> 3\n"},
+		{"let a = 1;\n:env", ">> >> a = 1\n"},
+		// puts は REPL の出力に書き出す
+		{"puts(\"hi\");\n1", ">> hi\nnull\n>> 1\n"},
+	}
+
+	for _, tt := range tests {
+		var out strings.Builder
+		Start(strings.NewReader(tt.input+"\n"), &out)
+		if !strings.Contains(out.String(), tt.expected) {
+			t.Errorf("wrong output for %q. want to contain %q, got=%q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+
+	for _, input := range []string{"1 + 2", "  ", "1 + 2", "let f = fn() {\n  `a\\b`\n};", "f()\n"} {
+		if err := h.Add(input); err != nil {
+			t.Fatalf("Add failed: %s", err)
+		}
+	}
+	expected := []string{"1 + 2", "let f = fn() {\n  `a\\b`\n};", "f()"}
+
+	loaded, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	for _, entries := range [][]string{h.Entries(), loaded.Entries()} {
+		if strings.Join(entries, "|") != strings.Join(expected, "|") {
+			t.Errorf("wrong entries. want=%q, got=%q", expected, entries)
+		}
+	}
+}
+
+func TestHistoryLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+	var b strings.Builder
+	for i := 0; i < MaxHistory+10; i++ {
+		b.WriteString(strings.Repeat("x", i+1) + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory failed: %s", err)
+	}
+	if len(h.Entries()) != MaxHistory || h.Entries()[0] != strings.Repeat("x", 11) {
+		t.Errorf("history is not truncated. len=%d", len(h.Entries()))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != MaxHistory {
+		t.Errorf("history file is not rewritten. want %d lines, got %d", MaxHistory, lines)
+	}
+}
@@ -0,0 +1,179 @@
+package repl
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"monkey/object"
+	"monkey/types"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Interpreter は REPL の状態を Go のプログラムと共有する。
+// 組み込み先のプログラムが Eval や Define でグローバル変数を用意して Server の Shared に渡すと、
+// ネットワーク越しの REPL から同じグローバル変数を調べられる。すべての操作はロックで直列化する
+type Interpreter struct {
+	mu      sync.Mutex
+	session *session
+}
+
+// NewInterpreter は組み込み関数と prelude を読み込んだ Interpreter を返す
+func NewInterpreter() (*Interpreter, error) {
+	s, err := newSession()
+	if err != nil {
+		return nil, err
+	}
+	return &Interpreter{session: s}, nil
+}
+
+// Eval は src を1つの入力として実行し、最後の式文の値を返す。値を持たない入力では nil を返す。
+// 失敗した場合は *Error を返し、状態は src を実行する前に戻る。puts は標準出力に書き出す
+func (i *Interpreter) Eval(src string) (object.Object, error) {
+	return i.EvalTo(os.Stdout, src)
+}
+
+// EvalTo は Eval と同じく src を実行する。puts は out に書き出す
+func (i *Interpreter) EvalTo(out io.Writer, src string) (object.Object, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return i.session.evaluate(out, src, nil)
+}
+
+// Define はグローバル変数 name を定義して value を代入する。型検査では any として扱う
+func (i *Interpreter) Define(name string, value object.Object) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	symbol := i.session.symbolTable.Define(name)
+	i.session.globals[symbol.Index] = value
+	i.session.checker.Declare(name, types.Any)
+}
+
+// Names は参照できるグローバル変数と組み込み関数の名前を名前の順に返す
+func (i *Interpreter) Names() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	seen := map[string]bool{}
+	names := []string{}
+	for _, v := range object.Builtins {
+		seen[v.Name] = true
+		names = append(names, v.Name)
+	}
+	for _, sym := range i.session.symbolTable.Definitions() {
+		if !seen[sym.Name] {
+			seen[sym.Name] = true
+			names = append(names, sym.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// handle は input を実行するかコマンドとして処理する。timeout が 0 より大きければ、実行をその時間で打ち切る。
+// 時間はロックを取ってから数えるので、他の呼び出しを待つ時間は含まない
+func (i *Interpreter) handle(out io.Writer, input string, disabled map[string]bool, timeout time.Duration) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.session.timeout = timeout
+	defer func() { i.session.timeout = 0 }()
+	return i.session.handle(out, input, disabled)
+}
+
+const (
+	AuthTimeout = 10 * time.Second // 接続してからトークンを送るまでの制限時間
+	EvalTimeout = 30 * time.Second // Serve が使う、1つの入力を実行する時間の上限
+)
+
+// Server は REPL をネットワーク越しに提供する。接続ごとに1つのセッションを実行する。
+// 接続元のファイルを読むわけではないので :load は使えない。
+// puts の出力と式の値はどちらも接続元に送る
+type Server struct {
+	// Token が空でなければ、接続した直後に送る最初の行がこのトークンと一致しない接続を切る
+	Token string
+
+	// Shared が nil でなければ、すべての接続がこの Interpreter のグローバル変数を共有する。
+	// 共有した状態を消さないように :reset は使えない。
+	// nil なら接続ごとに独立したグローバル変数を持つ
+	Shared *Interpreter
+
+	// Timeout が 0 より大きければ、1つの入力の実行をこの時間で打ち切り、エラーとして接続元に返す。
+	// Shared を使う場合、実行中の入力は Interpreter をロックしているので、他の接続は最大でこの時間待たされる。
+	// 0 なら制限せず、終わらない入力は Shared を使う他の接続をすべて止めてしまう
+	Timeout time.Duration
+}
+
+// Serve は listener で接続を受け付け、接続ごとに独立したセッションを実行する。
+// token が空でなければ、最初の行で token を送った接続だけを受け付ける。1つの入力の実行は EvalTimeout で打ち切る
+func Serve(listener net.Listener, token string) error {
+	srv := &Server{Token: token, Timeout: EvalTimeout}
+	return srv.Serve(listener)
+}
+
+// Serve は listener で接続を受け付け、接続ごとにセッションを実行する。
+// listener が閉じられるまで返らず、閉じられた場合は nil を返す。実行中のセッションは接続元が切断するまで続く
+func (srv *Server) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go srv.serveConn(conn)
+	}
+}
+
+func (srv *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	scanner := bufio.NewScanner(conn)
+
+	if srv.Token != "" {
+		conn.SetReadDeadline(time.Now().Add(AuthTimeout))
+		io.WriteString(conn, "token: ")
+		if !scanner.Scan() || !srv.authenticate(scanner.Text()) {
+			io.WriteString(conn, "authentication failed\n")
+			return
+		}
+		conn.SetReadDeadline(time.Time{})
+	}
+
+	disabled := map[string]bool{":load": true}
+	interpreter := srv.Shared
+	if interpreter == nil {
+		var err error
+		if interpreter, err = NewInterpreter(); err != nil {
+			fmt.Fprintf(conn, "Woops! Loading prelude failed:\n %s\n", err)
+			return
+		}
+	} else {
+		disabled[":reset"] = true
+	}
+
+	reader := &scannerReader{scanner: scanner, out: conn}
+	for {
+		input, err := readInput(reader)
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(input) == "" {
+			continue
+		}
+		if quit := interpreter.handle(conn, input, disabled, srv.Timeout); quit {
+			return
+		}
+	}
+}
+
+// authenticate は送られたトークンを、長さ以外の情報を漏らさない時間で比較する
+func (srv *Server) authenticate(token string) bool {
+	token = strings.TrimSuffix(token, "\r")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(srv.Token)) == 1
+}
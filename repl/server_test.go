@@ -0,0 +1,230 @@
+package repl
+
+import (
+	"bufio"
+	"io"
+	"monkey/object"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// client は Serve に接続して、プロンプトまでの出力を読む
+type client struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dial(t *testing.T, listener net.Listener) *client {
+	t.Helper()
+	conn, err := net.Dial(listener.Addr().Network(), listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial failed: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	return &client{t: t, conn: conn, r: bufio.NewReader(conn)}
+}
+
+// readUntil は出力が suffix で終わるまで読み、suffix を除いて返す
+func (c *client) readUntil(suffix string) string {
+	c.t.Helper()
+	var b strings.Builder
+	for !strings.HasSuffix(b.String(), suffix) {
+		ch, err := c.r.ReadByte()
+		if err != nil {
+			c.t.Fatalf("reading %q failed after %q: %s", suffix, b.String(), err)
+		}
+		b.WriteByte(ch)
+	}
+	return strings.TrimSuffix(b.String(), suffix)
+}
+
+// send は1行を送り、次のプロンプトまでの出力を返す
+func (c *client) send(line string) string {
+	c.t.Helper()
+	if _, err := io.WriteString(c.conn, line+"\n"); err != nil {
+		c.t.Fatalf("writing %q failed: %s", line, err)
+	}
+	return c.readUntil(PROMPT)
+}
+
+func serve(t *testing.T, network, address string, srv *Server) net.Listener {
+	t.Helper()
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatalf("Listen failed: %s", err)
+	}
+	done := make(chan error)
+	go func() { done <- srv.Serve(listener) }()
+	t.Cleanup(func() {
+		listener.Close()
+		if err := <-done; err != nil {
+			t.Errorf("Serve returned an error: %s", err)
+		}
+	})
+	return listener
+}
+
+func TestServeIndependentSessions(t *testing.T) {
+	for _, network := range []struct{ name, address string }{
+		{"tcp", "127.0.0.1:0"},
+		{"unix", filepath.Join(t.TempDir(), "repl.sock")},
+	} {
+		listener := serve(t, network.name, network.address, &Server{})
+		a, b := dial(t, listener), dial(t, listener)
+		a.readUntil(PROMPT)
+		b.readUntil(PROMPT)
+
+		if got := a.send("let x = 1;"); got != "" {
+			t.Errorf("%s: let printed %q", network.name, got)
+		}
+		if got := b.send("x"); !strings.Contains(got, "undefined variable x") {
+			t.Errorf("%s: sessions share globals: %q", network.name, got)
+		}
+		io.WriteString(a.conn, "let f = fn(y) {\r\n  y\n")
+		if got := a.readUntil(CONTINUATION_PROMPT + CONTINUATION_PROMPT); got != "" {
+			t.Errorf("%s: wrong output before continuation prompts: %q", network.name, got)
+		}
+		a.send("}")
+		if got := a.send("[x, f(2)]"); got != "[1, 2]\n" {
+			t.Errorf("%s: wrong result. got=%q", network.name, got)
+		}
+		if got := a.send(":load /etc/passwd"); got != "command :load is not available in this session\n" {
+			t.Errorf("%s: :load is not disabled: %q", network.name, got)
+		}
+		if got := b.send(":reset"); got != "" {
+			t.Errorf("%s: :reset failed: %q", network.name, got)
+		}
+	}
+}
+
+func TestServeShared(t *testing.T) {
+	interpreter, err := NewInterpreter()
+	if err != nil {
+		t.Fatalf("NewInterpreter failed: %s", err)
+	}
+	interpreter.Define("config", object.NewHash(0))
+	interpreter.Define("name", &object.String{Value: "service"})
+	if _, err := interpreter.Eval("let count = 3;"); err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+
+	listener := serve(t, "tcp", "127.0.0.1:0", &Server{Shared: interpreter})
+	a, b := dial(t, listener), dial(t, listener)
+	a.readUntil(PROMPT)
+	b.readUntil(PROMPT)
+
+	if got := a.send(`name + "!"`); got != "service!\n" {
+		t.Errorf("defined global is not visible. got=%q", got)
+	}
+	a.send("let total = count + 1;")
+	if got := b.send("total"); got != "4\n" {
+		t.Errorf("sessions do not share globals. got=%q", got)
+	}
+	if got := b.send(":reset"); got != "command :reset is not available in this session\n" {
+		t.Errorf(":reset is not disabled: %q", got)
+	}
+
+	result, err := interpreter.Eval("total * 10")
+	if err != nil {
+		t.Fatalf("Eval failed: %s", err)
+	}
+	if result.Inspect() != "40" {
+		t.Errorf("host does not see the session's globals. got=%s", result.Inspect())
+	}
+
+	// 失敗した入力は共有した状態を変えない
+	if _, err := interpreter.Eval("let call = fn(f) { f() }; let total = call(1);"); err == nil {
+		t.Errorf("Eval of a failing input returned no error")
+	} else if e, ok := err.(*Error); !ok || e.Stage != RunStage {
+		t.Errorf("wrong error: %#v", err)
+	}
+	if got := a.send("total"); got != "4\n" {
+		t.Errorf("failed input changed the shared state. got=%q", got)
+	}
+}
+
+func TestServeOutputAndTimeout(t *testing.T) {
+	interpreter, err := NewInterpreter()
+	if err != nil {
+		t.Fatalf("NewInterpreter failed: %s", err)
+	}
+	listener := serve(t, "tcp", "127.0.0.1:0", &Server{Shared: interpreter, Timeout: 100 * time.Millisecond})
+	a, b := dial(t, listener), dial(t, listener)
+	a.readUntil(PROMPT)
+	b.readUntil(PROMPT)
+
+	// puts の出力は入力を送った接続にだけ届く
+	if got := a.send(`puts("hi")`); got != "hi\nnull\n" {
+		t.Errorf("wrong output of puts. got=%q", got)
+	}
+	if got := b.send("1"); got != "1\n" {
+		t.Errorf("output of another session leaked. got=%q", got)
+	}
+
+	// 終わらない入力は打ち切られ、他の接続を止め続けない
+	io.WriteString(a.conn, "let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; let x = f(100);\n")
+	if got := b.send("1 + 1"); got != "2\n" {
+		t.Errorf("wrong result while another session runs. got=%q", got)
+	}
+	if got := a.readUntil(PROMPT); !strings.Contains(got, "timed out after 100ms") {
+		t.Errorf("long input is not interrupted. got=%q", got)
+	}
+	if got := a.send("x"); !strings.Contains(got, "undefined variable x") {
+		t.Errorf("interrupted input changed the shared state. got=%q", got)
+	}
+}
+
+func TestServeAuthentication(t *testing.T) {
+	listener := serve(t, "tcp", "127.0.0.1:0", &Server{Token: "secret"})
+
+	c := dial(t, listener)
+	c.readUntil("token: ")
+	io.WriteString(c.conn, "wrong\n")
+	rest, _ := io.ReadAll(c.r)
+	if string(rest) != "authentication failed\n" {
+		t.Errorf("wrong response to a bad token: %q", rest)
+	}
+
+	c = dial(t, listener)
+	c.readUntil("token: ")
+	io.WriteString(c.conn, "secret\r\n")
+	c.readUntil(PROMPT)
+	if got := c.send("1 + 2"); got != "3\n" {
+		t.Errorf("wrong result after authentication. got=%q", got)
+	}
+	if _, err := io.WriteString(c.conn, ":quit\n"); err != nil {
+		t.Fatal(err)
+	}
+	if rest, _ := io.ReadAll(c.r); len(rest) != 0 {
+		t.Errorf(":quit does not close the connection: %q", rest)
+	}
+}
+
+func TestInterpreterNames(t *testing.T) {
+	interpreter, err := NewInterpreter()
+	if err != nil {
+		t.Fatalf("NewInterpreter failed: %s", err)
+	}
+	interpreter.Eval("let zebra = 1; let zebra = 2;")
+	interpreter.Define("apple", &object.Integer{Value: 1})
+
+	names := interpreter.Names()
+	count := map[string]int{}
+	for _, name := range names {
+		count[name]++
+	}
+	for _, want := range []string{"zebra", "apple", "len", "puts", "map"} {
+		if count[want] != 1 {
+			t.Errorf("%s appears %d times in %v", want, count[want], names)
+		}
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("names are not sorted: %v", names)
+	}
+}
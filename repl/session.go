@@ -0,0 +1,219 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/stdlib"
+	"monkey/types"
+	"monkey/vm"
+	"strings"
+	"time"
+)
+
+// Stage は入力を処理する段階
+type Stage string
+
+const (
+	ParseStage   Stage = "parser errors"
+	CheckStage   Stage = "type check failed"
+	CompileStage Stage = "compilation failed"
+	RunStage     Stage = "executing bytecode failed"
+)
+
+// Error は入力を実行できなかったときのエラー
+type Error struct {
+	Stage    Stage
+	Messages []string
+}
+
+func (e *Error) Error() string {
+	return string(e.Stage) + ": " + strings.Join(e.Messages, "; ")
+}
+
+// session は REPL の状態。入力をまたいでグローバル変数と定数、型を保持する
+type session struct {
+	constants      []object.Object
+	globals        []object.Object
+	symbolTable    *compiler.SymbolTable
+	checker        *types.Checker
+	preludeGlobals int           // prelude が定義したグローバル変数の数
+	timeout        time.Duration // 0 より大きければ、1つの入力の実行をこの時間で打ち切る
+}
+
+// newSession は組み込み関数と prelude を読み込んだ session を返す
+func newSession() (*session, error) {
+	s := &session{
+		globals:     make([]object.Object, vm.GlobalSize),
+		symbolTable: compiler.NewSymbolTable(),
+		checker:     types.New(),
+	}
+	for i, v := range object.Builtins {
+		s.symbolTable.DefineBuiltin(i, v.Name)
+	}
+
+	constants, err := stdlib.LoadCompiled(s.symbolTable, []object.Object{}, s.globals)
+	if err != nil {
+		return nil, err
+	}
+	s.constants = constants
+	s.preludeGlobals = len(s.symbolTable.Definitions())
+	return s, nil
+}
+
+// handle は1つの入力を実行するかコマンドとして処理し、結果を out に書き出す。
+// disabled のコマンドは実行しない。REPL を終了する場合は true を返す
+func (s *session) handle(out io.Writer, input string, disabled map[string]bool) bool {
+	if isCommand(input) {
+		return s.command(out, input, disabled)
+	}
+
+	result, err := s.evaluate(out, input, nil)
+	if err != nil {
+		printError(out, err)
+		return false
+	}
+	printResult(out, result)
+	return false
+}
+
+// evaluate は input を1つのトランザクションとして型検査、コンパイル、実行し、値を返す。
+// 最後の文が式文でなければ値は nil になる。
+// puts は out に書き出す。
+// before が nil でなければ、実行する直前にバイトコードとこの入力で増えた定数のインデックスを渡す
+func (s *session) evaluate(out io.Writer, input string, before func(code *compiler.Bytecode, defined int)) (object.Object, error) {
+	program, err := parse(input)
+	if err != nil {
+		return nil, err
+	}
+
+	var result object.Object
+	err = s.transact(func() error {
+		defined := len(s.constants)
+		code, err := s.compile(program)
+		if err != nil {
+			return err
+		}
+		if before != nil {
+			before(code, defined)
+		}
+		result, err = s.run(out, code)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return value(program, result), nil
+}
+
+// transaction は入力を実行する前の session の状態
+type transaction struct {
+	constants   []object.Object
+	symbolTable *compiler.SymbolTable
+	checker     *types.Checker
+	globals     []object.Object // 入力の前に定義されていたグローバル変数の値
+}
+
+// transact は f を1つの入力として実行する。f がエラーを返したら、型検査やコンパイルで定義した名前と、
+// 実行中に代入したグローバル変数を取り消し、f を呼ぶ前の状態に戻す
+func (s *session) transact(f func() error) error {
+	tx := &transaction{
+		constants:   s.constants,
+		symbolTable: s.symbolTable.Clone(),
+		checker:     s.checker.Clone(),
+		globals:     append([]object.Object{}, s.globals[:len(s.symbolTable.Definitions())]...),
+	}
+	err := f()
+	if err == nil {
+		return nil
+	}
+
+	copy(s.globals, tx.globals)
+	clear(s.globals[len(tx.globals):len(s.symbolTable.Definitions())])
+	s.constants = tx.constants
+	s.symbolTable = tx.symbolTable
+	s.checker = tx.checker
+	return err
+}
+
+// parse は入力を構文解析する
+func parse(input string) (*ast.Program, error) {
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, &Error{Stage: ParseStage, Messages: p.Errors()}
+	}
+	return program, nil
+}
+
+// compile はプログラムを型検査してコンパイルする
+func (s *session) compile(program *ast.Program) (*compiler.Bytecode, error) {
+	if errors := s.checker.Check(program); len(errors) != 0 {
+		messages := []string{}
+		for _, err := range errors {
+			messages = append(messages, err.Error())
+		}
+		return nil, &Error{Stage: CheckStage, Messages: messages}
+	}
+
+	comp := compiler.NewWithState(s.symbolTable, s.constants)
+	if err := comp.Compile(program); err != nil {
+		return nil, &Error{Stage: CompileStage, Messages: []string{err.Error()}}
+	}
+
+	code := comp.Bytecode()
+	s.constants = code.Constants
+	return code, nil
+}
+
+// run はバイトコードを VM で実行し、最後に捨てた値を返す。puts は out に書き出す。
+// VM が panic しても REPL は終了せず、エラーとして扱う
+func (s *session) run(out io.Writer, code *compiler.Bytecode) (result object.Object, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			result, err = nil, &Error{Stage: RunStage, Messages: []string{fmt.Sprintf("internal error: %v", r)}}
+		}
+	}()
+
+	machine := vm.NewWithGlobalStore(code, s.globals)
+	machine.SetOutput(out)
+	if s.timeout > 0 {
+		timer := time.AfterFunc(s.timeout, machine.Interrupt)
+		defer timer.Stop()
+	}
+	if err := machine.Run(); err != nil {
+		if errors.Is(err, vm.ErrInterrupted) {
+			err = fmt.Errorf("timed out after %s", s.timeout)
+		}
+		return nil, &Error{Stage: RunStage, Messages: []string{err.Error()}}
+	}
+	return machine.LastPoppedStackElem(), nil
+}
+
+// value は program の最後の文が式文か return 文なら、最後に捨てた値を返す。
+// トップレベルの return はその値を最後に捨てた値としてプログラムを終える。
+// let 文は値をスタックから捨てないので、最後に捨てた値は以前の入力のものかもしれず、nil を返す
+func value(program *ast.Program, result object.Object) object.Object {
+	if len(program.Statements) == 0 {
+		return nil
+	}
+	switch program.Statements[len(program.Statements)-1].(type) {
+	case *ast.ExpressionStatement, *ast.ReturnStatement:
+		return result
+	}
+	return nil
+}
+
+// printResult は値があれば表示する
+func printResult(out io.Writer, result object.Object) {
+	if result == nil {
+		return
+	}
+	io.WriteString(out, result.Inspect())
+	io.WriteString(out, "\n")
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package repl
+
+import "errors"
+
+// Linux 以外では raw モードに対応しないので、行編集をせずに1行ずつ読む
+
+func makeRaw(fd uintptr) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this platform")
+}
+
+func isTerminal(fd uintptr) bool {
+	return false
+}
@@ -0,0 +1,220 @@
+// Package resolver は AST の識別子を、コンパイラと同じ規則で解決する。
+// スコープの管理には compiler.SymbolTable を使うため、解決結果(グローバル・ローカル・
+// 自由変数・組み込み関数)はコンパイラが生成するバイトコードと一致する。
+// 言語サーバーや静的解析で、定義と参照の対応を調べるために使う。
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/object"
+)
+
+// Kind は束縛の種類
+type Kind int
+
+const (
+	Let       Kind = iota // let 文による束縛
+	Parameter             // 関数の引数
+	Builtin               // 組み込み関数
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Let:
+		return "let"
+	case Parameter:
+		return "parameter"
+	case Builtin:
+		return "builtin"
+	}
+	return "unknown"
+}
+
+// Binding は名前の定義を表す
+type Binding struct {
+	Name  string
+	Kind  Kind
+	Scope compiler.SymbolScope // 定義したスコープ (GLOBAL, LOCAL, BUILTIN)
+
+	Ident    *ast.Identifier      // 定義している識別子。組み込み関数の場合は nil
+	Value    ast.Expression       // let 文の右辺。それ以外は nil
+	Function *ast.FunctionLiteral // 定義を含む関数リテラル。グローバルと組み込み関数の場合は nil
+	Index    int                  // 組み込み関数の場合は object.Builtins のインデックス
+
+	Uses    []*ast.Identifier // この束縛を参照している識別子
+	Shadows *Binding          // 定義した時点で同じ名前で見えていた束縛。なければ nil
+}
+
+// Reference は識別子による名前の参照を表す
+type Reference struct {
+	Ident   *ast.Identifier
+	Symbol  compiler.Symbol // 参照している位置から見たシンボル。FREE や FUNCTION になることもある
+	Binding *Binding
+}
+
+// Info は1つのプログラムの解決結果
+type Info struct {
+	Defs       map[*ast.Identifier]*Binding   // 定義している識別子から束縛へ
+	Uses       map[*ast.Identifier]*Reference // 参照している識別子から参照へ
+	Bindings   []*Binding                     // このプログラムで定義された束縛 (定義順)
+	Unresolved []*ast.Identifier              // 定義が見つからなかった識別子
+	Functions  []*ast.FunctionLiteral         // このプログラムに含まれる関数リテラル (出現順)
+}
+
+// Resolver は識別子を解決する。グローバルスコープは Resolve の呼び出しをまたいで保持されるため、
+// prelude のような先に読み込まれるプログラムを解決してから、利用者のプログラムを解決できる。
+type Resolver struct {
+	scope   *scope
+	globals []*Binding
+}
+
+type scope struct {
+	outer    *scope
+	symbols  *compiler.SymbolTable
+	bindings map[string]*Binding
+	function *ast.FunctionLiteral
+}
+
+// New は組み込み関数を定義した Resolver を返す
+func New() *Resolver {
+	r := &Resolver{
+		scope: &scope{
+			symbols:  compiler.NewSymbolTable(),
+			bindings: make(map[string]*Binding),
+		},
+	}
+
+	for i, v := range object.Builtins {
+		symbol := r.scope.symbols.DefineBuiltin(i, v.Name)
+		binding := &Binding{Name: v.Name, Kind: Builtin, Scope: symbol.Scope, Index: i}
+		r.scope.bindings[v.Name] = binding
+		r.globals = append(r.globals, binding)
+	}
+	return r
+}
+
+// Globals はグローバルスコープで参照できる束縛(組み込み関数を含む)を定義順に返す。
+// 同じ名前が再定義された場合は最後の定義だけを返す。
+func (r *Resolver) Globals() []*Binding {
+	globals := []*Binding{}
+	for _, b := range r.globals {
+		if r.globalScope().bindings[b.Name] == b {
+			globals = append(globals, b)
+		}
+	}
+	return globals
+}
+
+func (r *Resolver) globalScope() *scope {
+	s := r.scope
+	for s.outer != nil {
+		s = s.outer
+	}
+	return s
+}
+
+// Resolve は program に含まれる識別子を解決する
+func (r *Resolver) Resolve(program *ast.Program) *Info {
+	info := &Info{
+		Defs: make(map[*ast.Identifier]*Binding),
+		Uses: make(map[*ast.Identifier]*Reference),
+	}
+
+	for _, stmt := range program.Statements {
+		r.walk(stmt, info)
+	}
+	return info
+}
+
+func (r *Resolver) walk(node ast.Node, info *Info) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.LetStatement:
+			// コンパイラと同様に、右辺を解決する前に名前を定義する(再帰関数のため)
+			r.define(n.Name, Let, n.Value, info)
+			if n.Value != nil {
+				r.walk(n.Value, info)
+			}
+			return false
+		case *ast.FunctionLiteral:
+			r.walkFunction(n, info)
+			return false
+		case *ast.Identifier:
+			r.resolve(n, info)
+		}
+		return true
+	})
+}
+
+func (r *Resolver) walkFunction(fn *ast.FunctionLiteral, info *Info) {
+	info.Functions = append(info.Functions, fn)
+
+	r.scope = &scope{
+		outer:    r.scope,
+		symbols:  compiler.NewEnclosedSymbolTable(r.scope.symbols),
+		bindings: make(map[string]*Binding),
+		function: fn,
+	}
+
+	if fn.Name != "" {
+		r.scope.symbols.DefineFunctionName(fn.Name)
+	}
+	for _, p := range fn.Parameters {
+		r.define(p, Parameter, nil, info)
+	}
+	if fn.Body != nil {
+		r.walk(fn.Body, info)
+	}
+
+	r.scope = r.scope.outer
+}
+
+func (r *Resolver) define(ident *ast.Identifier, kind Kind, value ast.Expression, info *Info) {
+	shadows := r.lookup(ident.Value)
+	symbol := r.scope.symbols.Define(ident.Value)
+	binding := &Binding{
+		Name:     ident.Value,
+		Kind:     kind,
+		Scope:    symbol.Scope,
+		Ident:    ident,
+		Value:    value,
+		Function: r.scope.function,
+		Shadows:  shadows,
+	}
+
+	r.scope.bindings[ident.Value] = binding
+	info.Defs[ident] = binding
+	info.Bindings = append(info.Bindings, binding)
+	if r.scope.outer == nil {
+		r.globals = append(r.globals, binding)
+	}
+}
+
+func (r *Resolver) resolve(ident *ast.Identifier, info *Info) {
+	symbol, ok := r.scope.symbols.Resolve(ident.Value)
+	if !ok {
+		info.Unresolved = append(info.Unresolved, ident)
+		return
+	}
+
+	binding := r.lookup(ident.Value)
+	if binding == nil {
+		info.Unresolved = append(info.Unresolved, ident)
+		return
+	}
+
+	binding.Uses = append(binding.Uses, ident)
+	info.Uses[ident] = &Reference{Ident: ident, Symbol: symbol, Binding: binding}
+}
+
+// lookup は名前を内側のスコープから順に探す。
+// 関数名(FUNCTION スコープ)は関数を束縛している let 文の束縛として見つかる。
+func (r *Resolver) lookup(name string) *Binding {
+	for s := r.scope; s != nil; s = s.outer {
+		if b, ok := s.bindings[name]; ok {
+			return b
+		}
+	}
+	return nil
+}
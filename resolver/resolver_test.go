@@ -0,0 +1,146 @@
+package resolver
+
+import (
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/lexer"
+	"monkey/parser"
+	"testing"
+)
+
+func TestResolveScopes(t *testing.T) {
+	input := `
+let g = 1;
+let outer = fn(a) {
+	let b = a + g;
+	fn(c) { a + b + c + len(g) + outer(c) };
+};
+let self = fn() { self() };
+`
+	program := parse(t, input)
+	info := New().Resolve(program)
+
+	tests := []struct {
+		line          int
+		name          string
+		expectedScope compiler.SymbolScope
+		expectedKind  Kind
+		expectedLine  int // 定義の行。組み込み関数の場合は 0
+	}{
+		{4, "a", compiler.LocalScope, Parameter, 3},
+		{4, "g", compiler.GlobalScope, Let, 2},
+		{5, "a", compiler.FreeScope, Parameter, 3},
+		{5, "b", compiler.FreeScope, Let, 4},
+		{5, "c", compiler.LocalScope, Parameter, 5},
+		{5, "len", compiler.BuiltinScope, Builtin, 0},
+		{5, "outer", compiler.FreeScope, Let, 3},
+		{7, "self", compiler.FunctionScope, Let, 7},
+	}
+
+	for _, tt := range tests {
+		ref := findUse(t, info, tt.line, tt.name)
+
+		if ref.Symbol.Scope != tt.expectedScope {
+			t.Errorf("%s on line %d: wrong scope. expected=%s, got=%s", tt.name, tt.line, tt.expectedScope, ref.Symbol.Scope)
+		}
+		if ref.Binding.Kind != tt.expectedKind {
+			t.Errorf("%s on line %d: wrong kind. expected=%s, got=%s", tt.name, tt.line, tt.expectedKind, ref.Binding.Kind)
+		}
+
+		line := 0
+		if ref.Binding.Ident != nil {
+			line = ref.Binding.Ident.Token.Line
+		}
+		if line != tt.expectedLine {
+			t.Errorf("%s on line %d: wrong definition. expected line %d, got=%d", tt.name, tt.line, tt.expectedLine, line)
+		}
+	}
+
+	if len(info.Unresolved) != 0 {
+		t.Errorf("unexpected unresolved identifiers: %v", info.Unresolved)
+	}
+}
+
+func TestResolveLocalFunctionName(t *testing.T) {
+	input := `
+let wrapper = fn() {
+	let inner = fn(x) { inner(x) };
+	inner(1);
+};
+`
+	info := New().Resolve(parse(t, input))
+
+	recursive := findUse(t, info, 3, "inner")
+	if recursive.Symbol.Scope != compiler.FunctionScope {
+		t.Errorf("wrong scope. expected=%s, got=%s", compiler.FunctionScope, recursive.Symbol.Scope)
+	}
+	if recursive.Binding.Scope != compiler.LocalScope || recursive.Binding.Ident.Token.Line != 3 {
+		t.Errorf("wrong binding for recursive call: %+v", recursive.Binding)
+	}
+
+	call := findUse(t, info, 4, "inner")
+	if call.Binding != recursive.Binding {
+		t.Errorf("expected both uses to refer to the same binding")
+	}
+	if len(call.Binding.Uses) != 2 {
+		t.Errorf("wrong number of uses. expected=2, got=%d", len(call.Binding.Uses))
+	}
+}
+
+func TestResolveUnresolved(t *testing.T) {
+	info := New().Resolve(parse(t, "let f = fn(x) { x + y }; z;"))
+
+	if len(info.Unresolved) != 2 {
+		t.Fatalf("wrong number of unresolved identifiers. expected=2, got=%d", len(info.Unresolved))
+	}
+	if info.Unresolved[0].Value != "y" || info.Unresolved[1].Value != "z" {
+		t.Errorf("wrong unresolved identifiers. got=%s, %s", info.Unresolved[0], info.Unresolved[1])
+	}
+}
+
+func TestResolveGlobalsAcrossPrograms(t *testing.T) {
+	r := New()
+	first := r.Resolve(parse(t, "let double = fn(x) { x * 2 }; let a = 1;"))
+	second := r.Resolve(parse(t, "let a = double(2);"))
+
+	ref := findUse(t, second, 1, "double")
+	if first.Defs[ref.Binding.Ident] != ref.Binding {
+		t.Errorf("expected double to resolve to the definition in the first program")
+	}
+
+	globals := map[string]*Binding{}
+	for _, b := range r.Globals() {
+		if _, ok := globals[b.Name]; ok {
+			t.Errorf("duplicated global %s", b.Name)
+		}
+		globals[b.Name] = b
+	}
+
+	if b, ok := globals["len"]; !ok || b.Kind != Builtin {
+		t.Errorf("expected builtin len in globals")
+	}
+	if b, ok := globals["a"]; !ok || second.Defs[b.Ident] != b {
+		t.Errorf("expected a to be the redefinition in the second program")
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func findUse(t *testing.T, info *Info, line int, name string) *Reference {
+	t.Helper()
+	for ident, ref := range info.Uses {
+		if ident.Token.Line == line && ident.Value == name {
+			return ref
+		}
+	}
+	t.Fatalf("no use of %s on line %d", name, line)
+	return nil
+}
@@ -0,0 +1,111 @@
+// arr[lo:hi] を二分しながら畳み込む。再帰の深さを O(log n) に抑えるため
+let __reduce = fn(arr, lo, hi, acc, f) {
+	if (hi - lo == 0) { return acc; }
+	if (hi - lo == 1) { return f(acc, arr[lo]); }
+	let mid = lo + (hi - lo) / 2;
+	__reduce(arr, mid, hi, __reduce(arr, lo, mid, acc, f), f);
+};
+
+// reduce(arr, initial, f) は f(acc, x) で配列を左から畳み込む
+let reduce = fn(arr, initial, f) {
+	__reduce(arr, 0, len(arr), initial, f);
+};
+
+// map(arr, f) は各要素に f を適用した配列を返す。
+// push は直前に push した配列への追加では要素をコピーしないので、畳み込みながら push しても線形時間で済む
+let map = fn(arr, f) {
+	reduce(arr, [], fn(acc, x) { push(acc, f(x)) });
+};
+
+// filter(arr, f) は f(x) が真になる要素だけの配列を返す
+let filter = fn(arr, f) {
+	reduce(arr, [], fn(acc, x) {
+		if (f(x)) { push(acc, x) } else { acc }
+	});
+};
+
+// flatMap(arr, f) は f(x) が返す配列を連結した配列を返す
+let flatMap = fn(arr, f) {
+	reduce(arr, [], fn(acc, x) { reduce(f(x), acc, push) });
+};
+
+// arr[lo:hi] で f(x) が真になる最初の要素の位置を返す。見つからなければ -1。
+// 前半で見つかれば後半の要素には f を呼ばない。__reduce と同じく二分して再帰を浅く保つ
+let __findIndex = fn(arr, lo, hi, f) {
+	if (hi - lo == 0) { return -1; }
+	if (hi - lo == 1) { return if (f(arr[lo])) { lo } else { -1 }; }
+	let mid = lo + (hi - lo) / 2;
+	let i = __findIndex(arr, lo, mid, f);
+	if (i > -1) { return i; }
+	__findIndex(arr, mid, hi, f);
+};
+
+// find(arr, f) は f(x) が真になる最初の要素を返す。見つからなければ null
+let find = fn(arr, f) {
+	let i = __findIndex(arr, 0, len(arr), f);
+	if (i > -1) { arr[i] }
+};
+
+// any(arr, f) は f(x) が真になる要素があるかどうかを返す。見つかった後の要素には f を呼ばない
+let any = fn(arr, f) {
+	__findIndex(arr, 0, len(arr), f) > -1;
+};
+
+// all(arr, f) はすべての要素で f(x) が真になるかどうかを返す。偽になった後の要素には f を呼ばない
+let all = fn(arr, f) {
+	__findIndex(arr, 0, len(arr), fn(x) { !f(x) }) < 0;
+};
+
+// sum(arr) は整数の配列の合計を返す
+let sum = fn(arr) {
+	reduce(arr, 0, fn(acc, x) { acc + x });
+};
+
+// reverse(arr) は逆順の配列を返す
+let reverse = fn(arr) {
+	map(range(len(arr) - 1, -1, -1), fn(i) { arr[i] });
+};
+
+// take(arr, n) は先頭 n 要素を返す
+let take = fn(arr, n) {
+	arr[:n];
+};
+
+// drop(arr, n) は先頭 n 要素を除いた配列を返す
+let drop = fn(arr, n) {
+	arr[n:];
+};
+
+// zip(a, b) は対応する要素の組 [a[i], b[i]] の配列を返す。短い方に合わせる
+let zip = fn(a, b) {
+	let n = if (len(a) < len(b)) { len(a) } else { len(b) };
+	map(range(n), fn(i) { [a[i], b[i]] });
+};
+
+// ソート済みの a と b を less の順序でマージする(安定)
+let __merge = fn(a, b, less) {
+	let merged = reduce(range(len(a) + len(b)), [0, 0, []], fn(state, _) {
+		let i = state[0];
+		let j = state[1];
+		if (j == len(b)) { return [i + 1, j, push(state[2], a[i])]; }
+		if (i == len(a)) { return [i, j + 1, push(state[2], b[j])]; }
+		if (less(b[j], a[i])) {
+			[i, j + 1, push(state[2], b[j])];
+		} else {
+			[i + 1, j, push(state[2], a[i])];
+		}
+	});
+	merged[2];
+};
+
+// sortBy(arr, less) は less(a, b) を比較関数とするマージソートの結果を返す
+let sortBy = fn(arr, less) {
+	if (len(arr) < 2) { return arr; }
+	let mid = len(arr) / 2;
+	__merge(sortBy(take(arr, mid), less), sortBy(drop(arr, mid), less), less);
+};
+
+// repeat(s, n) は s を n 回繰り返した文字列を返す
+let repeat = fn(s, n) {
+	reduce(range(n), "", fn(acc, _) { acc + s });
+};
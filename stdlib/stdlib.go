@@ -0,0 +1,71 @@
+// Package stdlib は Monkey で書かれた標準ライブラリ(prelude)を提供する。
+// prelude はインタプリタ起動時に自動で読み込まれ、map / filter / reduce などの
+// リスト・文字列・ハッシュ操作を提供する。
+// range / sort / join / split / keys / values / set / merge / fromPairs / mapValues などの性能が必要な部分は
+// object.Builtins のネイティブ組み込み関数として実装されている。
+package stdlib
+
+import (
+	_ "embed"
+	"fmt"
+	"monkey/ast"
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"strings"
+)
+
+//go:embed prelude.mk
+var Prelude string
+
+// Program は prelude をコメント付きで解析した AST を返す。
+// 言語サーバーや静的解析で prelude の定義を調べるために使う
+func Program() (*ast.Program, error) {
+	l := lexer.NewWithComments(Prelude)
+	p := parser.New(l)
+
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("prelude: parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	return program, nil
+}
+
+// LoadEnvironment は evaluator 用に prelude を評価し、env に束縛する
+func LoadEnvironment(env *object.Environment) error {
+	program, err := Program()
+	if err != nil {
+		return err
+	}
+
+	result := evaluator.Eval(program, env)
+	if errObj, ok := result.(*object.Error); ok {
+		return fmt.Errorf("prelude: %s", errObj.Message)
+	}
+	return nil
+}
+
+// LoadCompiled は VM 用に prelude をコンパイル・実行し、symbolTable と globals に束縛する。
+// prelude の定数を追加した新しい定数プールを返す。
+func LoadCompiled(symbolTable *compiler.SymbolTable, constants []object.Object, globals []object.Object) ([]object.Object, error) {
+	program, err := Program()
+	if err != nil {
+		return constants, err
+	}
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(program); err != nil {
+		return constants, fmt.Errorf("prelude: %s", err)
+	}
+
+	code := comp.Bytecode()
+	machine := vm.NewWithGlobalStore(code, globals)
+	if err := machine.Run(); err != nil {
+		return constants, fmt.Errorf("prelude: %s", err)
+	}
+
+	return code.Constants, nil
+}
@@ -0,0 +1,178 @@
+package stdlib
+
+import (
+	"monkey/compiler"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/vm"
+	"testing"
+)
+
+type preludeTestCase struct {
+	input    string
+	expected string // 結果の Inspect()
+}
+
+func TestListUtilities(t *testing.T) {
+	tests := []preludeTestCase{
+		{"map([1, 2, 3], fn(x) { x * 2 })", "[2, 4, 6]"},
+		{"map([], fn(x) { x * 2 })", "[]"},
+		{"filter([1, 2, 3, 4], fn(x) { x > 2 })", "[3, 4]"},
+		{"reduce([1, 2, 3, 4], 0, fn(acc, x) { acc + x })", "10"},
+		{"reduce([1, 2, 3], [], fn(acc, x) { push(acc, x) })", "[1, 2, 3]"},
+		{"flatMap([1, 2], fn(x) { [x, x] })", "[1, 1, 2, 2]"},
+		{"find([1, 2, 3], fn(x) { x > 1 })", "2"},
+		{"find([1, 2, 3], fn(x) { x > 5 })", "null"},
+		{"any([1, 2, 3], fn(x) { x > 2 })", "true"},
+		{"all([1, 2, 3], fn(x) { x > 2 })", "false"},
+		{"all(range(3000), fn(x) { x > -1 })", "true"},
+		{"find([], fn(x) { true })", "null"},
+		{"sum(range(101))", "5050"},
+		{"reverse([1, 2, 3])", "[3, 2, 1]"},
+		{"take([1, 2, 3], 2)", "[1, 2]"},
+		{"take([1, 2, 3], 5)", "[1, 2, 3]"},
+		{"drop([1, 2, 3], 2)", "[3]"},
+		{"zip([1, 2, 3], [4, 5])", "[[1, 4], [2, 5]]"},
+		{"sortBy([3, 1, 2], fn(a, b) { a < b })", "[1, 2, 3]"},
+		{"sortBy([3, 1, 2], fn(a, b) { a > b })", "[3, 2, 1]"},
+		{"sortBy([[2, 1], [1, 2], [2, 3]], fn(a, b) { a[0] < b[0] })", "[[1, 2], [2, 1], [2, 3]]"},
+		{"len(map(range(3000), fn(x) { x }))", "3000"},
+	}
+
+	runPreludeTests(t, tests)
+}
+
+func TestStringUtilities(t *testing.T) {
+	tests := []preludeTestCase{
+		{`join(["a", "b", "c"], ", ")`, "a, b, c"},
+		{`join(map(range(3), fn(x) { x * x }), "-")`, "0-1-4"},
+		{`split("a,b,c", ",")`, "[a, b, c]"},
+		{`join(split("a b c", " "), "+")`, "a+b+c"},
+		{`repeat("ab", 3)`, "ababab"},
+		{`join(sort(["b", "c", "a"]), "")`, "abc"},
+	}
+
+	runPreludeTests(t, tests)
+}
+
+func TestHashUtilities(t *testing.T) {
+	tests := []preludeTestCase{
+		{`sort(keys({"b": 1, "a": 2}))`, "[a, b]"},
+		{`sort(values({"b": 1, "a": 2}))`, "[1, 2]"},
+		{`merge({"a": 1}, {"b": 2})["b"]`, "2"},
+		{`merge({"a": 1}, {"a": 2})["a"]`, "2"},
+		{`mapValues({"a": 1}, fn(v) { v + 1 })["a"]`, "2"},
+		{`len(keys(filterValues({"a": 1, "b": 2}, fn(v) { v > 1 })))`, "1"},
+		{`fromPairs([["a", 1], ["b", 2]])["b"]`, "2"},
+		{`len(keys(fromPairs(map(range(20000), fn(i) { [i, i] }))))`, "20000"},
+		{`len(keys(mapValues(fromPairs(map(range(20000), fn(i) { [i, i] })), fn(v) { v + 1 })))`, "20000"},
+	}
+
+	runPreludeTests(t, tests)
+}
+
+// TestShortCircuit は find、any、all が結果の決まった要素より後の要素に f を呼ばないことを確かめる。
+// 後の要素に f を呼ぶと実行時エラーになる
+func TestShortCircuit(t *testing.T) {
+	tests := []preludeTestCase{
+		{"find([1, 2, 3, 4], fn(x) { if (x > 1) { x + true } else { x == 1 } })", "1"},
+		{"find(range(100), fn(x) { if (x > 37) { x + true } else { x == 37 } })", "37"},
+		{"any([1, 2, 3, 4], fn(x) { if (x > 2) { x + true } else { x == 2 } })", "true"},
+		{"all([1, 2, 3, 4], fn(x) { if (x > 2) { x + true } else { x < 2 } })", "false"},
+	}
+
+	runPreludeTests(t, tests)
+}
+
+// TestEquality は == と != が2つのエンジンで同じ結果になることを確かめる
+func TestEquality(t *testing.T) {
+	tests := []preludeTestCase{
+		{`1 == 1`, "true"},
+		{`1 == "1"`, "false"},
+		{`"a" + "b" == "ab"`, "true"},
+		{`join(["a", "b"], "") == "ab"`, "true"},
+		{`true == true`, "true"},
+		{`true != false`, "true"},
+		{`puts() == puts()`, "true"},
+		{`[1, [2, "x"]] == [1, [2, "x"]]`, "true"},
+		{`[1, 2] == [2, 1]`, "false"},
+		{`[1, 2] != [1, 2, 3]`, "true"},
+		{`map([1, 2], fn(x) { x * 2 }) == [2, 4]`, "true"},
+		{`[] == {}`, "false"},
+		{`{"a": 1, "b": [2]} == {"b": [2], "a": 1}`, "true"},
+		{`{"a": 1} == {"a": 2}`, "false"},
+		{`set({}, "a", {"b": 1}) == {"a": {"b": 1}}`, "true"},
+		{`{[1]: "x"} == {[1]: "x"}`, "true"},
+		{`let f = fn() { 1 }; f == f`, "true"},
+		{`fn() { 1 } == fn() { 1 }`, "false"},
+		{`len == len`, "true"},
+		{`len == puts`, "false"},
+		{`[len] == [len]`, "true"},
+		{`contains([[1], [2]], [2])`, "true"},
+		{`indexOf([{"a": 1}, {"b": 2}], {"b": 2})`, "1"},
+	}
+
+	runPreludeTests(t, tests)
+}
+
+func runPreludeTests(t *testing.T, tests []preludeTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		if got := runEvaluator(t, tt.input); got != tt.expected {
+			t.Errorf("evaluator: wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+		if got := runVM(t, tt.input); got != tt.expected {
+			t.Errorf("vm: wrong result for %q. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func runEvaluator(t *testing.T, input string) string {
+	t.Helper()
+	env := object.NewEnvironment()
+	if err := LoadEnvironment(env); err != nil {
+		t.Fatalf("LoadEnvironment failed: %s", err)
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	return evaluator.Eval(program, env).Inspect()
+}
+
+func runVM(t *testing.T, input string) string {
+	t.Helper()
+	symbolTable := compiler.NewSymbolTable()
+	for i, v := range object.Builtins {
+		symbolTable.DefineBuiltin(i, v.Name)
+	}
+	globals := make([]object.Object, vm.GlobalSize)
+
+	constants, err := LoadCompiled(symbolTable, []object.Object{}, globals)
+	if err != nil {
+		t.Fatalf("LoadCompiled failed: %s", err)
+	}
+
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	comp := compiler.NewWithState(symbolTable, constants)
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.NewWithGlobalStore(comp.Bytecode(), globals)
+	if err := machine.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	return machine.LastPoppedStackElem().Inspect()
+}
@@ -0,0 +1,92 @@
+package tester
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// JUnit の XML の要素。CI で一般的に読まれる属性だけを書き出す
+type junitSuites struct {
+	XMLName  xml.Name     `xml:"testsuites"`
+	Tests    int          `xml:"tests,attr"`
+	Failures int          `xml:"failures,attr"`
+	Time     string       `xml:"time,attr"`
+	Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     string      `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit は results を JUnit の XML の形式で書き出す。
+// ファイルを testsuite に、テスト関数を testcase にする。テスト関数のないファイルはファイル名の testcase を1つ持つ
+func WriteJUnit(w io.Writer, results []*FileResult) error {
+	suites := junitSuites{}
+	var total time.Duration
+	for _, r := range results {
+		suite := junitSuite{Name: r.File, Failures: r.Failed(), Time: seconds(r.Duration)}
+		if len(r.Tests) == 0 {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      r.File,
+				Classname: r.File,
+				Time:      seconds(r.Duration),
+				Failure:   junitFailureOf(r.File, r.Failure),
+			})
+		}
+		for _, t := range r.Tests {
+			suite.Cases = append(suite.Cases, junitCase{
+				Name:      t.Name,
+				Classname: r.File,
+				Time:      seconds(t.Duration),
+				Failure:   junitFailureOf(r.File, t.Failure),
+			})
+		}
+		suite.Tests = len(suite.Cases)
+
+		suites.Suites = append(suites.Suites, suite)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		total += r.Duration
+	}
+	suites.Time = seconds(total)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+func junitFailureOf(file string, f *Failure) *junitFailure {
+	if f == nil {
+		return nil
+	}
+	return &junitFailure{Message: f.Message, Text: f.Format(file)}
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
@@ -0,0 +1,272 @@
+// Package tester は Monkey で書いたテストを実行する。
+//
+// テストファイルの最上位で let に束縛した、名前が test で始まる関数がテスト関数になる。
+// テスト関数ごとに新しい環境でファイル全体を実行し直してから関数を呼び出すので、
+// テストは互いに影響しない。テストは assert、assertEqual、assertError の失敗か実行時エラーで失敗し、
+// 失敗した位置をファイルの行と列で報告する。
+// テスト関数のないファイルは、ファイル全体を一度だけ実行する。
+package tester
+
+import (
+	"errors"
+	"fmt"
+	"monkey/ast"
+	"monkey/cover"
+	"monkey/debugger"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/stdlib"
+	"monkey/vm"
+	"strings"
+	"time"
+)
+
+// Options はテストの実行方法
+type Options struct {
+	VM    bool // VM で実行する。false なら評価器で実行する
+	Cover bool // カバレッジを記録する
+}
+
+// Failure はテストの失敗
+type Failure struct {
+	Message string
+	Line    int // 失敗した位置がわからない場合は 0
+	Column  int
+}
+
+// Format は file:line:column: message の形式で失敗を文字列にする
+func (f *Failure) Format(file string) string {
+	if f.Line == 0 {
+		return file + ": " + f.Message
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", file, f.Line, f.Column, f.Message)
+}
+
+// Result は1つのテスト関数の結果
+type Result struct {
+	Name     string
+	Duration time.Duration
+	Failure  *Failure // 成功した場合は nil
+}
+
+// FileResult は1つのテストファイルの結果
+type FileResult struct {
+	File     string
+	Tests    []Result
+	Failure  *Failure // 構文エラーや、テスト関数のないファイルの実行時エラー
+	Profile  *cover.Profile
+	Duration time.Duration
+}
+
+// Passed は成功したテストの数を返す
+func (r *FileResult) Passed() int {
+	n := 0
+	for _, t := range r.Tests {
+		if t.Failure == nil {
+			n++
+		}
+	}
+	return n
+}
+
+// Failed は失敗したテストの数を返す。ファイルを実行できなかった場合は 1 とする
+func (r *FileResult) Failed() int {
+	if r.Failure != nil {
+		return 1
+	}
+	return len(r.Tests) - r.Passed()
+}
+
+// TestFunctions は program の最上位で定義したテスト関数の名前を定義した順に返す
+func TestFunctions(program *ast.Program) []string {
+	names := []string{}
+	for _, stmt := range program.Statements {
+		let, ok := stmt.(*ast.LetStatement)
+		if !ok || !strings.HasPrefix(let.Name.Value, "test") {
+			continue
+		}
+		if _, ok := let.Value.(*ast.FunctionLiteral); ok {
+			names = append(names, let.Name.Value)
+		}
+	}
+	return names
+}
+
+// RunFile は file の内容 src のテストを実行する
+func RunFile(file, src string, opts Options) *FileResult {
+	start := time.Now()
+	result := &FileResult{File: file}
+	defer func() { result.Duration = time.Since(start) }()
+
+	p := parser.New(lexer.New(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		result.Failure = &Failure{Message: "parser errors:\n\t" + strings.Join(p.Errors(), "\n\t")}
+		return result
+	}
+	if opts.Cover {
+		result.Profile = cover.New(file, program)
+	}
+
+	r := &runner{src: src, program: program, profile: result.Profile, nodes: map[ast.Node]bool{}}
+	for _, stmt := range program.Statements {
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			r.nodes[node] = true
+			return true
+		})
+	}
+	run := r.evaluate
+	if opts.VM {
+		run = r.execute
+	}
+
+	names := TestFunctions(program)
+	if len(names) == 0 {
+		result.Failure = run("")
+		return result
+	}
+	for _, name := range names {
+		testStart := time.Now()
+		failure := run(name)
+		result.Tests = append(result.Tests, Result{Name: name, Duration: time.Since(testStart), Failure: failure})
+	}
+	return result
+}
+
+type runner struct {
+	src     string
+	program *ast.Program
+	profile *cover.Profile
+	nodes   map[ast.Node]bool // ファイルの構文木の節。prelude の節と区別する
+}
+
+// evaluate はファイル全体を評価器で評価してから、テスト関数 name を呼び出す。name が空なら呼び出さない
+func (r *runner) evaluate(name string) *Failure {
+	env := object.NewEnvironment()
+	if err := stdlib.LoadEnvironment(env); err != nil {
+		return &Failure{Message: err.Error()}
+	}
+
+	locator := &errorLocator{nodes: r.nodes}
+	t := object.Tracers{locator}
+	if r.profile != nil {
+		t = append(t, r.profile.Evaluator())
+	}
+	env.SetTracer(t)
+
+	result := evaluator.Eval(r.program, env)
+	if _, ok := result.(*object.Error); !ok && name != "" {
+		result = evaluator.Eval(callProgram(name), env)
+	}
+	err, ok := result.(*object.Error)
+	if !ok {
+		return nil
+	}
+	return &Failure{Message: err.Message, Line: locator.pos.Line, Column: locator.pos.Column}
+}
+
+// callProgram は関数 name を引数なしで呼び出すプログラムを返す
+func callProgram(name string) *ast.Program {
+	return parser.New(lexer.New(name + "();")).ParseProgram()
+}
+
+// errorLocator はエラーを最初に返したファイルの文の位置を記録する。
+// VM のソースマップと同じく、エラーが発生した式ではなく式を含む最も内側の文の位置になる
+type errorLocator struct {
+	nodes map[ast.Node]bool
+	err   *object.Error
+	pos   cover.Position
+}
+
+func (l *errorLocator) Enter(node ast.Node) {}
+
+func (l *errorLocator) Exit(node ast.Node, result object.Object) {
+	switch node.(type) {
+	case *ast.LetStatement, *ast.ReturnStatement, *ast.ExpressionStatement:
+	default:
+		return
+	}
+	err, ok := result.(*object.Error)
+	if !ok || err == l.err || !l.nodes[node] {
+		return
+	}
+	l.err = err
+	tok := ast.TokenOf(node)
+	l.pos = cover.Position{Line: tok.Line, Column: tok.Column}
+}
+
+func (l *errorLocator) Call(fn *object.Function)   {}
+func (l *errorLocator) Return(fn *object.Function) {}
+
+// errAssertion はアサーションが失敗したときに VM を止めるエラー
+var errAssertion = errors.New("assertion failed")
+
+// execute はファイル全体とテスト関数 name の呼び出しをコンパイルし、VM で実行する。name が空なら呼び出さない
+func (r *runner) execute(name string) *Failure {
+	src := r.src
+	if name != "" {
+		src += "\n" + name + "();"
+	}
+	program, err := debugger.Compile(src)
+	if err != nil {
+		return &Failure{Message: err.Error()}
+	}
+
+	h := &vmHook{program: program}
+	hooks := vm.Hooks{h}
+	if r.profile != nil {
+		hooks = append(hooks, r.profile.VM(program))
+	}
+
+	err = program.Run(hooks)
+	switch {
+	case h.failure != nil:
+		return h.failure
+	case err != nil:
+		if cause := errors.Unwrap(err); cause != nil {
+			err = cause
+		}
+		return h.fail(err.Error())
+	}
+	return nil
+}
+
+// vmHook は VM を記録し、アサーションが失敗したら VM を止める。
+// VM では組み込み関数が返したエラーも値としてスタックに積まれるだけなので、
+// 次の命令の前にスタックの先頭がアサーションのエラーになっていれば失敗とする
+type vmHook struct {
+	program *debugger.Program
+	machine *vm.VM
+	failure *Failure
+}
+
+func (h *vmHook) Before(machine *vm.VM) error {
+	h.machine = machine
+	if err, ok := machine.StackTop().(*object.Error); ok && err.Assertion {
+		h.failure = h.fail(err.Message)
+		return errAssertion
+	}
+	return nil
+}
+
+// fail は VM が実行しているファイルの文の位置で Failure を返す
+func (h *vmHook) fail(message string) *Failure {
+	failure := &Failure{Message: message}
+	if h.machine == nil {
+		return failure
+	}
+	frames := h.machine.Frames()
+	for i := len(frames) - 1; i >= 0; i-- {
+		fn := frames[i].Closure().Fn
+		if h.program.IsLibrary(fn) {
+			continue
+		}
+		if pos, ok := fn.SourceMap.Lookup(frames[i].IP()); ok {
+			failure.Line, failure.Column = pos.Line, pos.Column
+		}
+		break
+	}
+	return failure
+}
@@ -0,0 +1,172 @@
+package tester
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+const source = `let add = fn(a, b) { a + b };
+
+let testAdd = fn() {
+  assertEqual(add(1, 2), 3);
+};
+
+let testAddFails = fn() {
+  let x = add(1, 1);
+  assertEqual(x, 3, "one plus one");
+};
+
+let testAssert = fn() {
+  assert(add(1, 1) == 2);
+  assert(false, "always fails");
+};
+
+let testError = fn() {
+  assertError(fn() { add(1, true) });
+  let f = fn() { add(1, "a") };
+  f();
+};
+
+let testIsolated = fn() {
+  let add = fn(a, b) { 0 };
+  assertEqual(add(1, 2), 0);
+};
+
+let helper = fn() { assert(false) };`
+
+func TestTestFunctions(t *testing.T) {
+	result := RunFile("math_test.mk", source, Options{})
+	names := []string{}
+	for _, r := range result.Tests {
+		names = append(names, r.Name)
+	}
+
+	expected := "testAdd testAddFails testAssert testError testIsolated"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("wrong test functions. want=%q, got=%q", expected, strings.Join(names, " "))
+	}
+}
+
+func TestRunFile(t *testing.T) {
+	expected := map[string]string{
+		"testAdd":      "",
+		"testAddFails": "math_test.mk:9:3: got 2, want 3: one plus one",
+		"testAssert":   "math_test.mk:14:3: assertion failed: always fails",
+		"testIsolated": "",
+	}
+
+	for _, opts := range []Options{{}, {VM: true}} {
+		result := RunFile("math_test.mk", source, opts)
+		if result.Failure != nil {
+			t.Fatalf("VM=%t: file failed: %s", opts.VM, result.Failure.Format(result.File))
+		}
+
+		for _, r := range result.Tests {
+			want, ok := expected[r.Name]
+			if !ok {
+				continue
+			}
+			got := ""
+			if r.Failure != nil {
+				got = r.Failure.Format(result.File)
+			}
+			if got != want {
+				t.Errorf("VM=%t: %s wrong result. want=%q, got=%q", opts.VM, r.Name, want, got)
+			}
+		}
+
+		// 実行時エラーのメッセージは評価器と VM で異なるので、位置だけを確かめる。
+		// 位置はエラーが発生した add の本体になる
+		failure := result.Tests[3].Failure
+		if failure == nil || failure.Line != 1 || failure.Column != 22 {
+			t.Errorf("VM=%t: testError should fail at 1:22. got=%+v", opts.VM, failure)
+		}
+
+		if result.Passed() != 2 || result.Failed() != 3 {
+			t.Errorf("VM=%t: wrong counts. want 2 passed and 3 failed, got %d and %d", opts.VM, result.Passed(), result.Failed())
+		}
+	}
+}
+
+// 同時に実行したテストが、互いのアサーションの失敗を報告しないことを確かめる
+func TestRunFileConcurrently(t *testing.T) {
+	passing := "let testPass = fn() { assert(true); assertEqual(1, 1) };"
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		src, failed := source, 3
+		if i%2 == 0 {
+			src, failed = passing, 0
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := RunFile("concurrent_test.mk", src, Options{VM: true})
+			if result.Failed() != failed {
+				t.Errorf("wrong number of failures. want=%d, got=%d", failed, result.Failed())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestRunFileWithoutTests(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{"let x = 1; assert(x == 1);", ""},
+		{"let x = 1;\nassertEqual(x, 2);", "a_test.mk:2:1: got 1, want 2"},
+		{"let x = ;", "a_test.mk: parser errors:\n\t1:9: no prefix parse function for ; found"},
+	}
+
+	for _, opts := range []Options{{}, {VM: true}} {
+		for _, tt := range tests {
+			result := RunFile("a_test.mk", tt.src, opts)
+			got := ""
+			if result.Failure != nil {
+				got = result.Failure.Format(result.File)
+			}
+			if !strings.HasPrefix(got, tt.expected) || (tt.expected == "" && got != "") {
+				t.Errorf("VM=%t: wrong result for %q. want=%q, got=%q", opts.VM, tt.src, tt.expected, got)
+			}
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	for _, opts := range []Options{{Cover: true}, {VM: true, Cover: true}} {
+		result := RunFile("math_test.mk", source, opts)
+		covered, total := result.Profile.Statements()
+		// helper の本体の assert だけを実行しない
+		if covered != total-1 {
+			t.Errorf("VM=%t: wrong coverage. want=%d/%d, got=%d/%d", opts.VM, total-1, total, covered, total)
+		}
+	}
+}
+
+func TestWriteJUnit(t *testing.T) {
+	results := []*FileResult{
+		RunFile("math_test.mk", source, Options{}),
+		RunFile("a_test.mk", "assert(true);", Options{}),
+	}
+
+	var out strings.Builder
+	if err := WriteJUnit(&out, results); err != nil {
+		t.Fatalf("WriteJUnit failed: %s", err)
+	}
+
+	for _, want := range []string{
+		`<?xml version="1.0" encoding="UTF-8"?>`,
+		`<testsuites tests="6" failures="3"`,
+		`<testsuite name="math_test.mk" tests="5" failures="3"`,
+		`<testcase name="testAdd" classname="math_test.mk"`,
+		`<failure message="assertion failed: always fails">math_test.mk:14:3: assertion failed: always fails</failure>`,
+		`<testsuite name="a_test.mk" tests="1" failures="0"`,
+		`<testcase name="a_test.mk" classname="a_test.mk"`,
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("JUnit XML does not contain %q:\n%s", want, out.String())
+		}
+	}
+}
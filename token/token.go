@@ -5,16 +5,21 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // トークンの先頭の行番号(1始まり)
+	Column  int // トークンの先頭の列番号(1始まり、ルーン単位)
 }
 
 const (
 	ILLEGAL = "ILLEGAL" // 未知のトークン
 	EOF     = "EOF"     // ファイル終端
+	COMMENT = "COMMENT" // コメント。lexer.NewWithComments を使った場合のみ現れる
 
 	// 識別子 + リテラル
-	IDENT  = "IDENT" // add, foobar, x, y, ...
-	INT    = "INT"   // 1343456
-	STRING = "STRING"
+	IDENT      = "IDENT" // add, foobar, x, y, ...
+	INT        = "INT"   // 1343456
+	STRING     = "STRING"
+	RAW_STRING = "RAW_STRING" // `...`
+	TEMPLATE   = "TEMPLATE"   // "...${x}..." 補間を含む文字列。Literal は引用符の間のソースコード
 
 	// 演算子
 	ASSIGN   = "="
@@ -30,6 +35,8 @@ const (
 	EQ     = "=="
 	NOT_EQ = "!="
 
+	ARROW = "->" // 関数の戻り値の型注釈 fn(x: int) -> int
+
 	// デリミタ
 	COMMA     = ","
 	SEMICOLON = ";"
@@ -42,6 +49,8 @@ const (
 	LBRAKET = "["
 	RBRAKET = "]"
 
+	INTERPOLATION = "${" // 文字列補間の式部分。字句解析器は返さず、構文解析器が ast.Interpolation に使う
+
 	// キーワード
 	FUNCTION = "FUNCTION"
 	LET      = "LET"
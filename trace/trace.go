@@ -0,0 +1,166 @@
+// Package trace は VM と評価器の実行を1行に1つの JSON として書き出す。
+//
+// VM は vm.Hook として接続し、命令を実行する前に、フレームの深さ、命令の位置、逆アセンブルした命令と
+// スタックを書き出す。Evaluator は object.Tracer として環境に設定し、節を評価する前と後に、
+// 節の種類と位置、評価した結果を書き出す。
+// どちらも関数名で絞り込めるので、同じプログラムを VM と評価器で実行した結果を比べられる。
+package trace
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"monkey/ast"
+	"monkey/debugger"
+	"monkey/object"
+	"monkey/vm"
+	"strings"
+)
+
+// Instruction は VM が実行した1つの命令の記録
+type Instruction struct {
+	Engine   string   `json:"engine"` // 常に "vm"
+	Depth    int      `json:"depth"`  // フレームの数。プログラム本体は 1
+	Function string   `json:"function"`
+	Line     int      `json:"line,omitempty"`
+	IP       int      `json:"ip"`
+	Op       string   `json:"op"`    // 逆アセンブルした命令。例: "OpConstant 1"
+	Stack    []string `json:"stack"` // 現在のフレームが積んだ値。スタックの一番上が最後
+}
+
+// Node は評価器が評価した1つの節の記録
+type Node struct {
+	Engine   string `json:"engine"` // 常に "eval"
+	Event    string `json:"event"`  // 評価する前は "enter"、した後は "exit"
+	Depth    int    `json:"depth"`  // 呼び出し中の関数の数に 1 を足したもの。プログラム本体は 1
+	Function string `json:"function"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Node     string `json:"node"` // 節の種類。例: "InfixExpression"
+	Source   string `json:"source"`
+	Result   string `json:"result,omitempty"` // exit の場合の評価した結果
+}
+
+// VM は VM の命令を書き出す vm.Hook
+type VM struct {
+	enc      *json.Encoder
+	function string
+}
+
+// NewVM は w に書き出す VM を返す。function が空でなければ、その名前の関数で実行した命令だけを書き出す
+func NewVM(w io.Writer, function string) *VM {
+	return &VM{enc: newEncoder(w), function: function}
+}
+
+func (t *VM) Before(machine *vm.VM) error {
+	frames := machine.Frames()
+	frame := frames[len(frames)-1]
+	name := debugger.FrameName(frames, len(frames)-1)
+	if t.function != "" && name != t.function {
+		return nil
+	}
+
+	line, _ := debugger.FrameLine(frame)
+	stack := []string{}
+	for _, v := range machine.Operands(frame) {
+		stack = append(stack, Inspect(v))
+	}
+
+	return t.enc.Encode(Instruction{
+		Engine:   "vm",
+		Depth:    len(frames),
+		Function: name,
+		Line:     line,
+		IP:       frame.IP(),
+		Op:       frame.Instructions().Disassemble(frame.IP()),
+		Stack:    stack,
+	})
+}
+
+// Evaluator は評価器が評価した節を書き出す object.Tracer
+type Evaluator struct {
+	enc      *json.Encoder
+	function string
+	calls    []string // 呼び出し中の関数の名前
+	err      error
+}
+
+// NewEvaluator は w に書き出す Evaluator を返す。
+// function が空でなければ、その名前の関数の中で評価した節だけを書き出す
+func NewEvaluator(w io.Writer, function string) *Evaluator {
+	return &Evaluator{enc: newEncoder(w), function: function}
+}
+
+// Err は書き出しで最初に発生したエラーを返す
+func (t *Evaluator) Err() error {
+	return t.err
+}
+
+func (t *Evaluator) Enter(node ast.Node) {
+	t.write("enter", node, nil)
+}
+
+func (t *Evaluator) Exit(node ast.Node, result object.Object) {
+	t.write("exit", node, result)
+}
+
+func (t *Evaluator) Call(fn *object.Function) {
+	name := fn.Name
+	if name == "" {
+		name = "fn"
+	}
+	t.calls = append(t.calls, name)
+}
+
+func (t *Evaluator) Return(fn *object.Function) {
+	t.calls = t.calls[:len(t.calls)-1]
+}
+
+func (t *Evaluator) write(event string, node ast.Node, result object.Object) {
+	name := "main"
+	if len(t.calls) > 0 {
+		name = t.calls[len(t.calls)-1]
+	}
+	if t.err != nil || (t.function != "" && name != t.function) {
+		return
+	}
+
+	record := Node{
+		Engine:   "eval",
+		Event:    event,
+		Depth:    len(t.calls) + 1,
+		Function: name,
+		Node:     strings.TrimPrefix(fmt.Sprintf("%T", node), "*ast."),
+		Source:   node.String(),
+	}
+	if tok := ast.TokenOf(node); tok.Line > 0 {
+		record.Line, record.Column = tok.Line, tok.Column
+	}
+	if result != nil {
+		record.Result = Inspect(result)
+	}
+	t.err = t.enc.Encode(record)
+}
+
+// newEncoder はソースコードの < や > をそのまま書き出す Encoder を返す
+func newEncoder(w io.Writer) *json.Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc
+}
+
+// Inspect は値を記録する形式で文字列にする。
+// VM と評価器の記録を比べられるように、関数はどちらも "<fn name/N>" の形式にする
+func Inspect(obj object.Object) string {
+	switch obj := obj.(type) {
+	case *object.Function:
+		if obj.Name != "" {
+			return fmt.Sprintf("<fn %s/%d>", obj.Name, len(obj.Parameters))
+		}
+		return fmt.Sprintf("<fn/%d>", len(obj.Parameters))
+	case *object.ReturnValue:
+		return Inspect(obj.Value)
+	default:
+		return debugger.Inspect(obj)
+	}
+}
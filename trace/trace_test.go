@@ -0,0 +1,146 @@
+package trace
+
+import (
+	"encoding/json"
+	"monkey/ast"
+	"monkey/debugger"
+	"monkey/evaluator"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const source = `let add = fn(a, b) { a + b };
+add(1, 2);`
+
+func TestVM(t *testing.T) {
+	program, err := debugger.Compile(source)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	var out strings.Builder
+	if err := program.Run(NewVM(&out, "add")); err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+
+	expected := []Instruction{
+		{"vm", 2, "add", 1, 0, "OpGetLocal 0", []string{}},
+		{"vm", 2, "add", 1, 2, "OpGetLocal 1", []string{"1"}},
+		{"vm", 2, "add", 1, 4, "OpAdd", []string{"1", "2"}},
+		{"vm", 2, "add", 1, 5, "OpReturnValue", []string{"3"}},
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of records. want=%d, got=%d\n%s", len(expected), len(lines), out.String())
+	}
+	for i, line := range lines {
+		var got Instruction
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("record %d is not JSON: %s", i, err)
+		}
+		if !equalInstruction(got, expected[i]) {
+			t.Errorf("record %d wrong.\nwant=%+v\ngot=%+v", i, expected[i], got)
+		}
+	}
+}
+
+func equalInstruction(a, b Instruction) bool {
+	return a.Engine == b.Engine && a.Depth == b.Depth && a.Function == b.Function && a.Line == b.Line &&
+		a.IP == b.IP && a.Op == b.Op && strings.Join(a.Stack, ",") == strings.Join(b.Stack, ",")
+}
+
+func TestVMAllFunctions(t *testing.T) {
+	program, err := debugger.Compile(source)
+	if err != nil {
+		t.Fatalf("compile error: %s", err)
+	}
+
+	var out strings.Builder
+	if err := program.Run(NewVM(&out, "")); err != nil {
+		t.Fatalf("runtime error: %s", err)
+	}
+
+	functions := map[string]int{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var got Instruction
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("record is not JSON: %s", err)
+		}
+		functions[got.Function]++
+	}
+	if functions["add"] != 4 || functions["main"] == 0 {
+		t.Errorf("wrong records per function. got=%v", functions)
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	p := parser.New(lexer.New(source))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+
+	var out strings.Builder
+	tracer := NewEvaluator(&out, "add")
+	env := object.NewEnvironment()
+	env.SetTracer(tracer)
+	evaluator.Eval(program, env)
+	if err := tracer.Err(); err != nil {
+		t.Fatalf("write error: %s", err)
+	}
+
+	expected := []string{
+		"enter BlockStatement 1:20 ",
+		"enter ExpressionStatement 1:22 ",
+		"enter InfixExpression 1:24 ",
+		"enter Identifier 1:22 ",
+		"exit Identifier 1:22 1",
+		"enter Identifier 1:26 ",
+		"exit Identifier 1:26 2",
+		"exit InfixExpression 1:24 3",
+		"exit ExpressionStatement 1:22 3",
+		"exit BlockStatement 1:20 3",
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Fatalf("wrong number of records. want=%d, got=%d\n%s", len(expected), len(lines), out.String())
+	}
+	for i, line := range lines {
+		var got Node
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			t.Fatalf("record %d is not JSON: %s", i, err)
+		}
+		if got.Engine != "eval" || got.Depth != 2 || got.Function != "add" {
+			t.Errorf("record %d has wrong engine, depth or function: %+v", i, got)
+		}
+		summary := got.Event + " " + got.Node + " " + strconv.Itoa(got.Line) + ":" + strconv.Itoa(got.Column) + " " + got.Result
+		if summary != expected[i] {
+			t.Errorf("record %d wrong. want=%q, got=%q", i, expected[i], summary)
+		}
+	}
+}
+
+func TestInspect(t *testing.T) {
+	tests := []struct {
+		obj      object.Object
+		expected string
+	}{
+		{&object.Function{Name: "add", Parameters: make([]*ast.Identifier, 2)}, "<fn add/2>"},
+		{&object.Function{Parameters: make([]*ast.Identifier, 1)}, "<fn/1>"},
+		{&object.Closure{Fn: &object.CompiledFunction{Name: "add", NumParameters: 2}}, "<fn add/2>"},
+		{&object.ReturnValue{Value: &object.Integer{Value: 1}}, "1"},
+		{&object.String{Value: "a"}, `"a"`},
+	}
+
+	for _, tt := range tests {
+		if got := Inspect(tt.obj); got != tt.expected {
+			t.Errorf("Inspect wrong. want=%q, got=%q", tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package types
+
+// 組み込み関数の戻り値の型。引数は可変長のものがあるので検査しない
+var builtinReturns = map[string]Type{
+	"len":         Int,
+	"puts":        Null,
+	"range":       &Array{Element: Int},
+	"join":        String,
+	"split":       &Array{Element: String},
+	"trim":        String,
+	"upper":       String,
+	"lower":       String,
+	"contains":    Bool,
+	"replace":     String,
+	"startsWith":  Bool,
+	"indexOf":     Int,
+	"format":      String,
+	"chars":       &Array{Element: String},
+	"str":         String,
+	"assert":      Null,
+	"assertEqual": Null,
+	"assertError": Null,
+	"has":         Bool,
+}
+
+func builtinType(name string) *Function {
+	ret, ok := builtinReturns[name]
+	if !ok {
+		ret = Any
+	}
+	return &Function{Return: ret}
+}
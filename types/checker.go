@@ -0,0 +1,254 @@
+package types
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/object"
+	"monkey/stdlib"
+)
+
+// Error は位置情報付きの型エラー
+type Error struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+// Checker は型を検査する。グローバルスコープは Check の呼び出しをまたいで保持されるため、
+// REPL のように1行ずつ検査することもできる
+type Checker struct {
+	scope    *scope
+	function *function // 検査中の関数。トップレベルでは nil
+	errors   []*Error
+}
+
+type scope struct {
+	outer *scope
+	types map[string]Type
+}
+
+func (s *scope) lookup(name string) (Type, bool) {
+	for ; s != nil; s = s.outer {
+		if t, ok := s.types[name]; ok {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// function は検査中の関数リテラルの情報
+type function struct {
+	declared Type   // 戻り値の型注釈。省略した場合は nil
+	returns  []Type // return 文で返す値の型
+}
+
+// New は組み込み関数と prelude の関数を定義した Checker を返す
+func New() *Checker {
+	c := &Checker{scope: &scope{types: make(map[string]Type)}}
+
+	for _, v := range object.Builtins {
+		c.scope.types[v.Name] = builtinType(v.Name)
+	}
+
+	// prelude の関数には型注釈がないので、引数は any になり、戻り値は本体から推論される
+	if prelude, err := stdlib.Program(); err == nil {
+		c.Check(prelude)
+	}
+	return c
+}
+
+// Check はプログラムを検査し、見つかった型エラーを返す
+func (c *Checker) Check(program *ast.Program) []*Error {
+	c.errors = nil
+	for _, stmt := range program.Statements {
+		c.statement(stmt)
+	}
+	return c.errors
+}
+
+// Declare はグローバル変数 name の型を t にする。
+// Go のプログラムが VM のグローバル変数に直接値を入れるときに、型検査をそれに合わせるのに使う
+func (c *Checker) Declare(name string, t Type) {
+	s := c.scope
+	for s.outer != nil {
+		s = s.outer
+	}
+	s.types[name] = t
+}
+
+// Clone はグローバルスコープを複製した Checker を返す。
+// REPL で失敗した入力が定義した名前を取り消すために、入力の前の状態を取っておくのに使う
+func (c *Checker) Clone() *Checker {
+	types := make(map[string]Type, len(c.scope.types))
+	for name, t := range c.scope.types {
+		types[name] = t
+	}
+	return &Checker{scope: &scope{types: types}}
+}
+
+// TypeOf はグローバルスコープで式の型を推論する。式の中のエラーもあわせて返す。
+// let 文と違って名前を定義しないので、REPL で式の型を調べるのに使える
+func (c *Checker) TypeOf(exp ast.Expression) (Type, []*Error) {
+	c.errors = nil
+	t := c.expression(exp)
+	return t, c.errors
+}
+
+// Check は新しい Checker でプログラムを検査する
+func Check(program *ast.Program) []*Error {
+	return New().Check(program)
+}
+
+func (c *Checker) errorf(node ast.Node, format string, a ...interface{}) {
+	tok := ast.TokenOf(node)
+	c.errors = append(c.errors, &Error{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, a...)})
+}
+
+func (c *Checker) define(name string, t Type) {
+	c.scope.types[name] = t
+}
+
+// annotation は型注釈を型に変換する。注釈がない場合は nil を返す
+func (c *Checker) annotation(t ast.Type) Type {
+	if t == nil {
+		return nil
+	}
+	result, err := FromAST(t)
+	if err != nil {
+		c.errorf(t, "%s", err)
+		return Any
+	}
+	return result
+}
+
+func (c *Checker) statement(stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.LetStatement:
+		c.letStatement(stmt)
+	case *ast.ReturnStatement:
+		t := c.expression(stmt.ReturnValue)
+		if c.function == nil {
+			return
+		}
+		c.function.returns = append(c.function.returns, t)
+		if declared := c.function.declared; declared != nil && !Consistent(t, declared) {
+			c.errorf(stmt, "cannot return %s from function returning %s", t, declared)
+		}
+	case *ast.ExpressionStatement:
+		c.expression(stmt.Expression)
+	}
+}
+
+func (c *Checker) letStatement(stmt *ast.LetStatement) {
+	declared := c.annotation(stmt.Name.Type)
+
+	// コンパイラと同様に、右辺を検査する前に名前を定義する(再帰関数のため)
+	switch {
+	case declared != nil:
+		c.define(stmt.Name.Value, declared)
+	case isFunctionLiteral(stmt.Value):
+		c.define(stmt.Name.Value, c.signature(stmt.Value.(*ast.FunctionLiteral)))
+	default:
+		c.define(stmt.Name.Value, Any)
+	}
+
+	t := c.expression(stmt.Value)
+	if declared == nil {
+		c.define(stmt.Name.Value, t)
+		return
+	}
+	if !Consistent(t, declared) {
+		c.errorf(stmt.Name, "cannot use %s as %s in let %s", t, declared, stmt.Name.Value)
+	}
+}
+
+func isFunctionLiteral(exp ast.Expression) bool {
+	_, ok := exp.(*ast.FunctionLiteral)
+	return ok
+}
+
+// signature は関数リテラルの型注釈から関数の型を作る。注釈のない部分は any になる
+func (c *Checker) signature(fn *ast.FunctionLiteral) *Function {
+	t := &Function{Parameters: []Type{}, Return: Any}
+	for _, p := range fn.Parameters {
+		var param Type = Any
+		if p.Type != nil {
+			if pt, err := FromAST(p.Type); err == nil {
+				param = pt
+			}
+		}
+		t.Parameters = append(t.Parameters, param)
+	}
+	if fn.ReturnType != nil {
+		if ret, err := FromAST(fn.ReturnType); err == nil {
+			t.Return = ret
+		}
+	}
+	return t
+}
+
+// block はブロックの値の型を返す。最後の文が式文でない場合は any
+func (c *Checker) block(block *ast.BlockStatement) Type {
+	if block == nil || len(block.Statements) == 0 {
+		return Null
+	}
+
+	last := len(block.Statements) - 1
+	for _, stmt := range block.Statements[:last] {
+		c.statement(stmt)
+	}
+	if stmt, ok := block.Statements[last].(*ast.ExpressionStatement); ok {
+		return c.expression(stmt.Expression)
+	}
+	c.statement(block.Statements[last])
+	return Any
+}
+
+// expression は式を検査して型を返す
+func (c *Checker) expression(exp ast.Expression) Type {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return Int
+	case *ast.StringLiteral:
+		return String
+	case *ast.Boolean:
+		return Bool
+	case *ast.Identifier:
+		if t, ok := c.scope.lookup(exp.Value); ok {
+			return t
+		}
+		return Any // 未定義の変数はコンパイラが報告する
+	case *ast.PrefixExpression:
+		return c.prefixExpression(exp)
+	case *ast.InfixExpression:
+		return c.infixExpression(exp)
+	case *ast.IfExpression:
+		c.expression(exp.Condition)
+		consequence := c.block(exp.Consequence)
+		alternative := Type(Null)
+		if exp.Alternative != nil {
+			alternative = c.block(exp.Alternative)
+		}
+		return Join(consequence, alternative)
+	case *ast.FunctionLiteral:
+		return c.functionLiteral(exp)
+	case *ast.CallExpression:
+		return c.callExpression(exp)
+	case *ast.Interpolation:
+		c.expression(exp.Value)
+		return String
+	case *ast.ArrayLiteral:
+		return c.arrayLiteral(exp)
+	case *ast.HashLiteral:
+		return c.hashLiteral(exp)
+	case *ast.IndexExpression:
+		return c.indexExpression(exp)
+	case *ast.SliceExpression:
+		return c.sliceExpression(exp)
+	}
+	return Any
+}
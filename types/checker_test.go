@@ -0,0 +1,212 @@
+package types
+
+import (
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/object"
+	"monkey/parser"
+	"monkey/stdlib"
+	"strings"
+	"testing"
+)
+
+func TestCheckErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// 注釈のないコードでも、実行時に必ず失敗する演算は報告する
+		{`"a" - 1`, []string{"1:5: type mismatch: string - int"}},
+		{`"a" - "b"`, []string{"1:5: unknown operator: string - string"}},
+		{`-true`, []string{"1:1: unknown operator: -bool"}},
+		{`[1] + [2]`, []string{"1:5: unknown operator: [int] + [int]"}},
+		{`let x = fn(a) { a }; x(2) - 1`, nil},
+		{`1 == "a"; true != [1]`, nil},
+		{`5(1)`, []string{"1:1: not a function: int"}},
+		{`{[1]: 2, {"a": [true]}: 3}`, nil},
+		{`{[puts]: 2}`, []string{"1:2: unusable as hash key: [fn(...) -> null]"}},
+		{`[1, 2]["a"]`, []string{"1:8: cannot index [int] with string"}},
+		{`true[0]`, []string{"1:5: index operator not supported: bool"}},
+		{`"abc"[1:"x"]`, []string{"1:9: slice bound must be int, got string"}},
+		{`let s = "a"; let n = len(s) + 1; n - s`, []string{"1:36: type mismatch: int - string"}},
+		// 型注釈
+		{`let x: int = 5; let y: string = x;`, []string{"1:21: cannot use int as string in let y"}},
+		{`let xs: [int] = [1, "a"];`, nil}, // [1, "a"] は [any]
+		{`let xs: [int] = ["a"];`, []string{"1:5: cannot use [string] as [int] in let xs"}},
+		{`let h: {string: int} = {"a": 1}; h["a"] + "x"`, []string{"1:41: type mismatch: int + string"}},
+		{`let h: {[int]: int} = {[1]: 2}; h[[1]] + 1`, nil},
+		{`let h: {{string: null}: int} = {};`, []string{"1:8: unusable as hash key: {string: null}"}},
+		{`let z: foo = 1;`, []string{"1:8: unknown type foo"}},
+		{`let a: any = 1; let b: string = a;`, nil},
+		{`let n: null = puts(1);`, nil},
+		// 関数
+		{`let add = fn(a: int, b: int) -> int { a + b }; add(1, "2")`, []string{`1:55: cannot use string as int in argument 2`}},
+		{`let add = fn(a: int, b: int) -> int { a + b }; add(1)`, []string{"1:48: wrong number of arguments: want=2, got=1"}},
+		{`let f = fn(a: string) -> int { a }`, []string{"1:9: cannot return string from function returning int"}},
+		{`let f = fn() -> string { return 1; }`, []string{"1:26: cannot return int from function returning string"}},
+		{`let f = fn(x) -> int { if (x) { return 1; } 2 }`, nil},
+		{`let f = fn(a: int) { a }; let s: string = f(1);`, []string{"1:31: cannot use int as string in let s"}},
+		{`let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5) + "!"`, []string{"1:73: type mismatch: int + string"}},
+		{`let apply = fn(f: fn(int) -> int, x: int) -> int { f(x) }; apply(fn(x) { x }, 1)`, nil},
+		{`let apply = fn(f: fn(int) -> int) { f(1) }; apply(fn(x: string) { x })`, []string{"1:51: cannot use fn(string) -> string as fn(int) -> int in argument 1"}},
+		{`let apply = fn(f: fn(int) -> int) { f("a") }`, []string{`1:39: cannot use string as int in argument 1`}},
+		// 組み込み関数と prelude
+		{`len("abc") + "x"`, []string{"1:12: type mismatch: int + string"}},
+		{`let xs: [string] = split("a,b", ","); upper(xs[0]) - 1`, []string{"1:52: type mismatch: string - int"}},
+		{`map([1, 2], fn(x) { x * 2 })`, nil},
+		{`map([1, 2])`, []string{"1:1: wrong number of arguments: want=2, got=1"}},
+		{`let s = "${1 + 2}!"; s - 1`, []string{"1:24: type mismatch: string - int"}},
+		{`let str = 1; let s: string = "${2}"; s`, nil},
+	}
+
+	for _, tt := range tests {
+		errors := Check(parse(t, tt.input))
+
+		actual := []string{}
+		for _, err := range errors {
+			actual = append(actual, err.Error())
+		}
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong errors for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestCheckerKeepsGlobals(t *testing.T) {
+	c := New()
+	if errors := c.Check(parse(t, "let x: int = 1;")); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	errors := c.Check(parse(t, `x + "a"`))
+	if len(errors) != 1 || errors[0].Message != "type mismatch: int + string" {
+		t.Errorf("wrong errors: %v", errors)
+	}
+}
+
+func TestClone(t *testing.T) {
+	c := New()
+	clone := c.Clone()
+	if errors := clone.Check(parse(t, "let x: int = 1;")); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	// 元の Checker では x は未定義なので any になり、エラーにならない
+	if errors := c.Check(parse(t, `x + "a"`)); len(errors) != 0 {
+		t.Errorf("definition in the clone leaked into the original: %v", errors)
+	}
+	if errors := clone.Check(parse(t, `x + "a"`)); len(errors) != 1 {
+		t.Errorf("clone does not keep its definition: %v", errors)
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	c := New()
+	c.Check(parse(t, "let x: int = 1;"))
+	c.Declare("x", String)
+
+	if errors := c.Check(parse(t, `x + "a"`)); len(errors) != 0 {
+		t.Errorf("declared type is not used: %v", errors)
+	}
+}
+
+func TestTypeOf(t *testing.T) {
+	c := New()
+	if errors := c.Check(parse(t, "let add = fn(a: int, b: int) { a + b };")); len(errors) != 0 {
+		t.Fatalf("unexpected errors: %v", errors)
+	}
+
+	tests := []struct {
+		input    string
+		expected string
+		errors   int
+	}{
+		{"add", "fn(int, int) -> int", 0},
+		{"add(1, 2)", "int", 0},
+		{"[add(1, 2)]", "[int]", 0},
+		{`add(1, "a")`, "int", 1},
+		{"len", "fn(...) -> int", 0},
+	}
+
+	for _, tt := range tests {
+		exp := parse(t, tt.input).Statements[0].(*ast.ExpressionStatement).Expression
+		actual, errors := c.TypeOf(exp)
+		if actual.String() != tt.expected || len(errors) != tt.errors {
+			t.Errorf("wrong type for %q. expected=%s with %d errors, got=%s with %v", tt.input, tt.expected, tt.errors, actual, errors)
+		}
+	}
+}
+
+func TestFunctionTypes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn(a: int, b) { a }", "fn(int, any) -> int"},
+		{"fn() { }", "fn() -> null"},
+		{"fn(x) { if (x) { 1 } }", "fn(any) -> any"},
+		{"fn(x) { if (x) { return [1]; }; [2, 3] }", "fn(any) -> [int]"},
+		{`fn(x) { {"a": x} }`, "fn(any) -> {string: any}"},
+		{"fn(f: fn(int)) -> fn(int) -> bool { f }", "fn(fn(int) -> any) -> fn(int) -> bool"},
+	}
+
+	for _, tt := range tests {
+		program := parse(t, tt.input)
+		c := New()
+		fn := program.Statements[0].(*ast.ExpressionStatement).Expression
+		actual := c.expression(fn)
+
+		if actual.String() != tt.expected {
+			t.Errorf("wrong type for %q. expected=%s, got=%s", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestConsistent(t *testing.T) {
+	tests := []struct {
+		a, b     Type
+		expected bool
+	}{
+		{Int, Int, true},
+		{Int, String, false},
+		{Any, String, true},
+		{&Array{Element: Any}, &Array{Element: Int}, true},
+		{&Array{Element: String}, &Array{Element: Int}, false},
+		{&Hash{Key: String, Value: Int}, &Hash{Key: String, Value: Any}, true},
+		{&Function{Parameters: []Type{Int}, Return: Int}, &Function{Parameters: []Type{Any}, Return: Int}, true},
+		{&Function{Parameters: []Type{Int}, Return: Int}, &Function{Parameters: []Type{}, Return: Int}, false},
+		{&Function{Return: Int}, &Function{Parameters: []Type{String}, Return: Int}, true},
+		{&Array{Element: Int}, Int, false},
+	}
+
+	for _, tt := range tests {
+		if actual := Consistent(tt.a, tt.b); actual != tt.expected {
+			t.Errorf("Consistent(%s, %s) wrong. expected=%t, got=%t", tt.a, tt.b, tt.expected, actual)
+		}
+	}
+}
+
+func parse(t *testing.T, input string) *ast.Program {
+	t.Helper()
+	p := parser.New(lexer.New(input))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors())
+	}
+	return program
+}
+
+func TestPreludeIsWellTyped(t *testing.T) {
+	program, err := stdlib.Program()
+	if err != nil {
+		t.Fatalf("stdlib.Program returned error: %s", err)
+	}
+
+	c := &Checker{scope: &scope{types: make(map[string]Type)}}
+	for _, v := range object.Builtins {
+		c.scope.types[v.Name] = builtinType(v.Name)
+	}
+	for _, err := range c.Check(program) {
+		t.Errorf("prelude: %s", err)
+	}
+}
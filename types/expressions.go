@@ -0,0 +1,238 @@
+package types
+
+import "monkey/ast"
+
+func (c *Checker) prefixExpression(exp *ast.PrefixExpression) Type {
+	right := c.expression(exp.Right)
+
+	switch exp.Operator {
+	case "!":
+		return Bool
+	case "-":
+		if right != Any && right != Int {
+			c.errorf(exp, "unknown operator: -%s", right)
+		}
+		return Int
+	}
+	return Any
+}
+
+// infixExpression は二項演算を検査する。
+// 実行時に必ずエラーになる組み合わせ(型が推論できる両辺の型の不一致や、演算子が定義されていない型)だけを報告する
+func (c *Checker) infixExpression(exp *ast.InfixExpression) Type {
+	left := c.expression(exp.Left)
+	right := c.expression(exp.Right)
+	op := exp.Operator
+
+	var allowed []Type // 演算子が定義されている型
+	var result Type
+	switch op {
+	case "==", "!=":
+		return Bool // どの型の組み合わせでも比較できる
+	case "-", "*", "/":
+		allowed, result = []Type{Int}, Int
+	case "+":
+		allowed = []Type{Int, String}
+		result = left
+		if left == Any {
+			result = right
+		}
+	case "<", ">":
+		allowed, result = []Type{Int, String}, Bool
+	default:
+		return Any
+	}
+
+	switch {
+	case left != Any && right != Any && !Identical(left, right):
+		c.errorf(exp, "type mismatch: %s %s %s", left, op, right)
+	case !operand(left, allowed) || !operand(right, allowed):
+		c.errorf(exp, "unknown operator: %s %s %s", left, op, right)
+	}
+	if !operand(result, allowed) {
+		return Any
+	}
+	return result
+}
+
+func operand(t Type, allowed []Type) bool {
+	if t == Any {
+		return true
+	}
+	for _, a := range allowed {
+		if t == a {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Checker) functionLiteral(fn *ast.FunctionLiteral) Type {
+	t := c.signature(fn)
+
+	outer, outerFunction := c.scope, c.function
+	c.scope = &scope{outer: outer, types: make(map[string]Type)}
+	c.function = &function{}
+	defer func() { c.scope, c.function = outer, outerFunction }()
+
+	for i, p := range fn.Parameters {
+		if p.Type != nil {
+			t.Parameters[i] = c.annotation(p.Type)
+		}
+		c.define(p.Value, t.Parameters[i])
+	}
+	if fn.ReturnType != nil {
+		t.Return = c.annotation(fn.ReturnType)
+		c.function.declared = t.Return
+	}
+
+	implicit := c.block(fn.Body)
+	if c.function.declared != nil {
+		if !endsWithReturn(fn.Body) && !Consistent(implicit, c.function.declared) {
+			c.errorf(fn, "cannot return %s from function returning %s", implicit, c.function.declared)
+		}
+		return t
+	}
+
+	// 戻り値の型注釈がなければ、return 文と最後の式の型から推論する
+	var inferred Type
+	for _, r := range c.function.returns {
+		inferred = joinOrFirst(inferred, r)
+	}
+	if !endsWithReturn(fn.Body) {
+		inferred = joinOrFirst(inferred, implicit)
+	}
+	if inferred != nil {
+		t.Return = inferred
+	}
+	return t
+}
+
+func joinOrFirst(a, b Type) Type {
+	if a == nil {
+		return b
+	}
+	return Join(a, b)
+}
+
+func endsWithReturn(block *ast.BlockStatement) bool {
+	if block == nil || len(block.Statements) == 0 {
+		return false
+	}
+	_, ok := block.Statements[len(block.Statements)-1].(*ast.ReturnStatement)
+	return ok
+}
+
+func (c *Checker) callExpression(call *ast.CallExpression) Type {
+	callee := c.expression(call.Function)
+
+	args := make([]Type, len(call.Arguments))
+	for i, arg := range call.Arguments {
+		args[i] = c.expression(arg)
+	}
+
+	switch callee := callee.(type) {
+	case *Function:
+		if callee.Parameters == nil {
+			return callee.Return
+		}
+		if len(args) != len(callee.Parameters) {
+			c.errorf(call.Function, "wrong number of arguments: want=%d, got=%d", len(callee.Parameters), len(args))
+			return callee.Return
+		}
+		for i, arg := range args {
+			if !Consistent(arg, callee.Parameters[i]) {
+				c.errorf(call.Arguments[i], "cannot use %s as %s in argument %d", arg, callee.Parameters[i], i+1)
+			}
+		}
+		return callee.Return
+	case *Basic:
+		if callee == Any {
+			return Any
+		}
+	}
+
+	c.errorf(call.Function, "not a function: %s", callee)
+	return Any
+}
+
+func (c *Checker) arrayLiteral(array *ast.ArrayLiteral) Type {
+	var elem Type
+	for _, e := range array.Elements {
+		elem = joinOrFirst(elem, c.expression(e))
+	}
+	if elem == nil {
+		elem = Any
+	}
+	return &Array{Element: elem}
+}
+
+func (c *Checker) hashLiteral(hash *ast.HashLiteral) Type {
+	var key, value Type
+	for _, k := range hash.Keys {
+		kt := c.expression(k)
+		if !Hashable(kt) {
+			c.errorf(k, "unusable as hash key: %s", kt)
+		}
+		key = joinOrFirst(key, kt)
+		value = joinOrFirst(value, c.expression(hash.Pairs[k]))
+	}
+	if key == nil {
+		key, value = Any, Any
+	}
+	return &Hash{Key: key, Value: value}
+}
+
+func (c *Checker) indexExpression(exp *ast.IndexExpression) Type {
+	left := c.expression(exp.Left)
+	index := c.expression(exp.Index)
+
+	switch left := left.(type) {
+	case *Array:
+		if !operand(index, []Type{Int}) {
+			c.errorf(exp.Index, "cannot index %s with %s", left, index)
+		}
+		return left.Element
+	case *Hash:
+		if !Hashable(index) {
+			c.errorf(exp.Index, "unusable as hash key: %s", index)
+		}
+		return left.Value
+	case *Basic:
+		switch left {
+		case Any:
+			return Any
+		case String:
+			if !operand(index, []Type{Int}) {
+				c.errorf(exp.Index, "cannot index %s with %s", left, index)
+			}
+			return String
+		}
+	}
+
+	c.errorf(exp, "index operator not supported: %s", left)
+	return Any
+}
+
+func (c *Checker) sliceExpression(exp *ast.SliceExpression) Type {
+	left := c.expression(exp.Left)
+	for _, bound := range []ast.Expression{exp.Start, exp.End} {
+		if bound == nil {
+			continue
+		}
+		if t := c.expression(bound); !operand(t, []Type{Int}) {
+			c.errorf(bound, "slice bound must be int, got %s", t)
+		}
+	}
+
+	switch left.(type) {
+	case *Array:
+		return left
+	}
+	if left == Any || left == String {
+		return left
+	}
+
+	c.errorf(exp, "slice operator not supported: %s", left)
+	return Any
+}
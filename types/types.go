@@ -0,0 +1,221 @@
+// Package types は Monkey の段階的(gradual)な型検査を行う。
+//
+// 型注釈は省略可能で、注釈のない引数は any 型として扱われる。
+// リテラルなどから型を推論できる式については、実行時に必ず失敗する演算
+// ("a" - 1 など)や、注釈と矛盾する値の受け渡しをコンパイル前に報告する。
+// any 型はどの型とも互換なので、注釈のないコードは従来どおり動的に型付けされる。
+package types
+
+import (
+	"fmt"
+	"monkey/ast"
+	"strings"
+)
+
+// Type は Monkey の値の型
+type Type interface {
+	String() string
+}
+
+// Basic は int, string, bool, null と、任意の型を表す any
+type Basic struct {
+	Name string
+}
+
+func (b *Basic) String() string { return b.Name }
+
+var (
+	Any    = &Basic{Name: "any"}
+	Int    = &Basic{Name: "int"}
+	String = &Basic{Name: "string"}
+	Bool   = &Basic{Name: "bool"}
+	Null   = &Basic{Name: "null"}
+)
+
+var basics = map[string]*Basic{
+	"any":    Any,
+	"int":    Int,
+	"string": String,
+	"bool":   Bool,
+	"null":   Null,
+}
+
+// Array は要素の型が Element の配列
+type Array struct {
+	Element Type
+}
+
+func (a *Array) String() string { return "[" + a.Element.String() + "]" }
+
+// Hash はキーの型が Key、値の型が Value のハッシュ
+type Hash struct {
+	Key   Type
+	Value Type
+}
+
+func (h *Hash) String() string { return "{" + h.Key.String() + ": " + h.Value.String() + "}" }
+
+// Function は関数の型。
+// Parameters が nil の場合は引数の数と型を検査しない(可変長の組み込み関数など)
+type Function struct {
+	Parameters []Type
+	Return     Type
+}
+
+func (f *Function) String() string {
+	if f.Parameters == nil {
+		return "fn(...) -> " + f.Return.String()
+	}
+
+	params := make([]string, len(f.Parameters))
+	for i, p := range f.Parameters {
+		params[i] = p.String()
+	}
+	return "fn(" + strings.Join(params, ", ") + ") -> " + f.Return.String()
+}
+
+// Identical は2つの型が同じかどうかを返す
+func Identical(a, b Type) bool {
+	switch a := a.(type) {
+	case *Basic:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Identical(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && Identical(a.Key, b.Key) && Identical(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || !Identical(a.Return, b.Return) || (a.Parameters == nil) != (b.Parameters == nil) {
+			return false
+		}
+		if len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Identical(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Consistent は型 a の値を型 b が期待される場所で使えるかどうかを返す。
+// any はすべての型と互換で、配列・ハッシュ・関数は構成要素ごとに互換性を調べる
+func Consistent(a, b Type) bool {
+	if a == Any || b == Any {
+		return true
+	}
+
+	switch a := a.(type) {
+	case *Basic:
+		return a == b
+	case *Array:
+		b, ok := b.(*Array)
+		return ok && Consistent(a.Element, b.Element)
+	case *Hash:
+		b, ok := b.(*Hash)
+		return ok && Consistent(a.Key, b.Key) && Consistent(a.Value, b.Value)
+	case *Function:
+		b, ok := b.(*Function)
+		if !ok || !Consistent(a.Return, b.Return) {
+			return false
+		}
+		if a.Parameters == nil || b.Parameters == nil {
+			return true
+		}
+		if len(a.Parameters) != len(b.Parameters) {
+			return false
+		}
+		for i := range a.Parameters {
+			if !Consistent(a.Parameters[i], b.Parameters[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Join は a と b のどちらかの値をとる式の型を返す。
+// 直和型はないので、型が異なる場合は any になる
+func Join(a, b Type) Type {
+	if Identical(a, b) {
+		return a
+	}
+
+	switch a := a.(type) {
+	case *Array:
+		if b, ok := b.(*Array); ok {
+			return &Array{Element: Join(a.Element, b.Element)}
+		}
+	case *Hash:
+		if b, ok := b.(*Hash); ok {
+			return &Hash{Key: Join(a.Key, b.Key), Value: Join(a.Value, b.Value)}
+		}
+	}
+	return Any
+}
+
+// Hashable はハッシュのキーとして使える型かどうかを返す。
+// 配列は要素が、ハッシュは値がキーとして使える型ならキーにできる
+func Hashable(t Type) bool {
+	switch t := t.(type) {
+	case *Array:
+		return Hashable(t.Element)
+	case *Hash:
+		return Hashable(t.Value)
+	}
+	return t == Any || t == Int || t == String || t == Bool
+}
+
+// FromAST は型注釈を型に変換する
+func FromAST(t ast.Type) (Type, error) {
+	switch t := t.(type) {
+	case *ast.NamedType:
+		if b, ok := basics[t.Name]; ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("unknown type %s", t.Name)
+	case *ast.ArrayType:
+		elem, err := FromAST(t.Element)
+		if err != nil {
+			return nil, err
+		}
+		return &Array{Element: elem}, nil
+	case *ast.HashType:
+		key, err := FromAST(t.Key)
+		if err != nil {
+			return nil, err
+		}
+		if !Hashable(key) {
+			return nil, fmt.Errorf("unusable as hash key: %s", key)
+		}
+		value, err := FromAST(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &Hash{Key: key, Value: value}, nil
+	case *ast.FunctionType:
+		fn := &Function{Parameters: []Type{}, Return: Any}
+		for _, p := range t.Parameters {
+			param, err := FromAST(p)
+			if err != nil {
+				return nil, err
+			}
+			fn.Parameters = append(fn.Parameters, param)
+		}
+		if t.Return != nil {
+			ret, err := FromAST(t.Return)
+			if err != nil {
+				return nil, err
+			}
+			fn.Return = ret
+		}
+		return fn, nil
+	}
+	return nil, fmt.Errorf("invalid type annotation")
+}
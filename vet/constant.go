@@ -0,0 +1,112 @@
+package vet
+
+import "monkey/ast"
+
+// always は値はわからないが、常に真として評価される式(配列・ハッシュ・関数リテラル)の値
+type always struct{}
+
+// constant は式が定数の場合にその値を返す。値は int64, bool, string, always のいずれか
+func constant(exp ast.Expression) (interface{}, bool) {
+	switch exp := exp.(type) {
+	case *ast.IntegerLiteral:
+		return exp.Value, true
+	case *ast.Boolean:
+		return exp.Value, true
+	case *ast.StringLiteral:
+		return exp.Value, true
+	case *ast.ArrayLiteral, *ast.HashLiteral, *ast.FunctionLiteral:
+		return always{}, true
+	case *ast.PrefixExpression:
+		right, ok := constant(exp.Right)
+		if !ok {
+			return nil, false
+		}
+		switch exp.Operator {
+		case "!":
+			return !truthy(right), true
+		case "-":
+			if v, ok := right.(int64); ok {
+				return -v, true
+			}
+		}
+	case *ast.InfixExpression:
+		left, ok := constant(exp.Left)
+		if !ok {
+			return nil, false
+		}
+		right, ok := constant(exp.Right)
+		if !ok {
+			return nil, false
+		}
+		return constantInfix(exp.Operator, left, right)
+	}
+	return nil, false
+}
+
+func constantInfix(operator string, left, right interface{}) (interface{}, bool) {
+	switch l := left.(type) {
+	case int64:
+		r, ok := right.(int64)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r == 0 {
+				return nil, false
+			}
+			return l / r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "+":
+			return l + r, true
+		case "<":
+			return l < r, true
+		case ">":
+			return l > r, true
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	case bool:
+		r, ok := right.(bool)
+		if !ok {
+			return nil, false
+		}
+		switch operator {
+		case "==":
+			return l == r, true
+		case "!=":
+			return l != r, true
+		}
+	}
+	return nil, false
+}
+
+// truthy は Monkey の真偽の規則で値を評価する。false と null 以外は真
+func truthy(value interface{}) bool {
+	if b, ok := value.(bool); ok {
+		return b
+	}
+	return true
+}
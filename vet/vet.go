@@ -0,0 +1,226 @@
+// Package vet は Monkey のプログラムを実行せずに検査し、実行時まで気づきにくい誤りを警告する。
+//
+// 識別子の解決には resolver パッケージ(コンパイラの SymbolTable)を使う。検査の種類は次のとおり。
+//
+//	unused       使われていない let 文の束縛
+//	shadow       関数の引数を覆い隠す let 文や引数
+//	arity        関数リテラルを束縛した名前を、引数の数を間違えて呼び出している
+//	unreachable  return の後にあって実行されない文
+//	condition    常に真、または常に偽になる if の条件
+//
+// 行末のコメント、または直前の行のコメントに "vet:ignore" と書くと、その行の警告を抑制できる。
+// "vet:ignore unused shadow" のように検査の名前を続けると、その検査だけを抑制する。
+package vet
+
+import (
+	"fmt"
+	"monkey/ast"
+	"monkey/lexer"
+	"monkey/parser"
+	"monkey/resolver"
+	"monkey/stdlib"
+	"sort"
+	"strings"
+)
+
+// Diagnostic は検査で見つかった警告
+type Diagnostic struct {
+	Line    int
+	Column  int
+	Check   string // 検査の名前 (unused, shadow, arity, unreachable, condition)
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s (%s)", d.Line, d.Column, d.Message, d.Check)
+}
+
+// Source はソースコードを解析して検査する。構文エラーがある場合は検査せずにエラーを返す
+func Source(src string) ([]Diagnostic, error) {
+	p := parser.New(lexer.NewWithComments(src))
+	program := p.ParseProgram()
+	if len(p.Errors()) != 0 {
+		return nil, fmt.Errorf("parser errors:\n\t%s", strings.Join(p.Errors(), "\n\t"))
+	}
+	return Program(program), nil
+}
+
+// Program は AST を検査し、警告を位置の順に返す。
+// prelude の定義はグローバルとして扱うので、prelude の関数の呼び出しも検査される
+func Program(program *ast.Program) []Diagnostic {
+	r := resolver.New()
+	if prelude, err := stdlib.Program(); err == nil {
+		r.Resolve(prelude)
+	}
+
+	c := &checker{info: r.Resolve(program)}
+	c.unused()
+	c.shadow()
+	c.walk(program.Statements)
+
+	diagnostics := suppress(c.diagnostics, program.Comments)
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	return diagnostics
+}
+
+type checker struct {
+	info        *resolver.Info
+	diagnostics []Diagnostic
+}
+
+func (c *checker) report(node ast.Node, check, format string, a ...interface{}) {
+	tok := ast.TokenOf(node)
+	c.diagnostics = append(c.diagnostics, Diagnostic{
+		Line:    tok.Line,
+		Column:  tok.Column,
+		Check:   check,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// unused は使われていない let 文の束縛を報告する。
+// グローバルに束縛した関数はライブラリとして定義されていることがあるので報告しない。
+// 名前が '_' で始まる束縛は意図的に使わないものとして扱う
+func (c *checker) unused() {
+	for _, b := range c.info.Bindings {
+		if b.Kind != resolver.Let || strings.HasPrefix(b.Name, "_") {
+			continue
+		}
+
+		fn, isFunction := b.Value.(*ast.FunctionLiteral)
+		if b.Function == nil && isFunction {
+			continue
+		}
+
+		uses := len(b.Uses)
+		if isFunction {
+			uses -= recursiveUses(b, fn) // 自分自身の再帰呼び出しは使用に数えない
+		}
+		if uses == 0 {
+			c.report(b.Ident, "unused", "%s declared and not used", b.Name)
+		}
+	}
+}
+
+func recursiveUses(b *resolver.Binding, fn *ast.FunctionLiteral) int {
+	uses := map[*ast.Identifier]bool{}
+	for _, ident := range b.Uses {
+		uses[ident] = true
+	}
+
+	n := 0
+	ast.Inspect(fn, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Identifier); ok && uses[ident] {
+			n++
+		}
+		return true
+	})
+	return n
+}
+
+// shadow は関数の引数を覆い隠す let 文や、外側の関数の引数と同じ名前の引数を報告する
+func (c *checker) shadow() {
+	for _, b := range c.info.Bindings {
+		prev := b.Shadows
+		if prev == nil || prev.Kind != resolver.Parameter || b.Function == nil {
+			continue
+		}
+		c.report(b.Ident, "shadow", "declaration of %s shadows parameter declared at %d:%d",
+			b.Name, prev.Ident.Token.Line, prev.Ident.Token.Column)
+	}
+}
+
+// walk は文の並びをたどり、到達できない文、引数の数の誤り、定数の条件を報告する
+func (c *checker) walk(stmts []ast.Statement) {
+	for i, stmt := range stmts {
+		if _, ok := stmt.(*ast.ReturnStatement); ok && i+1 < len(stmts) {
+			c.report(stmts[i+1], "unreachable", "unreachable code")
+		}
+
+		ast.Inspect(stmt, func(node ast.Node) bool {
+			switch node := node.(type) {
+			case *ast.BlockStatement:
+				c.walk(node.Statements)
+				return false
+			case *ast.CallExpression:
+				c.checkArity(node)
+			case *ast.IfExpression:
+				c.checkCondition(node)
+			}
+			return true
+		})
+	}
+}
+
+// checkArity は呼び出す関数が静的にわかる場合に、引数の数を検査する。
+// VM は呼び出し時に同じ検査を行い、一致しない場合は実行時エラーになる
+func (c *checker) checkArity(call *ast.CallExpression) {
+	var fn *ast.FunctionLiteral
+	var name string
+
+	switch callee := call.Function.(type) {
+	case *ast.FunctionLiteral:
+		fn, name = callee, "function literal"
+	case *ast.Identifier:
+		ref, ok := c.info.Uses[callee]
+		if !ok {
+			return
+		}
+		fn, _ = ref.Binding.Value.(*ast.FunctionLiteral)
+		name = callee.Value
+	}
+
+	if fn == nil || len(fn.Parameters) == len(call.Arguments) {
+		return
+	}
+	c.report(call.Function, "arity", "wrong number of arguments to %s: want=%d, got=%d",
+		name, len(fn.Parameters), len(call.Arguments))
+}
+
+func (c *checker) checkCondition(exp *ast.IfExpression) {
+	value, ok := constant(exp.Condition)
+	if !ok {
+		return
+	}
+	c.report(exp, "condition", "condition is always %t", truthy(value))
+}
+
+// suppress は vet:ignore コメントで抑制された警告を取り除く
+func suppress(diagnostics []Diagnostic, comments []*ast.Comment) []Diagnostic {
+	ignored := map[int]map[string]bool{} // 行番号から抑制する検査の名前へ。"" はすべての検査
+	for _, c := range comments {
+		text := strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*")
+		text = strings.TrimSpace(strings.TrimSuffix(text, "*/"))
+		if !strings.HasPrefix(text, "vet:ignore") {
+			continue
+		}
+
+		line := c.Token.Line
+		if !c.Trailing {
+			line += strings.Count(c.Text, "\n") + 1 // 単独の行のコメントは次の行に適用する
+		}
+		if ignored[line] == nil {
+			ignored[line] = map[string]bool{}
+		}
+
+		checks := strings.Fields(strings.TrimPrefix(text, "vet:ignore"))
+		if len(checks) == 0 {
+			checks = []string{""}
+		}
+		for _, check := range checks {
+			ignored[line][check] = true
+		}
+	}
+
+	result := []Diagnostic{}
+	for _, d := range diagnostics {
+		if checks := ignored[d.Line]; checks[""] || checks[d.Check] {
+			continue
+		}
+		result = append(result, d)
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package vet
+
+import (
+	"monkey/stdlib"
+	"strings"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		// unused
+		{"let x = 1;", []string{"1:5: x declared and not used (unused)"}},
+		{"let x = 1; puts(x);", nil},
+		{"let _x = 1;", nil},
+		{"let lib = fn() { 1 };", nil},
+		{"let f = fn() { let g = fn(n) { g(n) }; 1 }; f();", []string{"1:20: g declared and not used (unused)"}},
+		{"let f = fn(a) { let b = a; let c = b; c }; f(1);", nil},
+		// shadow
+		{"let f = fn(x) { let x = 2; x }; f(1);", []string{"1:21: declaration of x shadows parameter declared at 1:12 (shadow)"}},
+		{"let f = fn(x) { fn(x) { x } }; f(1);", []string{"1:20: declaration of x shadows parameter declared at 1:12 (shadow)"}},
+		{"let x = 1; let f = fn(y) { let x = y; x }; f(x);", nil},
+		// arity
+		{"let add = fn(a, b) { a + b }; add(1);", []string{"1:31: wrong number of arguments to add: want=2, got=1 (arity)"}},
+		{"fn(a) { a }(1, 2);", []string{"1:1: wrong number of arguments to function literal: want=1, got=2 (arity)"}},
+		{"let f = fn(g) { g(1, 2) }; f(len);", nil},
+		{"puts(map([1, 2]));", []string{"1:6: wrong number of arguments to map: want=2, got=1 (arity)"}},
+		{"let add = fn(a, b) { a + b }; add(1, add(2));", []string{"1:38: wrong number of arguments to add: want=2, got=1 (arity)"}},
+		// unreachable
+		{"let f = fn() { return 1; puts(2); puts(3); }; f();", []string{"1:26: unreachable code (unreachable)"}},
+		{"let f = fn(x) { if (x) { return 1; } 2 }; f(true);", nil},
+		// condition
+		{"if (true) { 1 }", []string{"1:1: condition is always true (condition)"}},
+		{"if (1 > 2) { 1 }", []string{"1:1: condition is always false (condition)"}},
+		{"if (!0) { 1 }", []string{"1:1: condition is always false (condition)"}},
+		{`if ("a" == "a") { 1 }`, []string{"1:1: condition is always true (condition)"}},
+		{"if ([]) { 1 }", []string{"1:1: condition is always true (condition)"}},
+		{"let x = 1; if (x > 2) { 1 }", nil},
+		{"if (1 / 0) { 1 }", nil},
+	}
+
+	for _, tt := range tests {
+		diagnostics, err := Source(tt.input)
+		if err != nil {
+			t.Fatalf("Source(%q) returned error: %s", tt.input, err)
+		}
+
+		actual := []string{}
+		for _, d := range diagnostics {
+			actual = append(actual, d.String())
+		}
+
+		if strings.Join(actual, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("wrong diagnostics for %q.\nwant=%q\ngot= %q", tt.input, tt.expected, actual)
+		}
+	}
+}
+
+func TestSuppression(t *testing.T) {
+	input := `let a = 1; // vet:ignore
+// vet:ignore
+let b = 2;
+let c = 3; // vet:ignore shadow
+let f = fn(x) { let x = 1; x }; /* vet:ignore unused shadow */
+if (true) { f(1) } // vet:ignore arity
+let d = 4;`
+
+	diagnostics, err := Source(input)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+
+	expected := []string{
+		"4:5: c declared and not used (unused)",
+		"6:1: condition is always true (condition)",
+		"7:5: d declared and not used (unused)",
+	}
+
+	actual := []string{}
+	for _, d := range diagnostics {
+		actual = append(actual, d.String())
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("wrong diagnostics.\nwant=%q\ngot= %q", expected, actual)
+	}
+}
+
+func TestSourceParseError(t *testing.T) {
+	if _, err := Source("let = 1;"); err == nil {
+		t.Fatalf("expected an error, got nil")
+	}
+}
+
+func TestPreludeIsClean(t *testing.T) {
+	diagnostics, err := Source(stdlib.Prelude)
+	if err != nil {
+		t.Fatalf("Source returned error: %s", err)
+	}
+	for _, d := range diagnostics {
+		t.Errorf("prelude: %s", d)
+	}
+}
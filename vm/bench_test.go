@@ -0,0 +1,86 @@
+package vm
+
+import (
+	"monkey/compiler"
+	"testing"
+)
+
+func BenchmarkRecursiveFibonacci(b *testing.B) {
+	benchmarkVm(b, fibonacciInput, nil)
+}
+
+// BenchmarkRecursiveFibonacciWithHook runs the original instructions instead of the
+// superinstructions and allocates a new frame for every call, as the debugger does
+func BenchmarkRecursiveFibonacciWithHook(b *testing.B) {
+	benchmarkVm(b, fibonacciInput, &countingHook{})
+}
+
+func BenchmarkLoopSum(b *testing.B) {
+	benchmarkVm(b, `
+	let loop = fn(i, acc) { if (i == 0) { acc } else { loop(i - 1, acc + 1) } };
+	loop(500, 0);
+	`, nil)
+}
+
+func BenchmarkClosures(b *testing.B) {
+	benchmarkVm(b, `
+	let adder = fn(x) { fn(y) { x + y } };
+	let loop = fn(i, acc) { if (i == 0) { acc } else { loop(i - 1, adder(i)(acc)) } };
+	loop(500, 0);
+	`, nil)
+}
+
+func BenchmarkStringConcat(b *testing.B) {
+	benchmarkVm(b, `
+	let loop = fn(i, s) { if (i == 0) { s } else { loop(i - 1, s + "x") } };
+	loop(200, "");
+	`, nil)
+}
+
+func BenchmarkIndex(b *testing.B) {
+	benchmarkVm(b, `
+	let array = [1, 2, 3, 4, 5];
+	let hash = {"a": 1, "b": 2, "c": 3};
+	let loop = fn(i, acc) {
+		if (i == 0) { acc } else { loop(i - 1, acc + array[i - (i / 5) * 5] + hash["b"]) }
+	};
+	loop(500, 0);
+	`, nil)
+}
+
+func BenchmarkBuiltins(b *testing.B) {
+	benchmarkVm(b, `
+	let loop = fn(i, arr) { if (i == 0) { len(arr) } else { loop(i - 1, push(arr, first(range(i, i + 1)))) } };
+	loop(200, []);
+	`, nil)
+}
+
+const fibonacciInput = `
+let fibonacci = fn(x) {
+	if (x < 2) { x } else { fibonacci(x - 1) + fibonacci(x - 2) }
+};
+fibonacci(20);
+`
+
+// benchmarkVm compiles the input once and reports the time and allocations of running it.
+// If hook is not nil, it is attached to the VM.
+func benchmarkVm(b *testing.B, input string, hook Hook) {
+	b.Helper()
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		b.Fatalf("compiler error: %s", err)
+	}
+	bytecode := comp.Bytecode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vm := New(bytecode)
+		if hook != nil {
+			vm.SetHook(hook)
+		}
+		if err := vm.Run(); err != nil {
+			b.Fatalf("vm error: %s", err)
+		}
+	}
+}
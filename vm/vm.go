@@ -1,19 +1,24 @@
 package vm
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"monkey/code"
 	"monkey/compiler"
 	"monkey/object"
+	"os"
+	"sync/atomic"
+	"unicode/utf8"
 )
 
 const StackSize = 2048
 const GlobalSize = 65536
 const MaxFrames = 1024
 
-var True = &object.Boolean{Value: true}
-var False = &object.Boolean{Value: false}
-var Null = &object.Null{}
+var True = object.TRUE
+var False = object.FALSE
+var Null = object.NULL
 
 type VM struct {
 	constants []object.Object
@@ -25,10 +30,40 @@ type VM struct {
 
 	frames      []*Frame
 	framesIndex int
+
+	output io.Writer // Where builtins such as puts write
+
+	hook   Hook  // Notified before each instruction. nil unless a debugger is attached.
+	halted error // The error the hook or Interrupt stopped the VM with. Set even while a builtin is calling a function.
+
+	interrupted atomic.Bool // Set by Interrupt. Checked on every call of a closure.
+}
+
+// ErrInterrupted is returned by Run when Interrupt stopped the VM.
+var ErrInterrupted = errors.New("interrupted")
+
+// Hook lets a debugger observe the VM. Before is called with the VM before each instruction
+// is executed, so the hook can inspect the frames, locals and the stack with the exported
+// accessors. Returning an error stops Run with that error.
+type Hook interface {
+	Before(vm *VM) error
+}
+
+// Hooks attaches several hooks at once. Before calls each hook in order and stops at the
+// first one that returns an error.
+type Hooks []Hook
+
+func (h Hooks) Before(vm *VM) error {
+	for _, hook := range h {
+		if err := hook.Before(vm); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func New(bytecode *compiler.Bytecode) *VM {
-	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions}
+	mainFn := &object.CompiledFunction{Instructions: bytecode.Instructions, SourceMap: bytecode.SourceMap, Branches: bytecode.Branches}
 	mainClousre := &object.Closure{Fn: mainFn}
 	mainFrame := NewFrame(mainClousre, 0)
 
@@ -45,6 +80,8 @@ func New(bytecode *compiler.Bytecode) *VM {
 
 		frames:      frames,
 		framesIndex: 1, // Points to the next frame to be used.
+
+		output: os.Stdout,
 	}
 }
 
@@ -54,6 +91,57 @@ func NewWithGlobalStore(bytecode *compiler.Bytecode, s []object.Object) *VM {
 	return vm
 }
 
+// SetOutput sets where builtins such as puts write. Passing nil writes to os.Stdout.
+func (vm *VM) SetOutput(w io.Writer) {
+	if w == nil {
+		w = os.Stdout
+	}
+	vm.output = w
+}
+
+// Interrupt stops Run with ErrInterrupted at the next call of a closure. Monkey has no loops,
+// so a program that runs for long keeps calling closures. It is safe to call Interrupt from
+// another goroutine while Run is running.
+func (vm *VM) Interrupt() {
+	vm.interrupted.Store(true)
+}
+
+// SetHook attaches h to the VM. Passing nil detaches it.
+func (vm *VM) SetHook(h Hook) {
+	vm.hook = h
+}
+
+// Frames returns the active call frames. The main frame comes first and the current frame last.
+func (vm *VM) Frames() []*Frame {
+	return vm.frames[:vm.framesIndex]
+}
+
+// Locals returns the local variables of f, including its arguments, indexed like LocalNames
+// of the frame's function.
+func (vm *VM) Locals(f *Frame) []object.Object {
+	return vm.stack[f.basePointer : f.basePointer+f.cl.Fn.NumLocals]
+}
+
+// Operands returns the values f has pushed on the stack on top of its local variables.
+// The top of the stack comes last.
+func (vm *VM) Operands(f *Frame) []object.Object {
+	start := f.basePointer + f.cl.Fn.NumLocals
+	end := vm.sp
+	for _, frame := range vm.Frames() {
+		// The operands of f end where the callee and arguments of the next frame begin
+		if frame.basePointer > f.basePointer {
+			end = frame.basePointer - 1
+			break
+		}
+	}
+	return vm.stack[start:end]
+}
+
+// Global returns the value of the global variable at index, or nil if it is not set yet.
+func (vm *VM) Global(index int) object.Object {
+	return vm.globals[index]
+}
+
 func (vm *VM) StackTop() object.Object {
 	if vm.sp == 0 {
 		return nil
@@ -62,202 +150,279 @@ func (vm *VM) StackTop() object.Object {
 }
 
 func (vm *VM) Run() error {
-	var ip int
-	var ins code.Instructions
-	var op code.Opcode
+	return vm.run(0)
+}
+
+// run executes instructions until the frames above depth have returned.
+// Run passes 0 to execute the main frame to the end.
+func (vm *VM) run(depth int) error {
+	// The current frame, its instructions and its ip are kept in local variables while the frame
+	// runs. frame.ip is brought up to date before anything else can look at the frame: the hook,
+	// a call, and a returned error.
+	if vm.framesIndex <= depth {
+		// call has called a builtin, which has already returned
+		return nil
+	}
+	frame := vm.currentFrame()
+	ins := vm.instructions(frame)
+	ip := frame.ip
 
-	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
-		vm.currentFrame().ip++
+	for ip < len(ins)-1 {
+		ip++
 
-		ip = vm.currentFrame().ip
-		ins = vm.currentFrame().Instructions()
-		op = code.Opcode(ins[ip])
+		if vm.hook != nil {
+			frame.ip = ip
+			if err := vm.hook.Before(vm); err != nil {
+				vm.halted = err
+				return err
+			}
+		}
 
-		switch op {
+		var err error
+
+		switch op := code.Opcode(ins[ip]); op {
 		case code.OpConstant:
 			constIndex := code.ReadUint16(ins[ip+1:]) // Fetch the operand of OpConstant by reading the next 2 bytes.
-			vm.currentFrame().ip += 2                 // ensure that the next ip points to the next OpCode. This is because. the operand width of OpConstant is 2 bytes.
+			ip += 2                                   // ensure that the next ip points to the next OpCode. This is because. the operand width of OpConstant is 2 bytes.
 
-			err := vm.push(vm.constants[constIndex])
-			if err != nil {
-				return err
-			}
+			err = vm.push(vm.constants[constIndex])
 		case code.OpPop:
 			vm.pop()
 		case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv:
-			err := vm.executeBinaryOperation(op)
-			if err != nil {
-				return err
-			}
+			err = vm.executeBinaryOperation(op)
 		case code.OpEqual, code.OpNotEqual, code.OpGreaterThan:
-			err := vm.executeComparison(op)
-			if err != nil {
-				return err
-			}
+			err = vm.executeComparison(op)
 		case code.OpTrue:
-			err := vm.push(True)
-			if err != nil {
-				return err
-			}
+			err = vm.push(True)
 		case code.OpFalse:
-			err := vm.push(False)
-			if err != nil {
-				return err
-			}
+			err = vm.push(False)
 		case code.OpBang:
-			err := vm.executeBangOperator()
-			if err != nil {
-				return err
-			}
+			err = vm.executeBangOperator()
 		case code.OpMinus:
-			err := vm.executeMinusOperator()
-			if err != nil {
-				return err
-			}
+			err = vm.executeMinusOperator()
 		case code.OpJump:
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip = pos - 1 // -1 because the loop will increment ip by 1 after the switch statement.
+			ip = pos - 1 // -1 because the loop will increment ip by 1 after the switch statement.
 		case code.OpJumpNotTruthy:
 			pos := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			condition := vm.pop()
 			if !isTruthy(condition) {
-				vm.currentFrame().ip = pos - 1 // Again, -1 because the loop will increment ip by 1 after the switch statement.
+				ip = pos - 1 // Again, -1 because the loop will increment ip by 1 after the switch statement.
 			}
 		case code.OpNull:
-			err := vm.push(Null)
-			if err != nil {
-				return err
-			}
+			err = vm.push(Null)
 		case code.OpSetGlobal:
 			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			vm.globals[globalIndex] = vm.pop()
 		case code.OpGetGlobal:
+			// The compiler resolves global variables to slots, so the operand already is the
+			// location of the value and there is nothing to look up or cache.
 			globalIndex := code.ReadUint16(ins[ip+1:])
-			vm.currentFrame().ip += 2
+			ip += 2
 
-			err := vm.push(vm.globals[globalIndex])
-			if err != nil {
-				return err
-			}
+			err = vm.push(vm.globals[globalIndex])
 		case code.OpArray:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
 			array := vm.buildArray(vm.sp-numElements, vm.sp)
 			vm.sp = vm.sp - numElements // Remove the elements from the stack after building the array.
 
-			err := vm.push(array)
-			if err != nil {
-				return err
-			}
+			err = vm.push(array)
 		case code.OpHash:
 			numElements := int(code.ReadUint16(ins[ip+1:]))
-			vm.currentFrame().ip += 2
+			ip += 2
 
-			hash, err := vm.buildHash(vm.sp-numElements, vm.sp)
-			if err != nil {
-				return err
-			}
-			vm.sp = vm.sp - numElements
-			err = vm.push(hash)
-			if err != nil {
-				return err
+			var hash *object.Hash
+			hash, err = vm.buildHash(vm.sp-numElements, vm.sp)
+			if err == nil {
+				vm.sp = vm.sp - numElements
+				err = vm.push(hash)
 			}
 		case code.OpIndex:
 			index := vm.pop()
 			left := vm.pop()
 
-			err := vm.executeIndexExpression(left, index)
-			if err != nil {
-				return err
-			}
+			err = vm.executeIndexExpression(left, index)
+		case code.OpSlice:
+			end := vm.pop()
+			start := vm.pop()
+			left := vm.pop()
+
+			err = vm.executeSliceExpression(left, start, end)
 		case code.OpCall:
 			numArgs := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-
-			err := vm.executeCall(int(numArgs))
-			if err != nil {
-				return err
+			ip += 1
+
+			frame.ip = ip
+			if err = vm.executeCall(int(numArgs)); err == nil {
+				// Switch to the callee. A builtin leaves the current frame as it is.
+				frame = vm.currentFrame()
+				ins = vm.instructions(frame)
+				ip = frame.ip
 			}
 		case code.OpClosure:
 			constIndex := code.ReadUint16(ins[ip+1:])
 			numFree := code.ReadUint8(ins[ip+3:]) // numFree
-			vm.currentFrame().ip += 3
+			ip += 3
 
-			err := vm.pushClosure(int(constIndex), int(numFree))
-			if err != nil {
-				return err
-			}
+			err = vm.pushClosure(int(constIndex), int(numFree))
 		case code.OpCurrentClosure:
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure)
-			if err != nil {
-				return err
-			}
+			err = vm.push(frame.cl)
 		case code.OpGetFree:
 			freeIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			ip += 1
 
-			currentClosure := vm.currentFrame().cl
-			err := vm.push(currentClosure.Free[freeIndex])
-			if err != nil {
-				return err
+			err = vm.push(frame.cl.Free[freeIndex])
+		case code.OpReturnValue, code.OpReturn:
+			var returnValue object.Object = Null
+			if op == code.OpReturnValue {
+				returnValue = vm.pop()
 			}
-		case code.OpReturnValue:
-			returnValue := vm.pop()
-
-			frame := vm.popFrame()
-			vm.sp = frame.basePointer - 1 // Pop the frame and set the stack pointer to the last value of the frame
 
-			err := vm.push(returnValue) // Push the return value to the stack
-			if err != nil {
-				return err
+			if vm.framesIndex == 1 {
+				// A return at the top level ends the program, as it does in the evaluator.
+				// The returned value is left where LastPoppedStackElem finds it.
+				vm.stack[vm.sp] = returnValue
+				frame.ip = len(ins) - 1
+				return nil
 			}
-		case code.OpReturn:
-			frame := vm.popFrame()
+
+			vm.popFrame()
 			vm.sp = frame.basePointer - 1 // Pop the frame and set the stack pointer to the last value of the frame. At this time, the basePointer points to the next stack to the one which stores compiledFunction value, so we need to subtract 1 to get rid of the compiledFunction.
 
-			err := vm.push(Null) // Push Null to the stack
-			if err != nil {
-				return err
+			if err = vm.push(returnValue); err == nil {
+				if vm.framesIndex <= depth {
+					return nil
+				}
+				// Switch back to the caller
+				frame = vm.currentFrame()
+				ins = vm.instructions(frame)
+				ip = frame.ip
 			}
 		case code.OpSetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-
-			frame := vm.currentFrame()
+			ip += 1
 
 			vm.stack[frame.basePointer+int(localIndex)] = vm.pop() // Set the local variable on the stack
 		case code.OpGetLocal:
 			localIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
-
-			frame := vm.currentFrame()
+			ip += 1
 
-			err := vm.push(vm.stack[frame.basePointer+int(localIndex)]) // Push the local variable to the stack
-			if err != nil {
-				return err
-			}
+			err = vm.push(vm.stack[frame.basePointer+int(localIndex)]) // Push the local variable to the stack
 		case code.OpGetBuiltin:
 			builtinIndex := code.ReadUint8(ins[ip+1:])
-			vm.currentFrame().ip += 1
+			ip += 1
 
 			definition := object.Builtins[builtinIndex]
 
-			err := vm.push(definition.Builtin)
-			if err != nil {
-				return err
+			err = vm.push(definition.Builtin)
+
+		// Superinstructions. See code.Fuse for how their operands are laid out.
+		case code.OpGetLocalConstantAdd, code.OpGetLocalConstantSub:
+			local := vm.stack[frame.basePointer+int(ins[ip+1])]
+			constant := vm.constants[code.ReadUint16(ins[ip+3:])]
+			ip += 5 // The ip of the OpAdd or OpSub
+
+			err = vm.executeLocalConstantOperation(op, local, constant)
+		case code.OpGetLocalConstant:
+			local := vm.stack[frame.basePointer+int(ins[ip+1])]
+			constant := vm.constants[code.ReadUint16(ins[ip+3:])]
+			ip += 4
+
+			if err = vm.push(local); err == nil {
+				err = vm.push(constant)
+			}
+		case code.OpEqualJumpNotTruthy, code.OpNotEqualJumpNotTruthy, code.OpGreaterThanJumpNotTruthy:
+			pos := int(code.ReadUint16(ins[ip+2:]))
+			ip += 3 // The ip of the last operand byte of the OpJumpNotTruthy
+
+			var result bool
+			if result, err = vm.compareAndPop(op); err == nil && !result {
+				ip = pos - 1
 			}
 		}
+
+		if err != nil {
+			frame.ip = ip
+			return err
+		}
 	}
 
+	frame.ip = ip
 	return nil
 }
 
+// instructions returns the instructions to run for frame. The superinstructions are used only
+// while no hook is attached, because the hook expects to see every instruction.
+func (vm *VM) instructions(frame *Frame) code.Instructions {
+	if fused := frame.cl.Fn.Fused; fused != nil && vm.hook == nil {
+		return fused
+	}
+	return frame.cl.Fn.Instructions
+}
+
+// executeLocalConstantOperation adds or subtracts constant to or from local and pushes the
+// result. Integers are computed directly; other values fall back to executeBinaryOperation.
+func (vm *VM) executeLocalConstantOperation(op code.Opcode, local, constant object.Object) error {
+	left, ok := local.(*object.Integer)
+	right, ok2 := constant.(*object.Integer)
+	if !ok || !ok2 {
+		if err := vm.push(local); err != nil {
+			return err
+		}
+		if err := vm.push(constant); err != nil {
+			return err
+		}
+		if op == code.OpGetLocalConstantAdd {
+			return vm.executeBinaryOperation(code.OpAdd)
+		}
+		return vm.executeBinaryOperation(code.OpSub)
+	}
+
+	if op == code.OpGetLocalConstantAdd {
+		return vm.push(object.NewInteger(left.Value + right.Value))
+	}
+	return vm.push(object.NewInteger(left.Value - right.Value))
+}
+
+// compareAndPop compares the top two values of the stack for a compare-and-jump
+// superinstruction, pops them and returns the result of the comparison.
+func (vm *VM) compareAndPop(op code.Opcode) (bool, error) {
+	var comparison code.Opcode
+	switch op {
+	case code.OpEqualJumpNotTruthy:
+		comparison = code.OpEqual
+	case code.OpNotEqualJumpNotTruthy:
+		comparison = code.OpNotEqual
+	default:
+		comparison = code.OpGreaterThan
+	}
+
+	left, ok := vm.stack[vm.sp-2].(*object.Integer)
+	right, ok2 := vm.stack[vm.sp-1].(*object.Integer)
+	if ok && ok2 {
+		vm.sp -= 2
+		switch comparison {
+		case code.OpEqual:
+			return left.Value == right.Value, nil
+		case code.OpNotEqual:
+			return left.Value != right.Value, nil
+		default:
+			return left.Value > right.Value, nil
+		}
+	}
+
+	if err := vm.executeComparison(comparison); err != nil {
+		return false, err
+	}
+	return isTruthy(vm.pop()), nil
+}
+
 func (vm *VM) push(o object.Object) error {
 	if vm.sp >= StackSize {
 		return fmt.Errorf("stack overflow")
@@ -316,7 +481,7 @@ func (vm *VM) executeBinaryIntegerOperation(op code.Opcode, left, right object.O
 	default:
 		return fmt.Errorf("unknown integer operator: %d", op)
 	}
-	return vm.push(&object.Integer{Value: result})
+	return vm.push(object.NewInteger(result))
 }
 
 func (vm *VM) executeBinaryStringOperation(op code.Opcode, left, right object.Object) error {
@@ -337,11 +502,15 @@ func (vm *VM) executeComparison(op code.Opcode) error {
 		return vm.executeIntegerComparison(op, left, right)
 	}
 
+	if left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ {
+		return vm.executeStringComparison(op, left, right)
+	}
+
 	switch op {
 	case code.OpEqual:
-		return vm.push(nativeBoolToBooleanObject(right == left))
+		return vm.push(nativeBoolToBooleanObject(object.Equal(left, right)))
 	case code.OpNotEqual:
-		return vm.push(nativeBoolToBooleanObject(right != left))
+		return vm.push(nativeBoolToBooleanObject(!object.Equal(left, right)))
 	default:
 		return fmt.Errorf("unknown operator: %d (%s %s)", op, left.Type(), right.Type())
 	}
@@ -367,6 +536,26 @@ func (vm *VM) executeIntegerComparison(op code.Opcode, left, right object.Object
 	return vm.push(nativeBoolToBooleanObject(result))
 }
 
+func (vm *VM) executeStringComparison(op code.Opcode, left, right object.Object) error {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	var result bool
+
+	switch op {
+	case code.OpEqual:
+		result = leftValue == rightValue
+	case code.OpNotEqual:
+		result = leftValue != rightValue
+	case code.OpGreaterThan:
+		result = leftValue > rightValue
+	default:
+		return fmt.Errorf("unknown string operator: %d", op)
+	}
+
+	return vm.push(nativeBoolToBooleanObject(result))
+}
+
 func (vm *VM) executeBangOperator() error {
 	operand := vm.pop()
 	switch operand {
@@ -388,13 +577,15 @@ func (vm *VM) executeMinusOperator() error {
 	}
 
 	value := operand.(*object.Integer).Value
-	return vm.push(&object.Integer{Value: -value})
+	return vm.push(object.NewInteger(-value))
 }
 
 func (vm *VM) executeIndexExpression(left, index object.Object) error {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return vm.executeArrayIndex(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return vm.executeStringIndex(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return vm.executeHashIndex(left, index)
 	default:
@@ -414,14 +605,83 @@ func (vm *VM) executeArrayIndex(left, index object.Object) error {
 	return vm.push(array.Elements[i])
 }
 
+func (vm *VM) executeStringIndex(left, index object.Object) error {
+	// Strings are indexed by rune, not by byte
+	runes := []rune(left.(*object.String).Value)
+	i := index.(*object.Integer).Value
+	max := int64(len(runes) - 1)
+
+	if i < 0 || i > max {
+		return vm.push(Null)
+	}
+
+	return vm.push(&object.String{Value: string(runes[i])})
+}
+
+func (vm *VM) executeSliceExpression(left, start, end object.Object) error {
+	var length int
+	switch left := left.(type) {
+	case *object.Array:
+		length = len(left.Elements)
+	case *object.String:
+		length = utf8.RuneCountInString(left.Value)
+	default:
+		return fmt.Errorf("slice operator not supported: %s", left.Type())
+	}
+
+	low, err := sliceBound(start, 0, length)
+	if err != nil {
+		return err
+	}
+	high, err := sliceBound(end, length, length)
+	if err != nil {
+		return err
+	}
+	if low > high {
+		low = high
+	}
+
+	switch left := left.(type) {
+	case *object.Array:
+		elements := make([]object.Object, high-low)
+		copy(elements, left.Elements[low:high])
+		return vm.push(&object.Array{Elements: elements})
+	default:
+		runes := []rune(left.(*object.String).Value)
+		return vm.push(&object.String{Value: string(runes[low:high])})
+	}
+}
+
+// sliceBound converts a bound of a slice expression to an index clamped into [0, length].
+// Null means the bound was omitted, so def is used instead.
+func sliceBound(bound object.Object, def, length int) (int, error) {
+	if bound == Null {
+		return def, nil
+	}
+
+	integer, ok := bound.(*object.Integer)
+	if !ok {
+		return 0, fmt.Errorf("slice bound must be INTEGER, got %s", bound.Type())
+	}
+
+	i := int(integer.Value)
+	if i < 0 {
+		return 0, nil
+	}
+	if i > length {
+		return length, nil
+	}
+	return i, nil
+}
+
 func (vm *VM) executeHashIndex(hash, index object.Object) error {
 	hashObject := hash.(*object.Hash)
-	key, ok := index.(object.Hashable)
+	key, ok := object.HashKeyOf(index)
 	if !ok {
 		return fmt.Errorf("unusable as hash key: %s", index.Type())
 	}
 
-	pair, ok := hashObject.Pairs[key.HashKey()]
+	pair, ok := hashObject.Pairs[key]
 	if !ok {
 		return vm.push(Null)
 	}
@@ -458,21 +718,20 @@ func (vm *VM) buildArray(startIndex, endIndex int) object.Object {
 }
 
 func (vm *VM) buildHash(startIndex, endIndex int) (*object.Hash, error) {
-	pairs := make(map[object.HashKey]object.HashPair)
+	hash := object.NewHash((endIndex - startIndex) / 2)
 	for i := startIndex; i < endIndex; i += 2 {
 		key := vm.stack[i]
 		value := vm.stack[i+1]
 
-		pair := object.HashPair{Key: key, Value: value}
-		hashKey, ok := key.(object.Hashable)
+		hashKey, ok := object.HashKeyOf(key)
 		if !ok {
 			return nil, fmt.Errorf("unusable as hash key: %s", key.Type())
 		}
 
-		pairs[hashKey.HashKey()] = pair
+		hash.Set(hashKey, object.HashPair{Key: key, Value: value})
 	}
 
-	return &object.Hash{Pairs: pairs}, nil
+	return hash, nil
 }
 
 func (vm *VM) currentFrame() *Frame {
@@ -502,21 +761,52 @@ func (vm *VM) executeCall(numArgs int) error {
 }
 
 func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if vm.interrupted.Load() {
+		vm.halted = ErrInterrupted
+		return ErrInterrupted
+	}
 	if numArgs != cl.Fn.NumParameters {
 		return fmt.Errorf("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
 	}
 
-	frame := NewFrame(cl, vm.sp-numArgs) // To avoid the situation where the base pointer skips the arguments on the stack, we set the base pointer to the current stack pointer minus the number of arguments.
+	basePointer := vm.sp - numArgs // To avoid the situation where the base pointer skips the arguments on the stack, we set the base pointer to the current stack pointer minus the number of arguments.
+
+	// Without a hook nothing keeps a frame after it returns, so the frame left in the slot by the
+	// previous call at this depth is reused instead of allocating one per call. A hook gets a new
+	// frame for every call, because the debugger tells calls apart by their frames.
+	frame := vm.frames[vm.framesIndex]
+	if frame == nil || vm.hook != nil {
+		frame = NewFrame(cl, basePointer)
+	} else {
+		*frame = Frame{cl: cl, ip: -1, basePointer: basePointer}
+	}
 	vm.pushFrame(frame)
 	vm.sp = frame.basePointer + cl.Fn.NumLocals // Allocate space for local variables
 
+	if vm.hook != nil {
+		// Clear the stale values left in the slots of the local variables, so that the debugger
+		// doesn't show them as values of variables that are not assigned yet.
+		clear(vm.stack[frame.basePointer+numArgs : vm.sp])
+	}
+
 	return nil
 }
 
 func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	args := vm.stack[vm.sp-numArgs : vm.sp]
-	result := builtin.Fn(args...) // exec the builtin function
-	vm.sp = vm.sp - numArgs - 1   // Pop the arguments and the function
+	var result object.Object
+	switch {
+	case builtin.Call != nil:
+		result = builtin.Call(vm.call, args...)
+		if vm.halted != nil {
+			return vm.halted
+		}
+	case builtin.Write != nil:
+		result = builtin.Write(vm.output, args...)
+	default:
+		result = builtin.Fn(args...) // exec the builtin function
+	}
+	vm.sp = vm.sp - numArgs - 1 // Pop the arguments and the function
 	if result != nil {
 		vm.push(result)
 	} else {
@@ -526,6 +816,32 @@ func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
 	return nil
 }
 
+// call calls fn with args on behalf of a builtin function and runs it until it returns.
+// A runtime error is returned as an *object.Error so that the builtin can handle it.
+func (vm *VM) call(fn object.Object, args ...object.Object) object.Object {
+	sp, framesIndex := vm.sp, vm.framesIndex
+	fail := func(err error) object.Object {
+		vm.sp, vm.framesIndex = sp, framesIndex
+		return &object.Error{Message: err.Error()}
+	}
+
+	if err := vm.push(fn); err != nil {
+		return fail(err)
+	}
+	for _, arg := range args {
+		if err := vm.push(arg); err != nil {
+			return fail(err)
+		}
+	}
+	if err := vm.executeCall(len(args)); err != nil {
+		return fail(err)
+	}
+	if err := vm.run(framesIndex); err != nil {
+		return fail(err)
+	}
+	return vm.pop()
+}
+
 func (vm *VM) pushClosure(constIndex, numFree int) error {
 	constant := vm.constants[constIndex]
 	function, ok := constant.(*object.CompiledFunction)
@@ -7,7 +7,9 @@ import (
 	"monkey/lexer"
 	"monkey/object"
 	"monkey/parser"
+	"strings"
 	"testing"
+	"time"
 )
 
 type vmTestCase struct {
@@ -109,6 +111,64 @@ func TestStringExpressions(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestStringOperations(t *testing.T) {
+	tests := []vmTestCase{
+		{`"monkey"[0]`, "m"},
+		{`"monkey"[5]`, "y"},
+		{`"monkey"[6]`, Null},
+		{`"monkey"[-1]`, Null},
+		{`"monkey"[1:3]`, "on"},
+		{`"monkey"[:3]`, "mon"},
+		{`"monkey"[3:]`, "key"},
+		{`"monkey"[3:99]`, "key"},
+		{`"monkey"[4:2]`, ""},
+		{`"mon" + "key" == "monkey"`, true},
+		{`"monkey" != "monkey"`, false},
+		{`"a" < "b"`, true},
+		{`"a" > "b"`, false},
+		{`"abc" > "abb"`, true},
+		{`len("日本")`, 2},
+		{`"日本語"[1]`, "本"},
+		{`"日本語"[3]`, Null},
+		{`"日本語"[1:]`, "本語"},
+		{`chars("日本")`, []string{"日", "本"}},
+		{`indexOf("こんにちは", "にち")`, 2},
+		{`let 挨拶 = "こんにちは"; 挨拶`, "こんにちは"},
+		{`"a\tb\n"`, "a\tb\n"},
+		{"`a\\tb`", "a\\tb"},
+		{`let name = "monkey"; "hello ${name}!"`, "hello monkey!"},
+		{`"${1 + 2} ${[1, 2]} ${true}"`, "3 [1, 2] true"},
+		// str という名前の束縛は補間に影響しない
+		{`let str = fn(x) { "no" }; "a${1}"`, "a1"},
+		{`let f = fn(str) { "${str}!" }; f("x")`, "x!"},
+		{`let f = fn(x) { "<${x}>" }; "${f("a")}"`, "<a>"},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestSliceExpressions(t *testing.T) {
+	tests := []vmTestCase{
+		{"[1, 2, 3][1:]", []int{2, 3}},
+		{"[1, 2, 3][:2]", []int{1, 2}},
+		{"[1, 2, 3][:]", []int{1, 2, 3}},
+		{"[1, 2, 3][-5:1]", []int{1}},
+		{"[1, 2, 3][2:1]", []int{}},
+		{"let a = [1, 2, 3]; let i = 1; a[i:i + 1]", []int{2}},
+	}
+
+	runVmTests(t, tests)
+}
+
+func TestComments(t *testing.T) {
+	tests := []vmTestCase{
+		{"// comment\n1 + /* inline */ 2 // trailing", 3},
+		{"let a = 10; /* a / 2 */ a / 2", 5},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestArrayLiterals(t *testing.T) {
 	tests := []vmTestCase{
 		{"[]", []int{}},
@@ -135,6 +195,37 @@ func TestHashLiterals(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+func TestHashInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`{}`, `{}`},
+		{`{"b": 1, "a": 2, 3: 4, true: 5}`, `{b: 1, a: 2, 3: 4, true: 5}`},
+		{`{"a": 1, "b": 2, "a": 3}`, `{a: 3, b: 2}`},
+		{`set({"b": 1, "a": 2}, "c", 3)`, `{b: 1, a: 2, c: 3}`},
+		{`delete({"c": 1, "b": 2, "a": 3}, "b")`, `{c: 1, a: 3}`},
+	}
+
+	for _, tt := range tests {
+		// Run each input several times, because map iteration order is randomized.
+		for i := 0; i < 10; i++ {
+			program := parse(tt.input)
+			comp := compiler.New()
+			if err := comp.Compile(program); err != nil {
+				t.Fatalf("compiler error: %s", err)
+			}
+			vm := New(comp.Bytecode())
+			if err := vm.Run(); err != nil {
+				t.Fatalf("vm error: %s", err)
+			}
+			if got := vm.LastPoppedStackElem().Inspect(); got != tt.expected {
+				t.Fatalf("wrong Inspect for %s. want=%s, got=%s", tt.input, tt.expected, got)
+			}
+		}
+	}
+}
+
 func TestIndexExpressions(t *testing.T) {
 	tests := []vmTestCase{
 		{"[1, 2, 3][1]", 2},
@@ -146,6 +237,12 @@ func TestIndexExpressions(t *testing.T) {
 		{"{1: 1, 2: 2}[2]", 2},
 		{"{1: 1}[0]", Null},
 		{"{}[0]", Null},
+		{`{[1, "a"]: 5}[[1, "a"]]`, 5},
+		{`{[1, "a"]: 5}[["a", 1]]`, Null},
+		{`{{"x": 1, "y": 2}: 5}[{"y": 2, "x": 1}]`, 5},
+		{`let k = [[1], {"a": true}]; {k: 5}[[[1], {"a": true}]]`, 5},
+		{`{"1": 5}[1]`, Null},
+		{`{[1]: 1, [1]: 2}[[1]]`, 2},
 	}
 
 	runVmTests(t, tests)
@@ -219,6 +316,19 @@ func TestFunctionsWithoutReturnValue(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// A return at the top level ends the program with the returned value
+func TestTopLevelReturn(t *testing.T) {
+	tests := []vmTestCase{
+		{input: `return 1; 2;`, expected: 1},
+		{input: `let f = fn() { 10 }; return f() + 1; 99;`, expected: 11},
+		{input: `if (true) { return 5; } 6;`, expected: 5},
+		{input: `if (false) { return 5; } 6;`, expected: 6},
+		{input: `let f = fn(x) { return x; }; f(1); return [f(2)]; f(3);`, expected: []int{2}},
+	}
+
+	runVmTests(t, tests)
+}
+
 func TestFirstClassFunctions(t *testing.T) {
 	tests := []vmTestCase{
 		{
@@ -428,6 +538,61 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`rest([])`, Null},
 		{`push([], 1)`, []int{1}},
 		{`push(1, 1)`, &object.Error{Message: "argument to `push` must be ARRAY, got INTEGER"}},
+		{`range(3)`, []int{0, 1, 2}},
+		{`range(1, 4)`, []int{1, 2, 3}},
+		{`range(5, 0, -2)`, []int{5, 3, 1}},
+		{`range(1, 2, 0)`, &object.Error{Message: "step of `range` must not be 0"}},
+		{`sort([3, 1, 2])`, []int{1, 2, 3}},
+		{`sort([1, "a"])`, &object.Error{Message: "elements of `sort` must be all INTEGER or all STRING, got STRING"}},
+		{`join([1, 2, 3], ", ")`, "1, 2, 3"},
+		{`join(1, ", ")`, &object.Error{Message: "argument to `join` must be ARRAY, got INTEGER"}},
+		{`len(split("a,b,c", ","))`, 3},
+		{`keys({"a": 1})`, []string{"a"}},
+		{`values({"a": 1})`, []int{1}},
+		{`set({"a": 1}, "a", 2)["a"]`, 2},
+		{`set([], "a", 2)`, &object.Error{Message: "argument to `set` must be HASH, got ARRAY"}},
+		{`keys({"b": 1, "a": 2, "c": 3})`, []string{"b", "a", "c"}},
+		{`keys(set({"b": 1, "a": 2}, "b", 3))`, []string{"b", "a"}},
+		{`values(delete({"a": 1, "b": 2, "c": 3}, "b"))`, []int{1, 3}},
+		{`let h = {"a": 1}; delete(h, "a"); h["a"]`, 1},
+		{`entries({"a": 1, "b": 2})[1][0]`, "b"},
+		{`entries({"a": 1, "b": 2})[1][1]`, 2},
+		{`has({"a": 1}, "a")`, true},
+		{`has({"a": 1}, "b")`, false},
+		{`has({[1]: 1}, [1])`, true},
+		{`has({"a": 1}, [len])`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`keys(merge({"b": 1, "a": 2}, {"c": 3, "b": 4}))`, []string{"b", "a", "c"}},
+		{`values(merge({"b": 1, "a": 2}, {"c": 3, "b": 4}))`, []int{4, 2, 3}},
+		{`merge({"a": 1}, 1)`, &object.Error{Message: "arguments to `merge` must be HASH, got HASH and INTEGER"}},
+		{`keys(fromPairs([["b", 1], ["a", 2], ["b", 3]]))`, []string{"b", "a"}},
+		{`fromPairs([[[len], 1]])`, &object.Error{Message: "unusable as hash key: ARRAY"}},
+		{`values(mapValues({"b": 1, "a": 2}, fn(v) { v * 10 }))`, []int{10, 20}},
+		{`keys(filterValues({"b": 1, "a": 2, "c": 3}, fn(v) { v != 2 }))`, []string{"b", "c"}},
+		{`mapValues([], fn(v) { v })`, &object.Error{Message: "argument to `mapValues` must be HASH, got ARRAY"}},
+		{`delete([], "a")`, &object.Error{Message: "argument to `delete` must be HASH, got ARRAY"}},
+		{`assert(1 < 2)`, Null},
+		{`assert(1 > 2, "one is not greater")`, &object.Error{Message: "assertion failed: one is not greater"}},
+		{`assertEqual(push([1], {"a": 2}), [1, {"a": 2}])`, Null},
+		{`assertEqual("a", "b")`, &object.Error{Message: `got "a", want "b"`}},
+		{`assertError(fn() { 1 + true })`, Null},
+		{`assertError(fn() { len(1) }, "not supported")`, Null},
+		{`assertError(fn() { 1 })`, &object.Error{Message: "expected an error, got 1"}},
+		{`let f = fn(x) { assertError(fn() { x + true }); x * 2 }; [f(1), f(2)]`, []int{2, 4}},
+		{`trim("  monkey ")`, "monkey"},
+		{`upper("monkey")`, "MONKEY"},
+		{`lower("MONKEY")`, "monkey"},
+		{`contains("monkey", "key")`, true},
+		{`contains("monkey", "dog")`, false},
+		{`contains([1, "a"], "a")`, true},
+		{`contains(1, 1)`, &object.Error{Message: "argument to `contains` must be STRING or ARRAY, got INTEGER"}},
+		{`replace("a-b-c", "-", "+")`, "a+b+c"},
+		{`startsWith("monkey", "mon")`, true},
+		{`startsWith("monkey", "key")`, false},
+		{`indexOf("monkey", "key")`, 3},
+		{`indexOf("monkey", "dog")`, -1},
+		{`indexOf([1, 2, 3], 3)`, 2},
+		{`format("{} + {} = {}", 1, 2, "three")`, "1 + 2 = three"},
+		{`format("{}")`, &object.Error{Message: "wrong number of arguments to `format`. placeholders=1, got=0"}},
 	}
 
 	runVmTests(t, tests)
@@ -588,6 +753,303 @@ func TestRecursiveFibonacci(t *testing.T) {
 	runVmTests(t, tests)
 }
 
+// TestSuperinstructions runs each input with the superinstructions and, with a hook attached,
+// without them, and checks that both give the same result.
+func TestSuperinstructions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{} // a string starting with "error: " is an error message
+	}{
+		{`let f = fn(x) { x + 1 }; f(1)`, 2},
+		{`let f = fn(x) { x - 1 }; f(-200)`, -201},
+		{`let f = fn(s) { s + "!" }; f("hi")`, "hi!"},
+		{`let f = fn(x) { x + 1 }; f(true)`, "error: unsupported types for binary operation: BOOLEAN INTEGER"},
+		{`let f = fn(x) { x - 1 }; f("a")`, "error: unsupported types for binary operation: STRING INTEGER"},
+		{`let f = fn(x) { if (x == 1) { 10 } else { 20 } }; [f(1), f(2)]`, []int{10, 20}},
+		{`let f = fn(x) { if (x != 1) { 10 } else { 20 } }; [f(1), f(2)]`, []int{20, 10}},
+		{`let f = fn(x) { if (x < 2) { 10 } else { 20 } }; [f(1), f(2)]`, []int{10, 20}},
+		{`let f = fn(x) { if (x > 1) { 10 } }; f(1)`, Null},
+		{`let f = fn(s) { if (s == "a") { 1 } else { 2 } }; [f("a"), f("b")]`, []int{1, 2}},
+		{`let f = fn(a) { if (a == [1]) { 1 } else { 2 } }; [f([1]), f([2])]`, []int{1, 2}},
+		{`let f = fn(x) { if (x > "a") { 1 } else { 2 } }; f(1)`, "error: unknown operator: 10 (INTEGER STRING)"},
+		{`let f = fn(x) { let y = x; y + 1 }; f(1)`, 2},
+		// Frames are reused between calls
+		{`let count = fn(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }; count(500)`, 500},
+		{`let g = fn(x) { x * 2 }; let h = fn(x) { g(x) + g(x + 1) }; [h(1), h(2)]`, []int{6, 10}},
+		{`let make = fn(x) { fn() { x } }; let a = make(1); let b = make(2); [a(), b(), a()]`, []int{1, 2, 1}},
+		{`let f = fn() { assertError(len); 5 }; [f(), f()]`, []int{5, 5}},
+		{`let f = fn(x) { assertError(fn() { x + true }); x - 1 }; [f(1), f(2)]`, []int{0, 1}},
+	}
+
+	for _, tt := range tests {
+		comp := compiler.New()
+		if err := comp.Compile(parse(tt.input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		for _, hooked := range []bool{false, true} {
+			vm := New(comp.Bytecode())
+			hook := &countingHook{}
+			if hooked {
+				vm.SetHook(hook)
+			}
+			err := vm.Run()
+
+			if message, ok := tt.expected.(string); ok && strings.HasPrefix(message, "error: ") {
+				if err == nil || err.Error() != strings.TrimPrefix(message, "error: ") {
+					t.Errorf("%s (hook %t): wrong error. want=%q, got=%v", tt.input, hooked, message, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s (hook %t): vm error: %s", tt.input, hooked, err)
+			}
+			testExpectedObject(t, tt.expected, vm.LastPoppedStackElem())
+			if hooked && hook.count == 0 {
+				t.Errorf("%s: hook is not called", tt.input)
+			}
+		}
+	}
+}
+
+func TestOutput(t *testing.T) {
+	comp := compiler.New()
+	if err := comp.Compile(parse(`let say = fn(x) { puts(x) }; say("a"); puts(1, 2);`)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	var first, second strings.Builder
+	for _, out := range []*strings.Builder{&first, &second} {
+		vm := New(comp.Bytecode())
+		vm.SetOutput(out)
+		if err := vm.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+	}
+
+	for _, out := range []*strings.Builder{&first, &second} {
+		if out.String() != "a\n1\n2\n" {
+			t.Errorf("wrong output. want=%q, got=%q", "a\n1\n2\n", out.String())
+		}
+	}
+}
+
+func TestInterrupt(t *testing.T) {
+	// Each input runs for far longer than the test waits
+	inputs := []string{
+		`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; f(100)`,
+		// A builtin calling a function doesn't catch the interruption as an error value
+		`let f = fn(n) { if (n == 0) { 0 } else { f(n - 1) + f(n - 1) } }; assertError(fn() { f(100) }); 1`,
+	}
+
+	for _, input := range inputs {
+		comp := compiler.New()
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+		vm := New(comp.Bytecode())
+
+		done := make(chan error)
+		go func() { done <- vm.Run() }()
+		time.Sleep(10 * time.Millisecond)
+		vm.Interrupt()
+
+		select {
+		case err := <-done:
+			if err != ErrInterrupted {
+				t.Errorf("%s: wrong error. want=%v, got=%v", input, ErrInterrupted, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: Run did not stop", input)
+		}
+	}
+}
+
+// recordingHook records the local variables and operands every time the VM reaches
+// the first instruction of a statement inside a function
+type recordingHook struct {
+	snapshots []string
+	limit     int
+}
+
+func (h *recordingHook) Before(vm *VM) error {
+	frames := vm.Frames()
+	frame := frames[len(frames)-1]
+	fn := frame.Closure().Fn
+
+	pos, ok := fn.SourceMap.Lookup(frame.IP())
+	if !ok || pos.Offset != frame.IP() || len(frames) == 1 {
+		return nil
+	}
+
+	locals := []string{}
+	for i, v := range vm.Locals(frame) {
+		value := "<nil>"
+		if v != nil {
+			value = v.Inspect()
+		}
+		locals = append(locals, fn.LocalNames[i]+"="+value)
+	}
+	free := []string{}
+	for i, v := range frame.Closure().Free {
+		free = append(free, fn.FreeNames[i]+"="+v.Inspect())
+	}
+	h.snapshots = append(h.snapshots, fmt.Sprintf("%s line %d depth %d locals [%s] free [%s] operands %d",
+		fn.Name, pos.Line, len(frames), strings.Join(locals, " "), strings.Join(free, " "), len(vm.Operands(frame))))
+
+	if h.limit > 0 && len(h.snapshots) >= h.limit {
+		return fmt.Errorf("stopped by hook")
+	}
+	return nil
+}
+
+func TestHook(t *testing.T) {
+	input := `let n = 10;
+let add = fn(a, b) {
+  let c = a + b;
+  c + n
+};
+let outer = fn(x) {
+  let inner = fn(y) {
+    x + y
+  };
+  add(inner(1), 2)
+};
+outer(5);`
+
+	compiler := compiler.New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	hook := &recordingHook{}
+	vm := New(compiler.Bytecode())
+	vm.SetHook(hook)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+	testExpectedObject(t, 18, vm.LastPoppedStackElem())
+
+	expected := []string{
+		"outer line 7 depth 2 locals [x=5 inner=<nil>] free [] operands 0",
+		"outer line 10 depth 2 locals [x=5 inner=Closure[%p]] free [] operands 0",
+		"inner line 8 depth 3 locals [y=1] free [x=5] operands 0",
+		"add line 3 depth 3 locals [a=6 b=2 c=<nil>] free [] operands 0",
+		"add line 4 depth 3 locals [a=6 b=2 c=8] free [] operands 0",
+	}
+	if len(hook.snapshots) != len(expected) {
+		t.Fatalf("wrong number of snapshots. want=%d, got=%d\n%s", len(expected), len(hook.snapshots), strings.Join(hook.snapshots, "\n"))
+	}
+	for i, want := range expected {
+		got := hook.snapshots[i]
+		if strings.Contains(want, "%p") {
+			// The address of a closure is different on every run
+			prefix := want[:strings.Index(want, "Closure[")]
+			if !strings.HasPrefix(got, prefix) {
+				t.Errorf("snapshot %d wrong.\nwant=%s\ngot= %s", i, want, got)
+			}
+			continue
+		}
+		if got != want {
+			t.Errorf("snapshot %d wrong.\nwant=%s\ngot= %s", i, want, got)
+		}
+	}
+}
+
+func TestHookStopsRun(t *testing.T) {
+	input := `let f = fn() { 1; 2; 3 }; f();`
+
+	compiler := compiler.New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	hook := &recordingHook{limit: 2}
+	vm := New(compiler.Bytecode())
+	vm.SetHook(hook)
+
+	err := vm.Run()
+	if err == nil || err.Error() != "stopped by hook" {
+		t.Fatalf("expected error from hook, got=%v", err)
+	}
+	if len(hook.snapshots) != 2 {
+		t.Errorf("hook was called after returning an error. snapshots=%d", len(hook.snapshots))
+	}
+}
+
+func TestHooks(t *testing.T) {
+	input := `let f = fn() { 1; 2; 3 }; f();`
+
+	compiler := compiler.New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	// Every hook sees each instruction until one of them stops the VM
+	first, second, last := &countingHook{}, &recordingHook{limit: 2}, &countingHook{}
+	vm := New(compiler.Bytecode())
+	vm.SetHook(Hooks{first, second, last})
+
+	err := vm.Run()
+	if err == nil || err.Error() != "stopped by hook" {
+		t.Fatalf("expected error from hook, got=%v", err)
+	}
+	if first.count != last.count+1 {
+		t.Errorf("hooks after the failing one should not be called. first=%d, last=%d", first.count, last.count)
+	}
+}
+
+func TestOperands(t *testing.T) {
+	input := `let g = fn() { 3 }; let f = fn(a) { let b = 2; a * (b + g()) }; 10 + f(1);`
+
+	compiler := compiler.New()
+	if err := compiler.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	hook := &operandsHook{}
+	vm := New(compiler.Bytecode())
+	vm.SetHook(hook)
+	if err := vm.Run(); err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	// When g starts, main has pushed 10, and f has pushed a and b
+	expected := []string{"[10]", "[1 2]", "[]"}
+	if strings.Join(hook.operands, " ") != strings.Join(expected, " ") {
+		t.Errorf("wrong operands. want=%v, got=%v", expected, hook.operands)
+	}
+}
+
+// countingHook counts the instructions the VM executes
+type countingHook struct {
+	count int
+}
+
+func (h *countingHook) Before(vm *VM) error {
+	h.count++
+	return nil
+}
+
+type operandsHook struct {
+	operands []string
+}
+
+func (h *operandsHook) Before(vm *VM) error {
+	frames := vm.Frames()
+	if len(frames) != 3 || h.operands != nil {
+		return nil
+	}
+	for _, f := range frames {
+		values := []string{}
+		for _, v := range vm.Operands(f) {
+			values = append(values, v.Inspect())
+		}
+		h.operands = append(h.operands, "["+strings.Join(values, " ")+"]")
+	}
+	return nil
+}
+
 // Test Helpers
 
 func parse(input string) *ast.Program {
@@ -655,6 +1117,22 @@ func testExpectedObject(t *testing.T, expected interface{}, actual object.Object
 				t.Errorf("testIntegerObject failed: %s", err)
 			}
 		}
+	case []string:
+		array, ok := actual.(*object.Array)
+		if !ok {
+			t.Errorf("object is not Array. got=%T (%+v)", actual, actual)
+		}
+
+		if len(array.Elements) != len(expected) {
+			t.Fatalf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+		}
+
+		for i, expectedElem := range expected {
+			err := testStringObject(expectedElem, array.Elements[i])
+			if err != nil {
+				t.Errorf("testStringObject failed: %s", err)
+			}
+		}
 	case map[object.HashKey]int64:
 		hash, ok := actual.(*object.Hash)
 		if !ok {